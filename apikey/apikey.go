@@ -0,0 +1,163 @@
+// Package apikey stores customer scoped api keys for machine clients like ci
+// pipelines. A key's token is its id and a secret, and only a hash of the
+// secret is stored, so tokens can't be recovered from the store.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opsee/compost/scope"
+
+	"github.com/opsee/basic/schema"
+)
+
+const (
+	PermissionRead  = "read"
+	PermissionEdit  = "edit"
+	PermissionAdmin = "admin"
+
+	// UserId is the user id of every api key's user, which no real user has.
+	UserId int32 = -1
+)
+
+var (
+	ErrNotFound = errors.New("api key not found")
+	ErrInvalid  = errors.New("api key is invalid")
+	ErrExpired  = errors.New("api key has expired")
+
+	ErrMissingName       = errors.New("api keys need a name")
+	ErrUnknownPermission = errors.New("api key permission must be read, edit or admin")
+)
+
+// Key is an api key, without its secret.
+type Key struct {
+	Id         string    `json:"id"`
+	CustomerId string    `json:"customer_id"`
+	Name       string    `json:"name"`
+	SecretHash string    `json:"secret_hash"`
+	Permission string    `json:"permission"`
+	CreatedBy  int32     `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// ExpiresAt is zero for keys that don't expire.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Scope is the regions and VPCs the key may use, or all of them if it's
+	// empty.
+	Scope scope.Scope `json:"scope,omitempty"`
+}
+
+// New makes a key, returning it and its token, which is only ever shown here.
+func New(customerId, name, permission string, createdBy int32, expiresAt time.Time) (*Key, string, error) {
+	if name == "" {
+		return nil, "", ErrMissingName
+	}
+
+	switch permission {
+	case PermissionRead, PermissionEdit, PermissionAdmin:
+	default:
+		return nil, "", ErrUnknownPermission
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &Key{
+		Id:         id,
+		CustomerId: customerId,
+		Name:       name,
+		SecretHash: hashSecret(secret),
+		Permission: permission,
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now().UTC(),
+		ExpiresAt:  expiresAt,
+	}
+
+	return key, id + "." + secret, nil
+}
+
+// Expired is whether the key has expired by now.
+func (key *Key) Expired(now time.Time) bool {
+	return !key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt)
+}
+
+// User is who requests made with the key act as: a user of the key's customer
+// with only the key's permissions.
+func (key *Key) User() *schema.User {
+	perms := &schema.UserFlags{}
+	switch key.Permission {
+	case PermissionEdit:
+		perms.Edit = true
+	case PermissionAdmin:
+		perms.Edit = true
+		perms.Admin = true
+	}
+
+	return &schema.User{
+		Id:         UserId,
+		CustomerId: key.CustomerId,
+		Email:      "apikey:" + key.Id,
+		Name:       key.Name,
+		Verified:   true,
+		Active:     true,
+		Status:     "active",
+		Perms:      perms,
+	}
+}
+
+// Authenticate finds the key for token, if its secret matches and it hasn't
+// expired.
+func Authenticate(store Store, token string, now time.Time) (*Key, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalid
+	}
+
+	key, err := store.Get(parts[0])
+	if err == ErrNotFound {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashSecret(parts[1]))) != 1 {
+		return nil, ErrInvalid
+	}
+
+	if key.Expired(now) {
+		return nil, ErrExpired
+	}
+
+	return key, nil
+}
+
+// secrets are random, so a plain hash is enough to keep them from being
+// recovered.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating api key: %s", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,100 @@
+package apikey
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+	store := NewMemoryStore()
+
+	key, token, err := New("customer", "ci", PermissionEdit, 1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(key.SecretHash, token[len(key.Id)+1:])
+	assert.NoError(store.Put(key))
+
+	found, err := Authenticate(store, token, time.Now())
+	assert.NoError(err)
+	assert.Equal(key, found)
+
+	user := found.User()
+	assert.NoError(user.Validate())
+	assert.Equal("customer", user.CustomerId)
+	assert.True(user.Perms.Edit)
+	assert.False(user.Perms.Admin)
+	assert.False(user.IsOpseeAdmin())
+
+	for _, bad := range []string{"", "nope", key.Id, key.Id + ".", key.Id + ".wrong", "unknown.secret"} {
+		_, err = Authenticate(store, bad, time.Now())
+		assert.Equal(ErrInvalid, err, bad)
+	}
+
+	expiring, token, err := New("customer", "deploys", PermissionRead, 1, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(store.Put(expiring))
+
+	_, err = Authenticate(store, token, time.Now())
+	assert.NoError(err)
+	_, err = Authenticate(store, token, time.Now().Add(2*time.Hour))
+	assert.Equal(ErrExpired, err)
+
+	_, _, err = New("customer", "", PermissionRead, 1, time.Time{})
+	assert.Equal(ErrMissingName, err)
+	_, _, err = New("customer", "ci", "root", 1, time.Time{})
+	assert.Equal(ErrUnknownPermission, err)
+}
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "apikey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys.json")
+	store, err := Config{Store: StoreFile, File: path}.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _, _ := New("customer", "first", PermissionRead, 1, time.Time{})
+	second, _, _ := New("customer", "second", PermissionAdmin, 1, time.Time{})
+	other, _, _ := New("other", "other", PermissionRead, 2, time.Time{})
+	for _, key := range []*Key{first, second, other} {
+		assert.NoError(store.Put(key))
+	}
+
+	assert.Equal(ErrNotFound, store.Delete("other", first.Id))
+	assert.NoError(store.Delete("customer", second.Id))
+
+	// a new store reads what the last one wrote
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.List("customer")
+	assert.NoError(err)
+	if assert.Len(keys, 1) {
+		assert.Equal(first.Id, keys[0].Id)
+		assert.Equal(first.SecretHash, keys[0].SecretHash)
+	}
+
+	_, err = store.Get(second.Id)
+	assert.Equal(ErrNotFound, err)
+
+	assert.Error(Config{Store: StoreFile}.Validate())
+	assert.Error(Config{Store: "etcd"}.Validate())
+}
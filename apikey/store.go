@@ -0,0 +1,246 @@
+package apikey
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+)
+
+var (
+	errUnknownStore = errors.New("unknown api key store")
+	errMissingFile  = errors.New("the file api key store needs a file")
+)
+
+// Store keeps api keys.
+type Store interface {
+	Put(key *Key) error
+
+	// Get returns ErrNotFound for unknown ids.
+	Get(id string) (*Key, error)
+
+	// List returns a customer's keys, oldest first.
+	List(customerId string) ([]*Key, error)
+
+	// Delete removes a customer's key, returning ErrNotFound if the customer
+	// has no key with that id.
+	Delete(customerId, id string) error
+}
+
+// Config picks where api keys are stored.
+type Config struct {
+	// Store is memory (the default) or file.
+	Store string `json:"store"`
+
+	// File is where the file store keeps keys.
+	File string `json:"file,omitempty"`
+}
+
+func (config Config) Validate() error {
+	switch config.Store {
+	case "", StoreMemory:
+	case StoreFile:
+		if config.File == "" {
+			return errMissingFile
+		}
+	default:
+		return fmt.Errorf("%s: %s", errUnknownStore, config.Store)
+	}
+
+	return nil
+}
+
+// NewStore returns the configured store.
+func (config Config) NewStore() (Store, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Store == StoreFile {
+		return NewFileStore(config.File)
+	}
+
+	return NewMemoryStore(), nil
+}
+
+// MemoryStore keeps keys for as long as the process runs.
+type MemoryStore struct {
+	mut  sync.RWMutex
+	keys map[string]*Key
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]*Key)}
+}
+
+func (s *MemoryStore) Put(key *Key) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.keys[key.Id] = key
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Key, error) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return key, nil
+}
+
+func (s *MemoryStore) List(customerId string) ([]*Key, error) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	keys := []*Key{}
+	for _, key := range s.keys {
+		if key.CustomerId == customerId {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(byCreated(keys))
+
+	return keys, nil
+}
+
+func (s *MemoryStore) Delete(customerId, id string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok || key.CustomerId != customerId {
+		return ErrNotFound
+	}
+
+	delete(s.keys, id)
+	return nil
+}
+
+// FileStore is a MemoryStore that rewrites a json file of every key whenever
+// they change, and reads it when it's made.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("error parsing api key file %s: %s", path, err)
+	}
+
+	for _, key := range keys {
+		store.keys[key.Id] = key
+	}
+
+	return store, nil
+}
+
+func (s *FileStore) Put(key *Key) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	previous, existed := s.keys[key.Id]
+	s.keys[key.Id] = key
+
+	if err := s.write(); err != nil {
+		if existed {
+			s.keys[key.Id] = previous
+		} else {
+			delete(s.keys, key.Id)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStore) Delete(customerId, id string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok || key.CustomerId != customerId {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+
+	if err := s.write(); err != nil {
+		s.keys[id] = key
+		return err
+	}
+
+	return nil
+}
+
+// write replaces the file with the keys, through a temporary file so it's
+// never half written. It must be called with the lock held.
+func (s *FileStore) write() error {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Sort(byCreated(keys))
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+type byCreated []*Key
+
+func (k byCreated) Len() int      { return len(k) }
+func (k byCreated) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k byCreated) Less(i, j int) bool {
+	if !k[i].CreatedAt.Equal(k[j].CreatedAt) {
+		return k[i].CreatedAt.Before(k[j].CreatedAt)
+	}
+
+	return k[i].Id < k[j].Id
+}
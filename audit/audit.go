@@ -0,0 +1,263 @@
+// Package audit records who did what to which customer's account.
+package audit
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/opsee/logrus"
+	"golang.org/x/net/context"
+)
+
+const (
+	SinkLog    = "log"
+	SinkFile   = "file"
+	SinkDynamo = "dynamo"
+
+	// ActionImpersonate is an opsee admin's request made as a customer's user.
+	ActionImpersonate = "impersonate"
+
+	// ActionMutation is a mutation field resolved.
+	ActionMutation = "mutation"
+
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+var (
+	// ErrNotQueryable is returned by sinks that can't be queried.
+	ErrNotQueryable = errors.New("the audit log can't be queried")
+
+	errUnknownSink   = errors.New("unknown audit sink")
+	errMissingFile   = errors.New("the file audit sink needs a file")
+	errMissingTable  = errors.New("the dynamo audit sink needs a table")
+	errMissingDynamo = errors.New("the dynamo audit sink needs dynamo")
+)
+
+// Entry is one audited action.
+type Entry struct {
+	Id   string    `json:"id"`
+	Time time.Time `json:"time"`
+
+	// Actor is who did it: for impersonated requests, the opsee admin.
+	ActorCustomerId string `json:"actor_customer_id"`
+	ActorId         int32  `json:"actor_id"`
+	ActorEmail      string `json:"actor_email"`
+	ApiKeyId        string `json:"api_key_id,omitempty"`
+
+	// CustomerId is whose account it was done to, and UserId who it was done
+	// as, if not the actor.
+	CustomerId string `json:"customer_id"`
+	UserId     int32  `json:"user_id,omitempty"`
+
+	Action        string   `json:"action"`
+	Elevated      bool     `json:"elevated,omitempty"`
+	Operation     string   `json:"operation,omitempty"`
+	OperationType string   `json:"operation_type,omitempty"`
+	Fields        []string `json:"fields,omitempty"`
+
+	// Field is the mutation field, and Arguments its arguments, with secrets
+	// redacted.
+	Field     string                 `json:"field,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+
+	Outcome string   `json:"outcome"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// NewEntry is an entry with a new id, at the current time.
+func NewEntry() *Entry {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &Entry{Id: hex.EncodeToString(id), Time: time.Now().UTC()}
+}
+
+// Query picks a customer's entries.
+type Query struct {
+	CustomerId string
+
+	// Start and End are the times entries are between, inclusive.
+	Start time.Time
+	End   time.Time
+
+	// ActorId only picks one user's entries, if it's not zero.
+	ActorId int32
+
+	// Limit is the most entries returned, if it's not zero.
+	Limit int
+}
+
+func (q Query) match(entry *Entry) bool {
+	return entry.CustomerId == q.CustomerId &&
+		!entry.Time.Before(q.Start) && !entry.Time.After(q.End) &&
+		(q.ActorId == 0 || entry.ActorId == q.ActorId)
+}
+
+// Sink records entries.
+type Sink interface {
+	Record(ctx context.Context, entry *Entry) error
+
+	// Query returns the entries a query picks, newest first, or
+	// ErrNotQueryable.
+	Query(ctx context.Context, q Query) ([]*Entry, error)
+}
+
+// Config picks where entries are recorded.
+type Config struct {
+	// Sink is log (the default), which logs entries and can't be queried,
+	// file or dynamo.
+	Sink string `json:"sink"`
+
+	// File is where the file sink appends entries, a json object per line.
+	File string `json:"file,omitempty"`
+
+	// Table is the dynamo sink's table.
+	Table string `json:"table,omitempty"`
+}
+
+func (config Config) Validate() error {
+	switch config.Sink {
+	case "", SinkLog:
+	case SinkFile:
+		if config.File == "" {
+			return errMissingFile
+		}
+	case SinkDynamo:
+		if config.Table == "" {
+			return errMissingTable
+		}
+	default:
+		return fmt.Errorf("%s: %s", errUnknownSink, config.Sink)
+	}
+
+	return nil
+}
+
+// NewSink returns the configured sink. db is only needed by the dynamo sink.
+func (config Config) NewSink(db DynamoAPI) (Sink, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.Sink {
+	case SinkFile:
+		return NewFileSink(config.File)
+	case SinkDynamo:
+		if db == nil {
+			return nil, errMissingDynamo
+		}
+		return NewDynamoSink(db, config.Table), nil
+	}
+
+	return LogSink{}, nil
+}
+
+// LogSink logs entries.
+type LogSink struct{}
+
+func (LogSink) Record(ctx context.Context, entry *Entry) error {
+	log.WithFields(log.Fields{
+		"id":                entry.Id,
+		"actor_customer_id": entry.ActorCustomerId,
+		"actor_id":          entry.ActorId,
+		"actor_email":       entry.ActorEmail,
+		"api_key_id":        entry.ApiKeyId,
+		"customer_id":       entry.CustomerId,
+		"user_id":           entry.UserId,
+		"action":            entry.Action,
+		"elevated":          entry.Elevated,
+		"operation":         entry.Operation,
+		"operation_type":    entry.OperationType,
+		"fields":            entry.Fields,
+		"field":             entry.Field,
+		"arguments":         entry.Arguments,
+		"outcome":           entry.Outcome,
+		"errors":            entry.Errors,
+	}).Info("audit")
+
+	return nil
+}
+
+func (LogSink) Query(ctx context.Context, q Query) ([]*Entry, error) {
+	return nil, ErrNotQueryable
+}
+
+// FileSink appends entries to a file, a json object per line.
+type FileSink struct {
+	mut  sync.Mutex
+	path string
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{path: path, file: file}, nil
+}
+
+func (s *FileSink) Record(ctx context.Context, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Query reads the whole file.
+func (s *FileSink) Query(ctx context.Context, q Query) ([]*Entry, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []*Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("error parsing audit file %s: %s", s.path, err)
+		}
+
+		if q.match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Stable(newestFirst(entries))
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+
+	return entries, nil
+}
+
+type newestFirst []*Entry
+
+func (e newestFirst) Len() int           { return len(e) }
+func (e newestFirst) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e newestFirst) Less(i, j int) bool { return e[i].Time.After(e[j].Time) }
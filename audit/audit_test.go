@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeDynamo is a table keyed by customer_id and time_id, queried as the
+// dynamo sink queries it.
+type fakeDynamo struct {
+	items []map[string]*dynamodb.AttributeValue
+}
+
+func (d *fakeDynamo) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	d.items = append(d.items, input.Item)
+	sort.Sort(byTimeId(d.items))
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (d *fakeDynamo) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	values := input.ExpressionAttributeValues
+	output := &dynamodb.QueryOutput{}
+
+	// items are sorted newest first, and pages are one item long, so that
+	// filtering and paging are both exercised
+	for i := len(d.items) - 1; i >= 0; i-- {
+		item := d.items[i]
+		timeId := *item["time_id"].S
+
+		if input.ExclusiveStartKey != nil && timeId >= *input.ExclusiveStartKey["time_id"].S {
+			continue
+		}
+
+		if *item["customer_id"].S != *values[":customer_id"].S || timeId < *values[":start"].S || timeId > *values[":end"].S {
+			continue
+		}
+
+		output.LastEvaluatedKey = item
+		if actor, ok := values[":actor_id"]; !ok || *item["actor_id"].N == *actor.N {
+			output.Items = append(output.Items, item)
+		}
+		return output, nil
+	}
+
+	output.LastEvaluatedKey = nil
+	return output, nil
+}
+
+type byTimeId []map[string]*dynamodb.AttributeValue
+
+func (t byTimeId) Len() int      { return len(t) }
+func (t byTimeId) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byTimeId) Less(i, j int) bool {
+	return aws.StringValue(t[i]["time_id"].S) < aws.StringValue(t[j]["time_id"].S)
+}
+
+func TestSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := NewFileSink(filepath.Join(dir, "audit.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, sink := range map[string]Sink{
+		SinkFile:   file,
+		SinkDynamo: NewDynamoSink(&fakeDynamo{}, "audit"),
+	} {
+		testSink(t, name, sink)
+	}
+}
+
+func testSink(t *testing.T, name string, sink Sink) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	start := time.Now().Add(-time.Hour)
+	for i, actor := range []int32{1, 2, 1} {
+		entry := NewEntry()
+		entry.Time = start.Add(time.Duration(i) * time.Minute)
+		entry.ActorId = actor
+		entry.CustomerId = "customer"
+		entry.Field = "deleteChecks"
+		entry.Arguments = map[string]interface{}{"ids": []interface{}{"check"}}
+		assert.NoError(sink.Record(ctx, entry), name)
+	}
+
+	other := NewEntry()
+	other.CustomerId = "other"
+	assert.NoError(sink.Record(ctx, other), name)
+
+	q := Query{CustomerId: "customer", Start: start, End: time.Now()}
+	entries, err := sink.Query(ctx, q)
+	assert.NoError(err, name)
+	if assert.Len(entries, 3, name) {
+		assert.True(entries[0].Time.After(entries[1].Time), name)
+		assert.Equal(map[string]interface{}{"ids": []interface{}{"check"}}, entries[0].Arguments, name)
+	}
+
+	q.ActorId = 1
+	entries, err = sink.Query(ctx, q)
+	assert.NoError(err, name)
+	assert.Len(entries, 2, name)
+
+	q.Limit = 1
+	entries, err = sink.Query(ctx, q)
+	assert.NoError(err, name)
+	if assert.Len(entries, 1, name) {
+		assert.Equal(start.Add(2*time.Minute).Unix(), entries[0].Time.Unix(), name)
+	}
+
+	q = Query{CustomerId: "customer", Start: start.Add(30 * time.Second), End: start.Add(90 * time.Second)}
+	entries, err = sink.Query(ctx, q)
+	assert.NoError(err, name)
+	assert.Len(entries, 1, name)
+}
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.json")
+	sink, err := Config{Sink: SinkFile, File: path}.NewSink(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int32{1, 2} {
+		assert.NoError(sink.Record(context.Background(), &Entry{
+			Time:       time.Now(),
+			ActorId:    id,
+			CustomerId: "customer",
+			Action:     ActionImpersonate,
+			Outcome:    OutcomeSuccess,
+		}))
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(lines, 2) {
+		entry := &Entry{}
+		assert.NoError(json.Unmarshal([]byte(lines[1]), entry))
+		assert.Equal(int32(2), entry.ActorId)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Config{}.Validate())
+	assert.Error(Config{Sink: SinkFile}.Validate())
+	assert.Error(Config{Sink: SinkDynamo}.Validate())
+	assert.Error(Config{Sink: "syslog"}.Validate())
+
+	sink, err := Config{}.NewSink(nil)
+	assert.NoError(err)
+	assert.IsType(LogSink{}, sink)
+
+	_, err = sink.Query(context.Background(), Query{})
+	assert.Equal(ErrNotQueryable, err)
+
+	_, err = Config{Sink: SinkDynamo, Table: "audit"}.NewSink(nil)
+	assert.Error(err)
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"golang.org/x/net/context"
+)
+
+// sortKeyTime formats times so that they sort as strings.
+const sortKeyTime = "2006-01-02T15:04:05.000000000Z"
+
+// DynamoAPI is the part of dynamo the dynamo sink uses.
+type DynamoAPI interface {
+	PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	Query(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoSink puts entries in a table keyed by customer_id, and sorted by
+// time_id, the entry's time and id. Entries are kept as json in entry, and
+// their actor in actor_id, to filter by.
+type DynamoSink struct {
+	db    DynamoAPI
+	table string
+}
+
+func NewDynamoSink(db DynamoAPI, table string) *DynamoSink {
+	return &DynamoSink{db: db, table: table}
+}
+
+func (s *DynamoSink) Record(ctx context.Context, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"customer_id": {S: aws.String(entry.CustomerId)},
+			"time_id":     {S: aws.String(entry.Time.UTC().Format(sortKeyTime) + "#" + entry.Id)},
+			"actor_id":    {N: aws.String(strconv.Itoa(int(entry.ActorId)))},
+			"entry":       {S: aws.String(string(data))},
+		},
+	})
+
+	return err
+}
+
+func (s *DynamoSink) Query(ctx context.Context, q Query) ([]*Entry, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.table),
+		KeyConditionExpression: aws.String("customer_id = :customer_id AND time_id BETWEEN :start AND :end"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":customer_id": {S: aws.String(q.CustomerId)},
+			":start":       {S: aws.String(q.Start.UTC().Format(sortKeyTime))},
+			// ~ sorts after every id
+			":end": {S: aws.String(q.End.UTC().Format(sortKeyTime) + "#~")},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	if q.ActorId != 0 {
+		input.FilterExpression = aws.String("actor_id = :actor_id")
+		input.ExpressionAttributeValues[":actor_id"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(int(q.ActorId)))}
+	}
+
+	entries := []*Entry{}
+	for {
+		if q.Limit > 0 {
+			input.Limit = aws.Int64(int64(q.Limit - len(entries)))
+		}
+
+		output, err := s.db.Query(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.Items {
+			attr, ok := item["entry"]
+			if !ok || attr.S == nil {
+				return nil, fmt.Errorf("audit entry %s has no entry", aws.StringValue(item["time_id"].S))
+			}
+
+			entry := &Entry{}
+			if err := json.Unmarshal([]byte(*attr.S), entry); err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 || (q.Limit > 0 && len(entries) >= q.Limit) {
+			return entries, nil
+		}
+
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
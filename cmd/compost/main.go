@@ -1,52 +1,77 @@
 package main
 
 import (
+	"flag"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/opsee/compost/composter"
+	"github.com/opsee/compost/config"
+	"github.com/opsee/compost/fake"
 	"github.com/opsee/compost/resolver"
+	"github.com/opsee/compost/tracing"
 	log "github.com/opsee/logrus"
 	"github.com/opsee/vaper"
 )
 
 func main() {
-	key, err := ioutil.ReadFile(mustEnvString("COMPOST_VAPE_KEYFILE"))
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		os.Exit(schemaCommand(os.Args[2:]))
+	}
+
+	configPath := flag.String("config", os.Getenv("COMPOST_CONFIG"), "path to a json config file")
+	fakeBackends := flag.Bool("fake-backends", os.Getenv("COMPOST_FAKE_BACKENDS") == "true", "serve from in-memory fixtures instead of real backends")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("Unable to load config: ", err)
+	}
+
+	key, err := ioutil.ReadFile(cfg.VapeKeyfile)
 	if err != nil {
 		log.Fatal("Unable to read vape key: ", err)
 	}
 	vaper.Init(key)
 
-	// for local dev only
-	skipVerify := os.Getenv("COMPOST_SKIP_VERIFY")
-
-	resolver, err := resolver.NewClient(resolver.ClientConfig{
-		SkipVerify: skipVerify == "true",
-		Bartnet:    "https://bartnet.in.opsee.com",
-		Beavis:     "https://beavis.in.opsee.com",
-		Spanx:      "spanx.in.opsee.com:8443",
-		Cats:       "cats.in.opsee.com:443",
-		Keelhaul:   "keelhaul.in.opsee.com:443",
-		Bezos:      "bezosphere.in.opsee.com:8443",
-		Hugs:       "https://hugs.in.opsee.com",
-		Marktricks: "marktricks.in.opsee.com:443",
-		Etcd:       "http://etcd.in.opsee.com:2479",
-	})
+	exporter, err := cfg.Tracing.NewExporter()
+	if err != nil {
+		log.Fatal("Unable to start tracing: ", err)
+	}
+	tracing.SetExporter(exporter)
+
+	var client *resolver.Client
+	if *fakeBackends {
+		log.Warn("using fake backends, nothing will be persisted")
+		client = fake.NewClient(fake.DefaultFixtures())
+		client.Instrument()
+	} else {
+		client, err = resolver.NewClient(cfg.Backends)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
+	composter, err := composter.New(client, cfg.GraphQL)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Unable to start graphql server: ", err)
 	}
 
-	composter := composter.New(resolver)
-	composter.StartHTTP(
-		mustEnvString("COMPOST_ADDRESS"),
-	)
-}
+	go func() {
+		if err := composter.StartHTTP(cfg.Address); err != nil {
+			log.Fatal("Unable to serve: ", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	sig := <-signals
+	log.Infof("received %s, shutting down within %s", sig, cfg.ShutdownGrace())
 
-func mustEnvString(envVar string) string {
-	out := os.Getenv(envVar)
-	if out == "" {
-		log.Fatal(envVar, "must be set")
+	if err := composter.Shutdown(cfg.ShutdownGrace()); err != nil {
+		log.WithError(err).Error("in flight requests didn't finish before shutdown")
 	}
-	return out
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/graphql-go/graphql"
+	"github.com/opsee/compost/composter"
+	"github.com/opsee/compost/resolver"
+)
+
+const schemaUsage = `usage: compost schema print [-admin] [-dir dir]
+       compost schema diff [-dir dir]
+
+print writes the schema (or admin schema) as SDL to stdout, or both schemas
+to snapshots in dir. diff compares both schemas to the snapshots in dir, and
+exits 1 if any change is breaking.
+`
+
+// snapshots are the files in the snapshot dir each schema is kept in.
+var snapshots = []struct {
+	file   string
+	schema func(*composter.Composter) graphql.Schema
+}{
+	{"schema.graphql", func(c *composter.Composter) graphql.Schema { return c.Schema }},
+	{"admin.graphql", func(c *composter.Composter) graphql.Schema { return c.AdminSchema }},
+}
+
+// schemaCommand runs compost schema, returning the exit code.
+func schemaCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, schemaUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("schema "+args[0], flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, schemaUsage) }
+	admin := flags.Bool("admin", false, "print the admin schema")
+	dir := flags.String("dir", "", "the schema snapshot directory")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	// resolvers aren't run, so the schema doesn't need backends
+	c, err := composter.New(&resolver.Client{}, composter.Config{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error building schema:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "print":
+		if *dir == "" {
+			schema := c.Schema
+			if *admin {
+				schema = c.AdminSchema
+			}
+			fmt.Print(composter.PrintSchema(schema))
+			return 0
+		}
+
+		for _, snapshot := range snapshots {
+			path := filepath.Join(*dir, snapshot.file)
+			if err := ioutil.WriteFile(path, []byte(composter.PrintSchema(snapshot.schema(c))), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		return 0
+
+	case "diff":
+		if *dir == "" {
+			*dir = "schema"
+		}
+
+		breaking := false
+		for _, snapshot := range snapshots {
+			path := filepath.Join(*dir, snapshot.file)
+			old, err := ioutil.ReadFile(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+
+			changes, err := composter.DiffSchemas(string(old), composter.PrintSchema(snapshot.schema(c)))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				return 1
+			}
+
+			for _, change := range changes {
+				fmt.Printf("%s: %s\n", path, change)
+				breaking = breaking || change.Breaking
+			}
+		}
+
+		if breaking {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprint(os.Stderr, schemaUsage)
+	return 2
+}
@@ -0,0 +1,300 @@
+package composter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/printer"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/basic/tp"
+	"github.com/opsee/compost/apikey"
+	log "github.com/opsee/logrus"
+	"golang.org/x/net/context"
+)
+
+// maxLoggedVariableLength is the longest string variable that's logged as is.
+const maxLoggedVariableLength = 128
+
+// redactedNames are the (lowercased) arguments, input fields and variables
+// whose values are never logged.
+var redactedNames = map[string]bool{
+	"password":    true,
+	"stripetoken": true,
+	"token":       true,
+	"authtoken":   true,
+	"secret":      true,
+}
+
+// accessEntry is what the access log records about one operation.
+type accessEntry struct {
+	operation     string
+	operationType string
+	queryHash     string
+	fields        []string
+	variables     map[string]interface{}
+	errors        int
+}
+
+// accessLog collects the operations run for one http request, keyed by the
+// request (or batched request) they ran for.
+type accessLog struct {
+	mut     sync.Mutex
+	entries map[*GraphQLRequest]*accessEntry
+}
+
+func (a *accessLog) add(request *GraphQLRequest, entry *accessEntry) {
+	a.mut.Lock()
+	a.entries[request] = entry
+	a.mut.Unlock()
+}
+
+func (a *accessLog) log(fields log.Fields, request *GraphQLRequest) {
+	a.mut.Lock()
+	entry, ok := a.entries[request]
+	a.mut.Unlock()
+
+	if !ok {
+		entry = &accessEntry{operation: request.OperationName}
+	}
+
+	fields["operation"] = entry.operation
+	fields["operation_type"] = entry.operationType
+	fields["query_hash"] = entry.queryHash
+	fields["fields"] = entry.fields
+	fields["variables"] = entry.variables
+	fields["errors"] = entry.errors
+
+	log.WithFields(fields).Info("graphql request")
+}
+
+// logAccess wraps a graphql handler, logging a line for each operation it runs
+// with who ran it, how long it took and how big the response was. Batches log a
+// line per request in the batch, with the whole batch's size and duration.
+func (s *Composter) logAccess(handler tp.HandleFunc) tp.HandleFunc {
+	return func(ctx context.Context) (interface{}, int, error) {
+		start := time.Now()
+		access := &accessLog{entries: make(map[*GraphQLRequest]*accessEntry)}
+
+		response, status, err := handler(context.WithValue(ctx, accessLogKey, access))
+
+		// encode the response here to know its size; tp passes raw json through
+		size := 0
+		if err == nil {
+			data, encodeErr := json.Marshal(response)
+			if encodeErr != nil {
+				response, status, err = nil, http.StatusInternalServerError, encodeErr
+			} else {
+				response, size = json.RawMessage(data), len(data)
+			}
+		}
+
+		fields := log.Fields{
+			"status":        status,
+			"response_size": size,
+			"duration_ms":   time.Since(start).Seconds() * 1000,
+		}
+
+		if user, ok := ctx.Value(userKey).(*schema.User); ok {
+			fields["customer_id"] = user.CustomerId
+			fields["user_id"] = user.Id
+		}
+
+		if key, ok := ctx.Value(apiKeyKey).(*apikey.Key); ok {
+			fields["api_key_id"] = key.Id
+		}
+
+		switch request := ctx.Value(requestKey).(type) {
+		case *GraphQLRequest:
+			access.log(fields, request)
+		case GraphQLBatch:
+			for i, r := range request {
+				batchFields := log.Fields{"batch_index": i, "batch_size": len(request)}
+				for k, v := range fields {
+					batchFields[k] = v
+				}
+				access.log(batchFields, r)
+			}
+		}
+
+		return response, status, err
+	}
+}
+
+// recordAccess records an executed operation in the context's access log, if
+// it has one. document and operation are nil if the query didn't get that far.
+func recordAccess(ctx context.Context, request *GraphQLRequest, query string, document *ast.Document, operation *ast.OperationDefinition, result *Result) {
+	access, ok := ctx.Value(accessLogKey).(*accessLog)
+	if !ok {
+		return
+	}
+
+	entry := &accessEntry{
+		operation: request.OperationName,
+		queryHash: normalizedQueryHash(query, document),
+		variables: redactVariables(request.Variables, redactedVariables(document)),
+	}
+
+	if result != nil {
+		entry.errors = len(result.Errors)
+	}
+
+	if operation != nil {
+		entry.operationType = operation.Operation
+		if operation.Name != nil {
+			entry.operation = operation.Name.Value
+		}
+		entry.fields = topLevelFields(document, operation.SelectionSet, make(map[string]bool))
+	}
+
+	access.add(request, entry)
+}
+
+// normalizedQueryHash hashes the printed document, so queries differing only
+// in whitespace and commas hash the same.
+func normalizedQueryHash(query string, document *ast.Document) string {
+	if document != nil {
+		if printed, ok := printer.Print(document).(string); ok {
+			query = printed
+		}
+	}
+
+	return queryHash(query)
+}
+
+// topLevelFields lists the operation's fields, including those in fragments.
+func topLevelFields(document *ast.Document, set *ast.SelectionSet, spread map[string]bool) []string {
+	if set == nil {
+		return nil
+	}
+
+	var fields []string
+	for _, selection := range set.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, sel.Name.Value)
+
+		case *ast.InlineFragment:
+			fields = append(fields, topLevelFields(document, sel.SelectionSet, spread)...)
+
+		case *ast.FragmentSpread:
+			name := sel.Name.Value
+			if spread[name] {
+				continue
+			}
+			spread[name] = true
+
+			for _, definition := range document.Definitions {
+				if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name.Value == name {
+					fields = append(fields, topLevelFields(document, fragment.SelectionSet, spread)...)
+				}
+			}
+		}
+	}
+
+	return fields
+}
+
+// redactedVariables finds the variables passed as redacted arguments or input
+// fields, like $p in user(password: $p).
+func redactedVariables(document *ast.Document) map[string]bool {
+	variables := make(map[string]bool)
+	if document == nil {
+		return variables
+	}
+
+	for _, definition := range document.Definitions {
+		switch def := definition.(type) {
+		case *ast.OperationDefinition:
+			redactedSelectionVariables(variables, def.SelectionSet)
+		case *ast.FragmentDefinition:
+			redactedSelectionVariables(variables, def.SelectionSet)
+		}
+	}
+
+	return variables
+}
+
+func redactedSelectionVariables(variables map[string]bool, set *ast.SelectionSet) {
+	if set == nil {
+		return
+	}
+
+	for _, selection := range set.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			for _, arg := range sel.Arguments {
+				redactedValueVariables(variables, arg.Name.Value, arg.Value)
+			}
+			redactedSelectionVariables(variables, sel.SelectionSet)
+
+		case *ast.InlineFragment:
+			redactedSelectionVariables(variables, sel.SelectionSet)
+		}
+	}
+}
+
+func redactedValueVariables(variables map[string]bool, name string, value ast.Value) {
+	switch v := value.(type) {
+	case *ast.Variable:
+		if redactedNames[strings.ToLower(name)] {
+			variables[v.Name.Value] = true
+		}
+
+	case *ast.ObjectValue:
+		for _, field := range v.Fields {
+			redactedValueVariables(variables, field.Name.Value, field.Value)
+		}
+
+	case *ast.ListValue:
+		for _, item := range v.Values {
+			redactedValueVariables(variables, name, item)
+		}
+	}
+}
+
+// redactVariables copies variables for logging, replacing redacted and long
+// values.
+func redactVariables(variables map[string]interface{}, redacted map[string]bool) map[string]interface{} {
+	if variables == nil {
+		return nil
+	}
+
+	logged := make(map[string]interface{}, len(variables))
+	for name, value := range variables {
+		if redacted[name] || redactedNames[strings.ToLower(name)] {
+			logged[name] = "[redacted]"
+			continue
+		}
+
+		logged[name] = redactValue(value)
+	}
+
+	return logged
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if len(v) > maxLoggedVariableLength {
+			return fmt.Sprintf("[redacted %d bytes]", len(v))
+		}
+		return v
+
+	case map[string]interface{}:
+		return redactVariables(v, nil)
+
+	case []interface{}:
+		logged := make([]interface{}, len(v))
+		for i, item := range v {
+			logged[i] = redactValue(item)
+		}
+		return logged
+	}
+
+	return value
+}
@@ -0,0 +1,90 @@
+package composter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opsee/compost/fake"
+	log "github.com/opsee/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactVariables(t *testing.T) {
+	assert := assert.New(t)
+
+	document := mustParse(t, `mutation change($p: String, $t: Team, $note: String) {
+		user(id: 1, password: $p) { id }
+		team(team: $t) { name }
+		other: team(team: {name: "x", stripeToken: $note}) { name }
+	}`)
+
+	variables := map[string]interface{}{
+		"p":     "hunter2",
+		"t":     map[string]interface{}{"name": "opsee", "stripeToken": "tok_123"},
+		"note":  "tok_456",
+		"long":  []interface{}{strings.Repeat("a", maxLoggedVariableLength+1)},
+		"count": float64(3),
+	}
+
+	assert.Equal(map[string]interface{}{
+		"p":     "[redacted]",
+		"t":     map[string]interface{}{"name": "opsee", "stripeToken": "[redacted]"},
+		"note":  "[redacted]",
+		"long":  []interface{}{"[redacted 129 bytes]"},
+		"count": float64(3),
+	}, redactVariables(variables, redactedVariables(document)))
+}
+
+func TestNormalizedQueryHash(t *testing.T) {
+	assert := assert.New(t)
+
+	a := "{ checks { id name } }"
+	b := "{\n  checks {\n    id,\n    name\n  }\n}"
+	assert.Equal(normalizedQueryHash(a, mustParse(t, a)), normalizedQueryHash(b, mustParse(t, b)))
+	assert.NotEqual(normalizedQueryHash(a, mustParse(t, a)), normalizedQueryHash("{ checks { id } }", mustParse(t, "{ checks { id } }")))
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	log.SetFormatter(&log.JSONFormatter{})
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFormatter(&log.TextFormatter{})
+	}()
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "query listChecks { checks { id } }"}`)
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		entry := make(map[string]interface{})
+		if json.Unmarshal([]byte(line), &entry) == nil && entry["msg"] == "graphql request" {
+			entries = append(entries, entry)
+		}
+	}
+
+	if !assert.Len(entries, 1) {
+		return
+	}
+
+	entry := entries[0]
+	assert.Equal("listChecks", entry["operation"])
+	assert.Equal("query", entry["operation_type"])
+	assert.Equal([]interface{}{"checks"}, entry["fields"])
+	assert.Equal(fake.CustomerId, entry["customer_id"])
+	assert.Equal(float64(1), entry["user_id"])
+	assert.Equal(float64(0), entry["errors"])
+	assert.Equal(float64(200), entry["status"])
+	assert.Equal(float64(w.Body.Len()), entry["response_size"])
+	assert.Len(entry["query_hash"], 64)
+}
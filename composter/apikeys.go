@@ -0,0 +1,254 @@
+package composter
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/apikey"
+	opsee_scalars "github.com/opsee/protobuf/plugin/graphql/scalars"
+	"golang.org/x/net/context"
+)
+
+var (
+	errApiKeyManagement = errors.New("api keys can't manage api keys")
+	errApiKeyExpiry     = errors.New("api key expiry must be in the future")
+	errMissingApiKeyId  = errors.New("missing api key id")
+
+	ApiKeyPermissionEnumType *graphql.Enum
+	ApiKeyType               *graphql.Object
+	CreatedApiKeyType        *graphql.Object
+)
+
+func initApiKeyTypes() {
+	if ApiKeyPermissionEnumType != nil {
+		return
+	}
+
+	ApiKeyPermissionEnumType = graphql.NewEnum(graphql.EnumConfig{
+		Name:        "ApiKeyPermission",
+		Description: "What an api key can do",
+		Values: graphql.EnumValueConfigMap{
+			apikey.PermissionRead: &graphql.EnumValueConfig{
+				Value:       apikey.PermissionRead,
+				Description: "Read only",
+			},
+			apikey.PermissionEdit: &graphql.EnumValueConfig{
+				Value:       apikey.PermissionEdit,
+				Description: "Read, and edit checks and notifications",
+			},
+			apikey.PermissionAdmin: &graphql.EnumValueConfig{
+				Value:       apikey.PermissionAdmin,
+				Description: "Everything a team admin can do, except manage api keys",
+			},
+		},
+	})
+
+	ApiKeyType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "ApiKey",
+		Description: "A key for machine clients to authenticate with",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"name": &graphql.Field{
+				Type: graphql.String,
+			},
+			"permission": &graphql.Field{
+				Type: ApiKeyPermissionEnumType,
+			},
+			"created_by": &graphql.Field{
+				Description: "The id of the user who created the key",
+				Type:        graphql.Int,
+			},
+			"created_at": &graphql.Field{
+				Description: "unix timestamp the key was created at",
+				Type:        opsee_scalars.Timestamp,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return unixOrNil(p.Source.(*apikey.Key).CreatedAt), nil
+				},
+			},
+			"expires_at": &graphql.Field{
+				Description: "unix timestamp the key expires at, if it expires",
+				Type:        opsee_scalars.Timestamp,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return unixOrNil(p.Source.(*apikey.Key).ExpiresAt), nil
+				},
+			},
+			"scope": &graphql.Field{
+				Description: "The regions the key may use, or every region if there are none",
+				Type:        graphql.NewList(RegionScopeType),
+			},
+		},
+	})
+
+	CreatedApiKeyType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "CreatedApiKey",
+		Description: "A new api key, and its token",
+		Fields: graphql.Fields{
+			"key": &graphql.Field{
+				Type: ApiKeyType,
+			},
+			"token": &graphql.Field{
+				Description: "Send as Authorization: ApiKey <token>. It isn't stored, so this is the only time it's shown.",
+				Type:        graphql.String,
+			},
+		},
+	})
+}
+
+type createdApiKey struct {
+	Key   *apikey.Key `json:"key"`
+	Token string      `json:"token"`
+}
+
+func unixOrNil(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return int(t.Unix())
+}
+
+// apiKeyManager is the requestor, if they can manage api keys. Their policy
+// lets team admins, but api keys are turned away here, so a leaked admin key
+// can't make more.
+func apiKeyManager(ctx context.Context) (*schema.User, error) {
+	if _, ok := ctx.Value(apiKeyKey).(*apikey.Key); ok {
+		return nil, forbidden(errApiKeyManagement)
+	}
+
+	return requestorFromContext(ctx)
+}
+
+func (c *Composter) queryApiKeys() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(ApiKeyType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, err := apiKeyManager(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.apiKeys.List(requestor.CustomerId)
+		},
+	}
+}
+
+func (c *Composter) createApiKey() *graphql.Field {
+	return &graphql.Field{
+		Type: CreatedApiKeyType,
+		Args: graphql.FieldConfigArgument{
+			"name": &graphql.ArgumentConfig{
+				Description: "What the key is for",
+				Type:        graphql.NewNonNull(graphql.String),
+			},
+			"permission": &graphql.ArgumentConfig{
+				Description: "What the key can do",
+				Type:        graphql.NewNonNull(ApiKeyPermissionEnumType),
+			},
+			"expires_at": &graphql.ArgumentConfig{
+				Description: "unix timestamp the key expires at, or never if it's not set",
+				Type:        opsee_scalars.Timestamp,
+			},
+			"scope": &graphql.ArgumentConfig{
+				Description: "The regions the key may use, within your own scope, or all of yours if it's not set",
+				Type:        graphql.NewList(RegionScopeInputType),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, err := apiKeyManager(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			var expiresAt time.Time
+			if ts, ok := p.Args["expires_at"].(int); ok {
+				expiresAt = time.Unix(int64(ts), 0).UTC()
+				if !expiresAt.After(time.Now()) {
+					return nil, errApiKeyExpiry
+				}
+			}
+
+			name, _ := p.Args["name"].(string)
+			permission, _ := p.Args["permission"].(string)
+
+			keyScope, err := scopeFromArgs(p.Args["scope"])
+			if err != nil {
+				return nil, err
+			}
+
+			// a scoped admin's keys are scoped too, to theirs if to nothing else
+			ownScope, err := c.scope(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			if keyScope.Unrestricted() {
+				keyScope = ownScope
+			}
+
+			if !keyScope.Within(ownScope) {
+				return nil, forbidden(errApiKeyScope)
+			}
+
+			key, token, err := apikey.New(requestor.CustomerId, strings.TrimSpace(name), permission, requestor.Id, expiresAt)
+			if err != nil {
+				return nil, err
+			}
+			key.Scope = keyScope
+
+			if err := c.apiKeys.Put(key); err != nil {
+				return nil, err
+			}
+
+			return &createdApiKey{Key: key, Token: token}, nil
+		},
+	}
+}
+
+func (c *Composter) revokeApiKey() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{
+				Description: "The api key id",
+				Type:        graphql.NewNonNull(graphql.String),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, err := apiKeyManager(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			id, _ := p.Args["id"].(string)
+			if id == "" {
+				return nil, errMissingApiKeyId
+			}
+
+			if err := c.apiKeys.Delete(requestor.CustomerId, id); err != nil {
+				return nil, err
+			}
+
+			return true, nil
+		},
+	}
+}
+
+// apiKeyUser authenticates an ApiKey authorization header.
+func (c *Composter) apiKeyUser(header string) (*apikey.Key, *schema.User, error) {
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return nil, nil, apikey.ErrInvalid
+	}
+
+	key, err := apikey.Authenticate(c.apiKeys, fields[1], time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, key.User(), nil
+}
@@ -0,0 +1,78 @@
+package composter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiKeyRequest := func(token, body string) *httptest.ResponseRecorder {
+		req := newTestGraphQLRequest(t, "POST", "/graphql", body)
+		req.Header.Set("Authorization", "ApiKey "+token)
+
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "mutation create { createApiKey(name: \"ci\", permission: read) { token key { id name permission created_at expires_at } } }"}`)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var created struct {
+		Data struct {
+			CreateApiKey struct {
+				Token string
+				Key   map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	token, key := created.Data.CreateApiKey.Token, created.Data.CreateApiKey.Key
+	assert.NotEmpty(token)
+	assert.Equal("ci", key["name"])
+	assert.Equal("read", key["permission"])
+	assert.NotNil(key["created_at"])
+	assert.Nil(key["expires_at"])
+
+	// the key can read, but not edit or manage keys
+	w = apiKeyRequest(token, `{"query": "{ checks { id } }"}`)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "fake-check-1")
+
+	w = apiKeyRequest(token, `{"query": "mutation remove { deleteChecks(ids: [\"fake-check-1\"]) { id } }"}`)
+	assert.Contains(w.Body.String(), `"code":"FORBIDDEN"`)
+
+	w = apiKeyRequest(token, `{"query": "{ apiKeys { id } }"}`)
+	assert.Contains(w.Body.String(), `"code":"FORBIDDEN"`)
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "{ apiKeys { id name } }"}`)
+	assert.Contains(w.Body.String(), `"name":"ci"`)
+	assert.NotContains(w.Body.String(), "secret")
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "mutation revoke { revokeApiKey(id: \"`+key["id"].(string)+`\") }"}`)
+	assert.Contains(w.Body.String(), `"revokeApiKey":true`)
+
+	w = apiKeyRequest(token, `{"query": "{ checks { id } }"}`)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "mutation revoke { revokeApiKey(id: \"nope\") }"}`)
+	assert.Contains(w.Body.String(), `"code":"NOT_FOUND"`)
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "mutation create { createApiKey(name: \"old\", permission: edit, expires_at: 1) { token } }"}`)
+	assert.Contains(w.Body.String(), `"code":"INVALID_ARGUMENT"`)
+}
@@ -0,0 +1,286 @@
+package composter
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/apikey"
+	"github.com/opsee/compost/audit"
+	log "github.com/opsee/logrus"
+	opsee_scalars "github.com/opsee/protobuf/plugin/graphql/scalars"
+)
+
+const (
+	defaultAuditLogPeriod = 30 * 24 * time.Hour
+	defaultAuditLogLimit  = 100
+	maxAuditLogLimit      = 1000
+)
+
+var (
+	errAuditLogLimit = errors.New("limit must be between 1 and 1000")
+	errAuditLogRange = errors.New("start must be before end")
+)
+
+// auditedMutations are the objects whose fields are audited when they're
+// resolved, other than fields that only select more of them.
+var auditedMutations = map[string]map[string]bool{
+	"Mutation":       {"region": true},
+	"RegionMutation": {},
+}
+
+var AuditEntryType *graphql.Object
+
+func initAuditTypes() {
+	if AuditEntryType != nil {
+		return
+	}
+
+	AuditEntryType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "AuditEntry",
+		Description: "A mutation, or a request an opsee admin made as one of the team",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"time": &graphql.Field{
+				Description: "unix timestamp of the entry",
+				Type:        opsee_scalars.Timestamp,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return unixOrNil(p.Source.(*audit.Entry).Time), nil
+				},
+			},
+			"actor_id": &graphql.Field{
+				Description: "The user who did it: an opsee admin's, for requests made as one of the team",
+				Type:        graphql.Int,
+			},
+			"actor_email": &graphql.Field{
+				Type: graphql.String,
+			},
+			"api_key_id": &graphql.Field{
+				Description: "The api key it was done with, if any",
+				Type:        graphql.String,
+			},
+			"user_id": &graphql.Field{
+				Description: "The user an opsee admin acted as, if any",
+				Type:        graphql.Int,
+			},
+			"action": &graphql.Field{
+				Description: "mutation or impersonate",
+				Type:        graphql.String,
+			},
+			"field": &graphql.Field{
+				Description: "The mutation, such as deleteChecks or region.rebootInstances",
+				Type:        graphql.String,
+			},
+			"arguments": &graphql.Field{
+				Description: "The mutation's arguments, with secrets redacted",
+				Type:        JsonScalar,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args := p.Source.(*audit.Entry).Arguments
+					if args == nil {
+						return nil, nil
+					}
+
+					data, err := json.Marshal(args)
+					if err != nil {
+						return nil, err
+					}
+
+					return json.RawMessage(data), nil
+				},
+			},
+			"operation": &graphql.Field{
+				Type: graphql.String,
+			},
+			"elevated": &graphql.Field{
+				Description: "Whether an opsee admin acting as one of the team could mutate",
+				Type:        graphql.Boolean,
+			},
+			"outcome": &graphql.Field{
+				Description: "success or failure",
+				Type:        graphql.String,
+			},
+			"errors": &graphql.Field{
+				Type: graphql.NewList(graphql.String),
+			},
+		},
+	})
+}
+
+func (c *Composter) queryAuditLog() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(AuditEntryType),
+		Args: graphql.FieldConfigArgument{
+			"start": &graphql.ArgumentConfig{
+				Description: "unix timestamp start time, 30 days before end by default",
+				Type:        opsee_scalars.Timestamp,
+			},
+			"end": &graphql.ArgumentConfig{
+				Description: "unix timestamp end time, now by default",
+				Type:        opsee_scalars.Timestamp,
+			},
+			"actor": &graphql.ArgumentConfig{
+				Description: "Only the entries of the user with this id",
+				Type:        graphql.Int,
+			},
+			"limit": &graphql.ArgumentConfig{
+				Description: "The most entries to return, newest first, up to 1000",
+				Type:        graphql.Int,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, err := requestorFromContext(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			q := audit.Query{
+				CustomerId: requestor.CustomerId,
+				End:        time.Now(),
+				Limit:      defaultAuditLogLimit,
+			}
+
+			if end, ok := p.Args["end"].(int); ok {
+				q.End = time.Unix(int64(end), 0)
+			}
+
+			q.Start = q.End.Add(-defaultAuditLogPeriod)
+			if start, ok := p.Args["start"].(int); ok {
+				q.Start = time.Unix(int64(start), 0)
+			}
+
+			if q.Start.After(q.End) {
+				return nil, errAuditLogRange
+			}
+
+			if actor, ok := p.Args["actor"].(int); ok {
+				q.ActorId = int32(actor)
+			}
+
+			if limit, ok := p.Args["limit"].(int); ok {
+				if limit < 1 || limit > maxAuditLogLimit {
+					return nil, errAuditLogLimit
+				}
+				q.Limit = limit
+			}
+
+			return c.audit.Query(p.Context, q)
+		},
+	}
+}
+
+// auditMutations wraps the resolvers of auditedMutations, recording every time
+// they're resolved, whether or not they succeed, or are allowed to run.
+func (c *Composter) auditMutations(schemas ...graphql.Schema) {
+	audited := make(map[*graphql.Object]bool)
+
+	for _, s := range schemas {
+		for typeName, typ := range s.TypeMap() {
+			object, ok := typ.(*graphql.Object)
+			if !ok || audited[object] {
+				continue
+			}
+
+			selectors, ok := auditedMutations[typeName]
+			if !ok {
+				continue
+			}
+
+			for name, field := range object.Fields() {
+				if selectors[name] || field.Resolve == nil {
+					continue
+				}
+
+				args := graphql.FieldConfigArgument{}
+				for _, arg := range field.Args {
+					args[arg.Name()] = &graphql.ArgumentConfig{
+						Type:         arg.Type,
+						DefaultValue: arg.DefaultValue,
+						Description:  arg.Description(),
+					}
+				}
+
+				object.AddFieldConfig(name, &graphql.Field{
+					Name:              field.Name,
+					Description:       field.Description,
+					Type:              field.Type,
+					Args:              args,
+					Resolve:           c.auditedResolve(field.Resolve),
+					DeprecationReason: field.DeprecationReason,
+				})
+			}
+
+			audited[object] = true
+		}
+	}
+}
+
+func (c *Composter) auditedResolve(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		result, err := resolve(p)
+		c.recordMutation(p, err)
+		return result, err
+	}
+}
+
+// recordMutation records a mutation field resolved. The mutation has already
+// happened, so failing to record it is only logged.
+func (c *Composter) recordMutation(p graphql.ResolveParams, resolveErr error) {
+	user, ok := p.Context.Value(userKey).(*schema.User)
+	if !ok || user == nil {
+		return
+	}
+
+	entry := audit.NewEntry()
+	entry.ActorCustomerId = user.CustomerId
+	entry.ActorId = user.Id
+	entry.ActorEmail = user.Email
+	entry.CustomerId = user.CustomerId
+	entry.Action = audit.ActionMutation
+	entry.Field = p.Info.FieldName
+	entry.Arguments = redactVariables(p.Args, nil)
+	entry.Outcome = audit.OutcomeSuccess
+
+	if imp := impersonationFromContext(p.Context); imp != nil {
+		entry.ActorCustomerId = imp.admin.CustomerId
+		entry.ActorId = imp.admin.Id
+		entry.ActorEmail = imp.admin.Email
+		entry.UserId = user.Id
+		entry.Elevated = imp.actAs.Elevated
+	}
+
+	if key, ok := p.Context.Value(apiKeyKey).(*apikey.Key); ok {
+		entry.ApiKeyId = key.Id
+	}
+
+	if p.Info.ParentType != nil && p.Info.ParentType.Name() == "RegionMutation" {
+		entry.Field = "region." + entry.Field
+		if queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext); ok {
+			if entry.Arguments == nil {
+				entry.Arguments = make(map[string]interface{})
+			}
+			entry.Arguments["region"] = queryContext.Region
+		}
+	}
+
+	if operation, ok := p.Info.Operation.(*ast.OperationDefinition); ok && operation.Name != nil {
+		entry.Operation = operation.Name.Value
+	}
+
+	if resolveErr != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Errors = []string{resolveErr.Error()}
+	}
+
+	if err := c.audit.Record(p.Context, entry); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"customer_id": entry.CustomerId,
+			"user_id":     entry.ActorId,
+			"field":       entry.Field,
+		}).Error("error recording mutation in the audit log")
+	}
+}
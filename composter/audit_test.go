@@ -0,0 +1,72 @@
+package composter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opsee/compost/audit"
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := fake.NewClient(fake.DefaultFixtures())
+	c, err := New(client, Config{
+		Audit: audit.Config{Sink: audit.SinkFile, File: filepath.Join(dir, "audit.json")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditLog := func(query string) []map[string]interface{} {
+		var result struct {
+			Data struct {
+				AuditLog []map[string]interface{}
+			}
+		}
+		if err := json.Unmarshal([]byte(testUserRequest(t, c, 1, `{"admin": true}`, `{"query": "`+query+`"}`)), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result.Data.AuditLog
+	}
+
+	testUserRequest(t, c, 1, `{"admin": true}`, `{"query": "mutation remove { deleteChecks(ids: [\"fake-check-1\"]) { id } }"}`)
+	testUserRequest(t, c, 1, `{"admin": true}`, `{"query": "mutation password { user(user: {id: 1, status: active}, password: \"hunter2\") { id } }"}`)
+	testUserRequest(t, c, 2, `{"edit": true}`, `{"query": "mutation reboot { region(id: \"us-west-2\") { rebootInstances(ids: [\"i-fa7e0001\"]) } }"}`)
+
+	assert.Empty(client.EC2.(*fake.EC2).Actions())
+
+	entries := auditLog(`{ auditLog { actor_id field arguments outcome operation } }`)
+	if assert.Len(entries, 3) {
+		// newest first, and denied mutations are recorded too
+		assert.Equal("region.rebootInstances", entries[0]["field"])
+		assert.Equal(audit.OutcomeFailure, entries[0]["outcome"])
+		assert.Equal(map[string]interface{}{"region": "us-west-2", "ids": []interface{}{"i-fa7e0001"}}, entries[0]["arguments"])
+
+		assert.Equal("user", entries[1]["field"])
+		assert.Equal("[redacted]", entries[1]["arguments"].(map[string]interface{})["password"])
+		assert.Equal("password", entries[1]["operation"])
+
+		assert.Equal("deleteChecks", entries[2]["field"])
+		assert.Equal(audit.OutcomeSuccess, entries[2]["outcome"])
+	}
+
+	assert.Len(auditLog(`{ auditLog(actor: 2) { field } }`), 1)
+	assert.Len(auditLog(`{ auditLog(limit: 2) { field } }`), 2)
+	assert.Len(auditLog(`{ auditLog(end: 1000) { field } }`), 0)
+
+	// only team admins see the audit log
+	assert.Contains(testUserRequest(t, c, 2, `{"edit": true}`, `{"query": "{ auditLog { field } }"}`), `"code":"FORBIDDEN"`)
+	assert.Contains(testUserRequest(t, c, 1, `{"admin": true}`, `{"query": "{ auditLog(limit: 5000) { field } }"}`), `"code":"INVALID_ARGUMENT"`)
+}
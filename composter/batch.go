@@ -0,0 +1,209 @@
+package composter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/julienschmidt/httprouter"
+	"github.com/opsee/basic/tp"
+	"github.com/opsee/compost/resolver"
+	"golang.org/x/net/context"
+)
+
+const (
+	maxBatchSize = 20
+
+	// batchConcurrency is how many requests in a batch run at once
+	batchConcurrency = 4
+)
+
+var (
+	errEmptyBatch    = errors.New("batch contains no requests")
+	errBatchTooLarge = fmt.Errorf("batch contains more than %d requests", maxBatchSize)
+)
+
+// GraphQLBatch is a json array of requests, which are run for the same user and
+// answered with an array of results in the same order. Queries run
+// concurrently, and mutations in order.
+type GraphQLBatch []*GraphQLRequest
+
+func (batch GraphQLBatch) Validate() error {
+	if len(batch) == 0 {
+		return errEmptyBatch
+	}
+
+	if len(batch) > maxBatchSize {
+		return errBatchTooLarge
+	}
+
+	for i, request := range batch {
+		if request == nil {
+			return fmt.Errorf("request %d: %s", i, errNoQuery)
+		}
+
+		if err := request.Validate(); err != nil {
+			return fmt.Errorf("request %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+// graphQLRequestDecodeFunc decodes either a single GraphQLRequest or a
+// GraphQLBatch from the request body into the context. GET requests are
+// decoded from the url's query string, and may only run queries. Malformed
+// bodies aren't echoed back, since they can hold secrets.
+func graphQLRequestDecodeFunc() tp.DecodeFunc {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request, p httprouter.Params) (context.Context, int, error) {
+		if r.Method == "GET" {
+			request, err := graphQLRequestFromQuery(r.URL.Query())
+			if err != nil {
+				return ctx, http.StatusBadRequest, err
+			}
+
+			return context.WithValue(ctx, requestKey, request), 0, nil
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return ctx, http.StatusBadRequest, err
+		}
+
+		if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+			request := &GraphQLRequest{}
+			if err := json.Unmarshal(body, request); err != nil {
+				return ctx, http.StatusBadRequest, fmt.Errorf("Malformed request body: %s", err)
+			}
+
+			if err := request.Validate(); err != nil {
+				return ctx, http.StatusBadRequest, err
+			}
+
+			return context.WithValue(ctx, requestKey, request), 0, nil
+		}
+
+		batch := GraphQLBatch{}
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("Malformed request body: %s", err)
+		}
+
+		if err := batch.Validate(); err != nil {
+			return ctx, http.StatusBadRequest, err
+		}
+
+		return context.WithValue(ctx, requestKey, batch), 0, nil
+	}
+}
+
+// CompostBatch runs each request of a batch in the context against schema.
+// Queries run concurrently, sharing a loader, so backend calls they have in
+// common are only made once. Mutations run in order: each waits for the
+// requests before it, and the requests after it wait for it and load
+// everything again.
+func (c *Composter) CompostBatch(ctx context.Context, schema graphql.Schema) ([]*Result, error) {
+	batch, ok := ctx.Value(requestKey).(GraphQLBatch)
+	if !ok {
+		return nil, errDecodeRequest
+	}
+
+	var (
+		results   = make([]*Result, len(batch))
+		sem       = make(chan struct{}, batchConcurrency)
+		loaderCtx = resolver.WithLoader(ctx)
+		wg        sync.WaitGroup
+	)
+
+	for i, request := range batch {
+		if c.mutates(request) {
+			wg.Wait()
+			results[i] = c.compost(loaderCtx, schema, request)
+			loaderCtx = resolver.WithLoader(ctx)
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(ctx context.Context, i int, request *GraphQLRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i] = c.compost(ctx, schema, request)
+		}(loaderCtx, i, request)
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
+
+// mutates is whether request runs a mutation. Requests that can't be parsed
+// are run like queries, and fail the same way.
+func (c *Composter) mutates(request *GraphQLRequest) bool {
+	query, err := c.persistedQueries.resolve(request)
+	if err != nil {
+		return false
+	}
+
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: query,
+			Name: "GraphQL request",
+		}),
+	})
+	if err != nil {
+		return false
+	}
+
+	operation, err := operationDefinition(document, request.OperationName)
+	return err == nil && operation.Operation != "query"
+}
+
+// compostRequest runs the single request or batch in the context.
+func (c *Composter) compostRequest(ctx context.Context, schema graphql.Schema) (interface{}, error) {
+	if _, ok := ctx.Value(requestKey).(GraphQLBatch); ok {
+		return c.CompostBatch(ctx, schema)
+	}
+
+	return c.Compost(ctx, schema)
+}
+
+// graphQLRequestFromQuery decodes a request from url parameters, where
+// variables and extensions are json.
+func graphQLRequestFromQuery(values url.Values) (*GraphQLRequest, error) {
+	request := &GraphQLRequest{
+		Query:         values.Get("query"),
+		OperationName: values.Get("operationName"),
+		Id:            values.Get("id"),
+		readOnly:      true,
+	}
+
+	if variables := values.Get("variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+			return nil, fmt.Errorf("Malformed variables: %s", err)
+		}
+	}
+
+	if extensions := values.Get("extensions"); extensions != "" {
+		if err := json.Unmarshal([]byte(extensions), &request.Extensions); err != nil {
+			return nil, fmt.Errorf("Malformed extensions: %s", err)
+		}
+	}
+
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
@@ -0,0 +1,139 @@
+package composter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := testGraphQLRequest(t, c, "POST", "/graphql", `[
+		{"query": "{ checks { id } }"},
+		{"query": "query check($id: String) { checks(id: $id) { name } }", "variables": {"id": "fake-check-2"}},
+		{"query": "{ nope }"}
+	]`)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var results []*graphql.Result
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(results, 3) {
+		assert.Empty(results[0].Errors)
+		assert.Len(results[0].Data.(map[string]interface{})["checks"], 2)
+
+		assert.Empty(results[1].Errors)
+		assert.Equal([]interface{}{map[string]interface{}{"name": "api instance"}}, results[1].Data.(map[string]interface{})["checks"])
+
+		assert.Len(results[2].Errors, 1)
+	}
+
+	// mutations run in order, and what's after them sees what they changed
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `[
+		{"query": "{ checks { id } }"},
+		{"query": "mutation remove { deleteChecks(ids: [\"fake-check-1\"]) { id deleted } }"},
+		{"query": "{ checks { id } }"}
+	]`)
+	assert.Equal(http.StatusOK, w.Code)
+
+	results = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(results, 3) {
+		assert.Len(results[0].Data.(map[string]interface{})["checks"], 2)
+		assert.Empty(results[1].Errors)
+		assert.Equal([]interface{}{map[string]interface{}{"id": "fake-check-2"}}, results[2].Data.(map[string]interface{})["checks"])
+	}
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "{ checks { id } }"}`)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"data"`)
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `[]`)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `[{"query": "{ checks { id } }"}, {}]`)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// malformed bodies aren't echoed
+	for _, body := range []string{`{"query": "{ checks { id } }", "secret": "hunter2"`, `[{"query": "{ checks { id } }", "secret": "hunter2"}`} {
+		w = testGraphQLRequest(t, c, "POST", "/graphql", body)
+		assert.Equal(http.StatusBadRequest, w.Code)
+		assert.Contains(w.Body.String(), "Malformed request body")
+		assert.NotContains(w.Body.String(), "hunter2")
+	}
+}
+
+func testGraphQLRequest(t *testing.T, c *Composter, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, newTestGraphQLRequest(t, method, path, body))
+
+	return w
+}
+
+// newTestGraphQLRequest is a request from the fake admin user.
+func newTestGraphQLRequest(t *testing.T, method, path, body string) *http.Request {
+	req, err := http.NewRequest(method, "http://compost"+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := `{"id": 1, "customer_id": "` + fake.CustomerId + `", "email": "fake@opsee.com", "active": true, "status": "active", "perms": {"admin": true, "edit": true}}`
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user)))
+	req.Header.Set("Content-Type", "application/json")
+
+	return req
+}
+
+func TestGraphQLGet(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query ids { checks { id } } query names($id: String) { checks(id: $id) { name } } mutation remove { deleteChecks(ids: ["fake-check-1"]) { id deleted } }`
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("operationName", "names")
+	params.Set("variables", `{"id": "fake-check-2"}`)
+
+	w := testGraphQLRequest(t, c, "GET", "/graphql?"+params.Encode(), "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"data": {"checks": [{"name": "api instance"}]}}`, w.Body.String())
+
+	// mutations have to be POSTed
+	params.Set("operationName", "remove")
+	w = testGraphQLRequest(t, c, "GET", "/graphql?"+params.Encode(), "")
+	assert.Contains(w.Body.String(), errReadOnly.Error())
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": `+strconv.Quote(query)+`}`)
+	assert.Contains(w.Body.String(), errOperationNameRequired.Error())
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": `+strconv.Quote(query)+`, "operationName": "remove"}`)
+	assert.JSONEq(`{"data": {"deleteChecks": [{"id": "fake-check-1", "deleted": true}]}}`, w.Body.String())
+
+	w = testGraphQLRequest(t, c, "GET", "/graphql?variables=nope", "")
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,92 @@
+package composter
+
+import (
+	"fmt"
+
+	"github.com/opsee/basic/schema"
+	opsee_types "github.com/opsee/protobuf/opseeproto/types"
+	"golang.org/x/net/context"
+)
+
+// team capabilities, from the team permissions bitmap in schema
+const (
+	teamPermissions = "team"
+
+	capabilityMultiUser     = "multi_user"
+	capabilityMultiBastion  = "multi_bastion"
+	capabilityOnSiteSupport = "on_site_support"
+)
+
+// defaultTeamCapabilities let every plan's teams (free, beta,
+// developer_monthly and team_monthly) keep inviting users and launching
+// bastions, until team_capabilities says which plans can't.
+var defaultTeamCapabilities = map[string][]string{
+	defaultPlan: {capabilityMultiUser, capabilityMultiBastion},
+}
+
+// teamCapabilities are the capabilities of each plan's teams.
+type teamCapabilities map[string]*opsee_types.Permission
+
+func newTeamCapabilities(plans map[string][]string) (teamCapabilities, error) {
+	if len(plans) == 0 {
+		plans = defaultTeamCapabilities
+	}
+
+	if _, ok := plans[defaultPlan]; !ok {
+		return nil, fmt.Errorf("team capabilities must include a %s plan", defaultPlan)
+	}
+
+	capabilities := make(teamCapabilities)
+	for plan, names := range plans {
+		perms, err := opsee_types.NewPermissions(teamPermissions, names...)
+		if err != nil {
+			return nil, fmt.Errorf("team capabilities for plan %s: %s", plan, err)
+		}
+
+		capabilities[plan] = perms
+	}
+
+	return capabilities, nil
+}
+
+// plan returns the capabilities of a plan's teams.
+func (t teamCapabilities) plan(plan string) *opsee_types.Permission {
+	if perms, ok := t[plan]; ok {
+		return perms
+	}
+
+	return t[defaultPlan]
+}
+
+// requireCapability returns a FORBIDDEN error naming the capability if the
+// user's team doesn't have it. The team is loaded from cats once per request.
+func (c *Composter) requireCapability(ctx context.Context, user *schema.User, capability string) error {
+	team, err := c.resolver.GetTeam(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	perms := c.teamCapabilities.plan(team.SubscriptionPlan)
+	if !perms.HasPermissions(capability)[capability] {
+		return forbidden(fmt.Errorf("your team's plan doesn't include the %s capability", capability))
+	}
+
+	return nil
+}
+
+// requireBastionCapacity lets every team launch its first bastion, and only
+// teams with multi_bastion launch more.
+func (c *Composter) requireBastionCapacity(ctx context.Context, user *schema.User) error {
+	states, err := c.resolver.ListBastionStates(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	for _, state := range states {
+		if state.Status != "inactive" {
+			return c.requireCapability(ctx, user, capabilityMultiBastion)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package composter
+
+import (
+	"testing"
+
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	admin := `{"admin": true}`
+	invite := `{"query": "mutation invite { user(user: {id: 0, status: invited, email: \"new@opsee.com\", perms: {edit: true}}) { email } }"}`
+	launch := `{"query": "mutation launch { region(id: \"us-west-2\") { launchStack(vpc_id: \"vpc-fa7e0001\", subnet_id: \"subnet-1\", subnet_routing: \"public\") } }"}`
+
+	// every plan has multi_user and multi_bastion by default
+	for _, plan := range []string{"free", "beta", "developer_monthly", "team_monthly"} {
+		fixtures := fake.DefaultFixtures()
+		fixtures.Teams[0].SubscriptionPlan = plan
+		c, err := New(fake.NewClient(fixtures), Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Contains(testUserRequest(t, c, 1, admin, invite), `"email":"new@opsee.com"`, plan)
+		assert.Contains(testUserRequest(t, c, 1, admin, launch), `"launchStack":true`, plan)
+	}
+
+	// plans configured without them can't, but can launch their first bastion
+	config := Config{TeamCapabilities: map[string][]string{
+		defaultPlan:    {},
+		"team_monthly": {capabilityMultiUser, capabilityMultiBastion},
+	}}
+
+	fixtures := fake.DefaultFixtures()
+	fixtures.Teams[0].SubscriptionPlan = "team_monthly"
+	c, err := New(fake.NewClient(fixtures), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(testUserRequest(t, c, 1, admin, invite), `"email":"new@opsee.com"`)
+
+	fixtures = fake.DefaultFixtures()
+	fixtures.Teams[0].SubscriptionPlan = "free"
+	c, err = New(fake.NewClient(fixtures), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := testUserRequest(t, c, 1, admin, invite)
+	assert.Contains(body, `"code":"FORBIDDEN"`)
+	assert.Contains(body, "multi_user")
+
+	body = testUserRequest(t, c, 1, admin, launch)
+	assert.Contains(body, `"code":"FORBIDDEN"`)
+	assert.Contains(body, "multi_bastion")
+
+	fixtures = fake.DefaultFixtures()
+	fixtures.Teams[0].SubscriptionPlan = "free"
+	fixtures.Bastions = nil
+	c, err = New(fake.NewClient(fixtures), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(testUserRequest(t, c, 1, admin, launch), `"launchStack":true`)
+	assert.Contains(testUserRequest(t, c, 1, admin, launch), "multi_bastion")
+}
+
+func TestTeamCapabilitiesConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newTeamCapabilities(map[string][]string{"free": {}})
+	assert.Error(err)
+
+	_, err = newTeamCapabilities(map[string][]string{defaultPlan: {"unlimited_everything"}})
+	assert.Error(err)
+
+	capabilities, err := newTeamCapabilities(map[string][]string{defaultPlan: {}, "enterprise": {capabilityOnSiteSupport}})
+	assert.NoError(err)
+	assert.True(capabilities.plan("enterprise").HasPermissions(capabilityOnSiteSupport)[capabilityOnSiteSupport])
+	assert.False(capabilities.plan("free").HasPermissions(capabilityMultiUser)[capabilityMultiUser])
+}
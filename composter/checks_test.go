@@ -0,0 +1,108 @@
+package composter
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/opsee/compost/fake"
+	"github.com/opsee/compost/resolver"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// testChecksInput creates a check, fails to update one that doesn't exist, and
+// creates another.
+const testChecksInput = `[
+	{"name": "first", "target": {"type": "sg", "id": "sg-1"}, "assertions": [], "notifications": []},
+	{"id": "nope", "name": "missing", "target": {"type": "sg", "id": "sg-1"}, "assertions": [], "notifications": []},
+	{"name": "last", "target": {"type": "sg", "id": "sg-1"}, "assertions": [], "notifications": []}
+]`
+
+func TestUpsertChecksPartial(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := testGraphQLRequest(t, c, "POST", "/graphql", `{"query": `+strconv.Quote(`mutation upsert($checks: [Check]) {
+		checks(checks: $checks) {
+			check { name }
+			error { code backend }
+		}
+	}`)+`, "variables": {"checks": `+testChecksInput+`}}`)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"data": {"checks": [
+		{"check": {"name": "first"}, "error": null},
+		{"check": null, "error": {"code": "NOT_FOUND", "backend": "bartnet"}},
+		{"check": {"name": "last"}, "error": null}
+	]}}`, w.Body.String())
+
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "mutation remove { deleteChecks(ids: [\"fake-check-1\", \"nope\"]) { id deleted error { code } } }"}`)
+	assert.JSONEq(`{"data": {"deleteChecks": [
+		{"id": "fake-check-1", "deleted": true, "error": null},
+		{"id": "nope", "deleted": false, "error": {"code": "NOT_FOUND"}}
+	]}}`, w.Body.String())
+}
+
+func TestUpsertChecksAtomic(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := testGraphQLRequest(t, c, "POST", "/graphql", `{"query": `+strconv.Quote(`mutation upsert($checks: [Check]) {
+		checks(atomic: true, checks: $checks) {
+			check { name }
+			error { code }
+		}
+	}`)+`, "variables": {"checks": `+testChecksInput+`}}`)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"data": {"checks": [
+		{"check": null, "error": {"code": "ABORTED"}},
+		{"check": null, "error": {"code": "NOT_FOUND"}},
+		{"check": null, "error": {"code": "ABORTED"}}
+	]}}`, w.Body.String())
+
+	// the first check was rolled back
+	w = testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "{ checks { name } }"}`)
+	assert.NotContains(w.Body.String(), "first")
+}
+
+func TestCheckMutationsClearLoader(t *testing.T) {
+	assert := assert.New(t)
+
+	client := fake.NewClient(fake.DefaultFixtures())
+	user := fake.DefaultFixtures().Users[0]
+	ctx := resolver.WithLoader(context.Background())
+
+	checks, err := client.ListChecks(ctx, user, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(checks, 2)
+
+	// listing again in the request hands out copies of what's loaded
+	again, err := client.ListChecks(ctx, user, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(checks[0] == again[0])
+
+	_, err = client.DeleteChecks(ctx, user, []interface{}{"fake-check-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err = client.ListChecks(ctx, user, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(checks, 1) {
+		assert.Equal("fake-check-2", checks[0].Id)
+	}
+}
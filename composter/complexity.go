@@ -0,0 +1,210 @@
+package composter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	defaultMaxQueryDepth = 10
+	defaultMaxQueryCost  = 1000
+
+	// assumedListSize is how many items a list field is expected to return,
+	// since we can't know before running the query.
+	assumedListSize = 10
+
+	// costs saturate here so huge fan outs can't overflow
+	maxComplexityCost = 1 << 30
+)
+
+// fieldCosts are the costs of fields that are more expensive than usual, keyed
+// by "Type.field". "Type.*" sets the cost of every field on a type. Otherwise,
+// fields returning objects or lists cost 1, and scalar fields are free.
+var fieldCosts = map[string]int{
+	// one cloudwatch call each
+	"Metrics.*": 10,
+
+	// bezos calls
+	"VPC.groups":    5,
+	"VPC.instances": 5,
+
+	// marktricks calls
+	"schemaCheck.metrics": 5,
+}
+
+// queryComplexity is the depth and cost of an operation.
+type queryComplexity struct {
+	depth int
+	cost  int
+}
+
+type complexityAnalysis struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+}
+
+// analyzeComplexity returns the depth and cost of the operation named
+// operationName in document, or of the most complex operation if there's no
+// name. The document must already be valid for the schema.
+func analyzeComplexity(schema *graphql.Schema, document *ast.Document, operationName string) queryComplexity {
+	analysis := &complexityAnalysis{
+		schema:    schema,
+		fragments: make(map[string]*ast.FragmentDefinition),
+	}
+
+	var operations []*ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch def := definition.(type) {
+		case *ast.FragmentDefinition:
+			analysis.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operations = append(operations, def)
+			}
+		}
+	}
+
+	result := queryComplexity{}
+	for _, operation := range operations {
+		var root *graphql.Object
+		switch operation.Operation {
+		case "mutation":
+			root = schema.MutationType()
+		default:
+			root = schema.QueryType()
+		}
+
+		if root == nil {
+			continue
+		}
+
+		c := queryComplexity{}
+		analysis.selectionSet(&c, operation.SelectionSet, root, 0, 1, make(map[string]bool))
+
+		if c.depth > result.depth {
+			result.depth = c.depth
+		}
+		if c.cost > result.cost {
+			result.cost = c.cost
+		}
+	}
+
+	return result
+}
+
+func (a *complexityAnalysis) selectionSet(c *queryComplexity, set *ast.SelectionSet, parent graphql.Type, depth, multiplier int, spread map[string]bool) {
+	if set == nil {
+		return
+	}
+
+	for _, selection := range set.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			a.field(c, sel, parent, depth, multiplier, spread)
+
+		case *ast.InlineFragment:
+			typ := parent
+			if sel.TypeCondition != nil {
+				typ = a.schema.Type(sel.TypeCondition.Name.Value)
+			}
+			a.selectionSet(c, sel.SelectionSet, typ, depth, multiplier, spread)
+
+		case *ast.FragmentSpread:
+			name := sel.Name.Value
+			fragment, ok := a.fragments[name]
+			if !ok || spread[name] {
+				continue
+			}
+
+			spread[name] = true
+			a.selectionSet(c, fragment.SelectionSet, a.schema.Type(fragment.TypeCondition.Name.Value), depth, multiplier, spread)
+			delete(spread, name)
+		}
+	}
+}
+
+func (a *complexityAnalysis) field(c *queryComplexity, field *ast.Field, parent graphql.Type, depth, multiplier int, spread map[string]bool) {
+	name := field.Name.Value
+
+	// introspection doesn't touch any backends
+	if strings.HasPrefix(name, "__") {
+		return
+	}
+
+	var fields graphql.FieldDefinitionMap
+	switch typ := parent.(type) {
+	case *graphql.Object:
+		fields = typ.Fields()
+	case *graphql.Interface:
+		fields = typ.Fields()
+	}
+
+	definition, ok := fields[name]
+	if !ok {
+		return
+	}
+
+	depth++
+	if depth > c.depth {
+		c.depth = depth
+	}
+
+	typeName := parent.Name()
+	cost, ok := fieldCosts[typeName+"."+name]
+	if !ok {
+		cost, ok = fieldCosts[typeName+".*"]
+	}
+	if !ok && field.SelectionSet != nil {
+		cost = 1
+	}
+
+	c.cost = saturatingAdd(c.cost, saturatingMul(cost, multiplier))
+
+	if field.SelectionSet == nil {
+		return
+	}
+
+	fieldType := definition.Type
+	if nonNull, ok := fieldType.(*graphql.NonNull); ok {
+		fieldType = nonNull.OfType
+	}
+	if _, ok := fieldType.(*graphql.List); ok {
+		multiplier = saturatingMul(multiplier, assumedListSize)
+	}
+
+	named, _ := graphql.GetNamed(definition.Type).(graphql.Type)
+	a.selectionSet(c, field.SelectionSet, named, depth, multiplier, spread)
+}
+
+// checkComplexity returns an error if the operation is deeper or more costly
+// than the limits allow.
+func (c *Composter) checkComplexity(schema *graphql.Schema, document *ast.Document, operationName string) error {
+	complexity := analyzeComplexity(schema, document, operationName)
+
+	if complexity.depth > c.maxQueryDepth {
+		return fmt.Errorf("query depth %d exceeds the maximum of %d", complexity.depth, c.maxQueryDepth)
+	}
+
+	if complexity.cost > c.maxQueryCost {
+		return fmt.Errorf("query cost %d exceeds the maximum of %d", complexity.cost, c.maxQueryCost)
+	}
+
+	return nil
+}
+
+func saturatingAdd(a, b int) int {
+	if a+b > maxComplexityCost {
+		return maxComplexityCost
+	}
+	return a + b
+}
+
+func saturatingMul(a, b int) int {
+	if a != 0 && b > maxComplexityCost/a {
+		return maxComplexityCost
+	}
+	return a * b
+}
@@ -0,0 +1,71 @@
+package composter
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestComplexity(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{MaxQueryCost: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), userKey, &schema.User{Id: 1, CustomerId: fake.CustomerId, Email: "fake@opsee.com"})
+	ctx = context.WithValue(ctx, queryContextKey, &QueryContext{})
+
+	result := c.execute(ctx, c.Schema, `{ checks { id name } }`, &GraphQLRequest{})
+	assert.Empty(result.Errors)
+
+	metrics := `query metrics {
+		region(id: "us-west-2") {
+			vpc(id: "vpc-1") {
+				instances(type: "ec2") {
+					...instance
+				}
+			}
+		}
+	}
+
+	fragment instance on ec2Instance {
+		metrics {
+			CPUUtilization { metrics { value } }
+			NetworkIn { metrics { value } }
+		}
+	}`
+
+	complexity := analyzeComplexity(&c.Schema, mustParse(t, metrics), "")
+	assert.Equal(7, complexity.depth)
+	// region, vpc and instances, then metrics and two cloudwatch calls (each
+	// with a list of datapoints) for each of the assumed 10 instances
+	assert.Equal(1+1+5+10*(1+2*(10+1)), complexity.cost)
+
+	result = c.execute(ctx, c.Schema, metrics, &GraphQLRequest{})
+	if assert.Len(result.Errors, 1) {
+		assert.Equal("query cost 237 exceeds the maximum of 100", result.Errors[0].Message)
+	}
+
+	c.maxQueryCost = defaultMaxQueryCost
+	c.maxQueryDepth = 6
+	result = c.execute(ctx, c.Schema, metrics, &GraphQLRequest{})
+	if assert.Len(result.Errors, 1) {
+		assert.Equal("query depth 7 exceeds the maximum of 6", result.Errors[0].Message)
+	}
+}
+
+func mustParse(t *testing.T, query string) *ast.Document {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return document
+}
@@ -4,9 +4,23 @@ package composter
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
 	"github.com/opsee/basic/tp"
+	"github.com/opsee/compost/apikey"
+	"github.com/opsee/compost/audit"
 	"github.com/opsee/compost/resolver"
+	"github.com/opsee/compost/scope"
+	"github.com/opsee/compost/session"
+	"github.com/opsee/compost/tracing"
 	"golang.org/x/net/context"
 )
 
@@ -14,51 +28,350 @@ const (
 	userKey = iota
 	requestKey
 	queryContextKey
+	subscriptionKey
+	resolverErrorsKey
+	accessLogKey
+	introspectionDisabledKey
+	apiKeyKey
+	sessionKey
+	actAsAllowedKey
+	impersonationKey
 )
 
 var (
 	errDecodeRequest = errors.New("error decoding request from context")
 	errNoQuery       = errors.New("query not provided")
+
+	errOperationNameRequired = errors.New("must provide operation name if query contains multiple operations")
+	errUnknownOperation      = errors.New("unknown operation")
+	errReadOnly              = errors.New("only queries can be sent with GET, use POST for mutations")
+	errIntrospectionDisabled = errors.New("introspection is disabled")
 )
 
+// Config is the graphql server's configuration.
+type Config struct {
+	// PersistedQueriesFile is a json object of id to query, for clients that
+	// send a query id or hash instead of the query.
+	PersistedQueriesFile string `json:"persisted_queries_file"`
+
+	// StrictPersistedQueries rejects queries that aren't in the persisted
+	// queries file.
+	StrictPersistedQueries bool `json:"strict_persisted_queries"`
+
+	// MaxQueryDepth and MaxQueryCost limit how deep and how costly a query can
+	// be before it's rejected. Zero uses the defaults.
+	MaxQueryDepth int `json:"max_query_depth"`
+	MaxQueryCost  int `json:"max_query_cost"`
+
+	// RateLimits are the rate limits for each subscription plan, and for
+	// "default", which applies to plans without their own.
+	RateLimits map[string]*RateLimit `json:"rate_limits,omitempty"`
+
+	// TeamCapabilities are the team capabilities (multi_user, multi_bastion,
+	// on_site_support) of each subscription plan, and of "default", which
+	// applies to plans without their own.
+	TeamCapabilities map[string][]string `json:"team_capabilities,omitempty"`
+
+	// CORS are the cross origin policies for /graphql and /admin/graphql.
+	CORS CORSConfig `json:"cors"`
+
+	// DisableIntrospection rejects __schema and __type queries to /graphql,
+	// except from opsee admins. /admin/graphql always allows them.
+	DisableIntrospection bool `json:"disable_introspection"`
+
+	// ApiKeys is where api keys for machine clients are stored.
+	ApiKeys apikey.Config `json:"api_keys"`
+
+	// Sessions is where the sessions of vape tokens, and their revocations,
+	// are stored.
+	Sessions session.Config `json:"sessions"`
+
+	// Audit is where audited actions, such as requests made with actAs, are
+	// recorded.
+	Audit audit.Config `json:"audit"`
+
+	// Scopes is where the regions and VPCs that users are restricted to are
+	// stored.
+	Scopes scope.Config `json:"scopes"`
+}
+
 type Composter struct {
-	Schema      graphql.Schema
-	AdminSchema graphql.Schema
-	resolver    *resolver.Client
-	router      *tp.Router
+	Schema               graphql.Schema
+	AdminSchema          graphql.Schema
+	SubscriptionSchema   graphql.Schema
+	resolver             *resolver.Client
+	router               *tp.Router
+	server               *http.Server
+	shuttingDown         chan struct{}
+	shutdownOnce         sync.Once
+	checkStates          *checkStateWatcher
+	persistedQueries     *persistedQueries
+	operationLabels      operationLabels
+	rateLimiter          *rateLimiter
+	teamCapabilities     teamCapabilities
+	maxQueryDepth        int
+	maxQueryCost         int
+	disableIntrospection bool
+	apiKeys              apikey.Store
+	sessions             *sessionTracker
+	audit                audit.Sink
+	scopes               scope.Store
 }
 
-func New(resolver *resolver.Client) *Composter {
+func New(resolver *resolver.Client, config Config) (*Composter, error) {
+	persistedQueries, err := loadPersistedQueries(config.PersistedQueriesFile, config.StrictPersistedQueries)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimiter, err := newRateLimiter(config.RateLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	teamCapabilities, err := newTeamCapabilities(config.TeamCapabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := config.ApiKeys.NewStore()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := config.Sessions.NewStore(resolver.EtcdKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var dynamo audit.DynamoAPI
+	if resolver.Dynamo != nil {
+		dynamo = resolver.Dynamo
+	}
+
+	auditSink, err := config.Audit.NewSink(dynamo)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := config.Scopes.NewStore(resolver.EtcdKeys)
+	if err != nil {
+		return nil, err
+	}
+
 	composter := &Composter{
-		resolver: resolver,
+		resolver:             resolver,
+		checkStates:          newCheckStateWatcher(resolver, defaultCheckStatePollInterval),
+		persistedQueries:     persistedQueries,
+		rateLimiter:          rateLimiter,
+		teamCapabilities:     teamCapabilities,
+		shuttingDown:         make(chan struct{}),
+		maxQueryDepth:        defaultMaxQueryDepth,
+		maxQueryCost:         defaultMaxQueryCost,
+		disableIntrospection: config.DisableIntrospection,
+		apiKeys:              apiKeys,
+		sessions:             newSessionTracker(sessions),
+		audit:                auditSink,
+		scopes:               scopes,
+	}
+
+	if config.MaxQueryDepth > 0 {
+		composter.maxQueryDepth = config.MaxQueryDepth
+	}
+
+	if config.MaxQueryCost > 0 {
+		composter.maxQueryCost = config.MaxQueryCost
 	}
 
 	composter.mustSchema()
-	composter.initHTTP()
-	return composter
+	composter.operationLabels = newOperationLabels(persistedQueries, &composter.Schema, &composter.AdminSchema)
+
+	if err := composter.initHTTP(config.CORS); err != nil {
+		return nil, err
+	}
+
+	return composter, nil
 }
 
-func (c *Composter) Compost(ctx context.Context, schema graphql.Schema) (*graphql.Result, error) {
+func (c *Composter) Compost(ctx context.Context, schema graphql.Schema) (*Result, error) {
 	request, ok := ctx.Value(requestKey).(*GraphQLRequest)
 	if !ok {
 		return nil, errDecodeRequest
 	}
 
+	return c.compost(resolver.WithLoader(ctx), schema, request), nil
+}
+
+func (c *Composter) compost(ctx context.Context, schema graphql.Schema, request *GraphQLRequest) *Result {
+	query, err := c.persistedQueries.resolve(request)
+	if err != nil {
+		result := &Result{Errors: []*Error{newError(err)}}
+		recordAccess(ctx, request, request.persistedQueryId(), nil, nil, result)
+		return result
+	}
+
 	ctx = context.WithValue(ctx, queryContextKey, &QueryContext{})
 
-	response := graphql.Do(graphql.Params{
-		Schema:         schema,
-		RequestString:  request.Query,
-		VariableValues: request.Variables,
-		Context:        ctx,
+	if actAs := request.actAs(); actAs != nil {
+		ctx, err = c.impersonate(ctx, actAs)
+		if err != nil {
+			result := &Result{Errors: []*Error{newError(err)}}
+			if imp := impersonationFromContext(ctx); imp != nil {
+				if err := c.auditImpersonation(ctx, imp, request.OperationName, nil, nil, result); err != nil {
+					result = &Result{Errors: []*Error{newError(err)}}
+				}
+			}
+			recordAccess(ctx, request, query, nil, nil, result)
+			return result
+		}
+	}
+
+	return c.execute(ctx, schema, query, request)
+}
+
+// execute runs a query like graphql.Do, but checks the query's complexity
+// before running any resolvers, and codes its errors.
+func (c *Composter) execute(ctx context.Context, schema graphql.Schema, query string, request *GraphQLRequest) (result *Result) {
+	var (
+		operationName = request.OperationName
+		document      *ast.Document
+		operation     *ast.OperationDefinition
+		err           error
+	)
+
+	span, ctx := tracing.StartSpan(ctx, "graphql")
+	defer func(start time.Time) {
+		// impersonated results are withheld if they can't be audited
+		if imp := impersonationFromContext(ctx); imp != nil {
+			if err := c.auditImpersonation(ctx, imp, operationName, document, operation, result); err != nil {
+				result = &Result{Errors: []*Error{newError(err)}}
+			}
+		}
+		observeOperation(c.operationLabels.label(operationName), start, result)
+		recordAccess(ctx, request, query, document, operation, result)
+		span.SetTag("operation", operationName)
+		span.Finish(result.err())
+	}(time.Now())
+
+	document, err = parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: query,
+			Name: "GraphQL request",
+		}),
 	})
+	if err != nil {
+		return queryErrors(ErrorParseFailed, gqlerrors.FormatError(err))
+	}
+
+	validation := graphql.ValidateDocument(&schema, document, nil)
+	if !validation.IsValid {
+		return queryErrors(ErrorValidationFailed, validation.Errors...)
+	}
+
+	operation, err = operationDefinition(document, request.OperationName)
+	if err != nil {
+		return queryErrors(ErrorValidationFailed, gqlerrors.FormatError(err))
+	}
+
+	if operation.Name != nil {
+		operationName = operation.Name.Value
+	}
 
-	return response, nil
+	if request.readOnly && operation.Operation != "query" {
+		return &Result{Errors: []*Error{newError(errReadOnly)}}
+	}
+
+	if imp := impersonationFromContext(ctx); imp != nil && !imp.actAs.Elevated && operation.Operation != "query" {
+		return &Result{Errors: []*Error{newError(errActAsReadOnly)}}
+	}
+
+	if disabled, _ := ctx.Value(introspectionDisabledKey).(bool); disabled && isIntrospection(document, operation) {
+		return &Result{Errors: []*Error{newError(errIntrospectionDisabled)}}
+	}
+
+	if err := c.checkComplexity(&schema, document, request.OperationName); err != nil {
+		return queryErrors(ErrorQueryTooComplex, gqlerrors.FormatError(err))
+	}
+
+	ctx, errs := withResolverErrors(ctx)
+
+	return errs.result(graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       ctx,
+	}))
+}
+
+// isIntrospection is whether operation queries __schema or __type.
+func isIntrospection(document *ast.Document, operation *ast.OperationDefinition) bool {
+	for _, field := range topLevelFields(document, operation.SelectionSet, make(map[string]bool)) {
+		if field == "__schema" || field == "__type" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// operationDefinition finds the operation named operationName in document, or
+// its only operation if operationName is empty.
+func operationDefinition(document *ast.Document, operationName string) (*ast.OperationDefinition, error) {
+	var operation *ast.OperationDefinition
+
+	for _, definition := range document.Definitions {
+		def, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if operationName == "" {
+			if operation != nil {
+				return nil, errOperationNameRequired
+			}
+			operation = def
+			continue
+		}
+
+		if def.Name != nil && def.Name.Value == operationName {
+			operation = def
+		}
+	}
+
+	if operation == nil {
+		if operationName != "" {
+			return nil, fmt.Errorf("unknown operation named %q", operationName)
+		}
+		return nil, errUnknownOperation
+	}
+
+	return operation, nil
 }
 
 type GraphQLRequest struct {
-	Query     string                 `json:"query"`
-	Variables map[string]interface{} `json:"variables,omitempty"`
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Id            string                 `json:"id,omitempty"`
+	Extensions    *GraphQLExtensions     `json:"extensions,omitempty"`
+
+	// readOnly requests (GETs) may only run queries
+	readOnly bool
+}
+
+type GraphQLExtensions struct {
+	PersistedQuery *PersistedQuery `json:"persistedQuery,omitempty"`
+
+	// ActAs runs the request as another user, on /admin/graphql only.
+	ActAs *ActAs `json:"actAs,omitempty"`
+}
+
+// PersistedQuery identifies a query by hash, as apollo's automatic persisted
+// queries do.
+type PersistedQuery struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
 }
 
 type QueryContext struct {
@@ -67,9 +380,18 @@ type QueryContext struct {
 }
 
 func (req *GraphQLRequest) Validate() error {
-	if req.Query == "" {
+	if req.Query == "" && req.persistedQueryId() == "" {
 		return errNoQuery
 	}
 
 	return nil
 }
+
+// persistedQueryId is the id or hash the request refers to its query by, if any.
+func (req *GraphQLRequest) persistedQueryId() string {
+	if req.Extensions != nil && req.Extensions.PersistedQuery != nil && req.Extensions.PersistedQuery.Sha256Hash != "" {
+		return req.Extensions.PersistedQuery.Sha256Hash
+	}
+
+	return req.Id
+}
@@ -0,0 +1,186 @@
+package composter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// adminGraphQLPath gets the admin cors policy, everything else gets the
+// graphql policy.
+const adminGraphQLPath = "/admin/graphql"
+
+var (
+	defaultCORSMethods = []string{"GET", "POST"}
+	defaultCORSHeaders = []string{"Accept-Encoding", "Authorization", "Content-Type", "traceparent"}
+
+	// defaultCORSPolicy applies if none is configured.
+	defaultCORSPolicy = &CORSPolicy{
+		OriginPatterns: []string{
+			`https?://localhost:(8080|8008)`,
+			`https://([^/]+\.)?(opsy\.co|opsee\.co|opsee\.com)`,
+		},
+		MaxAgeSeconds: 1728000,
+	}
+)
+
+// CORSConfig is the cross origin policy for /graphql, and for /admin/graphql
+// if it needs a different one.
+type CORSConfig struct {
+	GraphQL *CORSPolicy `json:"graphql,omitempty"`
+	Admin   *CORSPolicy `json:"admin,omitempty"`
+}
+
+// CORSPolicy decides which origins browsers may call an endpoint from, and
+// what they may send.
+type CORSPolicy struct {
+	// Origins are allowed exactly, e.g. https://app.opsee.com.
+	Origins []string `json:"origins,omitempty"`
+
+	// OriginPatterns are regular expressions that must match the whole origin.
+	OriginPatterns []string `json:"origin_patterns,omitempty"`
+
+	// Methods and Headers are allowed in preflights, and default to GET and
+	// POST, and the headers our clients send.
+	Methods []string `json:"methods,omitempty"`
+	Headers []string `json:"headers,omitempty"`
+
+	// AllowCredentials lets browsers send cookies and read the response.
+	AllowCredentials bool `json:"allow_credentials"`
+
+	// MaxAgeSeconds is how long browsers cache a preflight. Zero leaves it to
+	// the browser.
+	MaxAgeSeconds int `json:"max_age_seconds"`
+}
+
+// corsPolicy is a CORSPolicy ready to check requests against.
+type corsPolicy struct {
+	origins     map[string]bool
+	patterns    []*regexp.Regexp
+	methods     string
+	headers     string
+	credentials bool
+	maxAge      string
+}
+
+func (policy *CORSPolicy) compile() (*corsPolicy, error) {
+	if policy.MaxAgeSeconds < 0 {
+		return nil, fmt.Errorf("cors max age can't be negative")
+	}
+
+	compiled := &corsPolicy{
+		origins:     make(map[string]bool, len(policy.Origins)),
+		methods:     strings.Join(defaultCORSMethods, ","),
+		headers:     strings.Join(defaultCORSHeaders, ","),
+		credentials: policy.AllowCredentials,
+	}
+
+	for _, origin := range policy.Origins {
+		compiled.origins[origin] = true
+	}
+
+	for _, pattern := range policy.OriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("bad cors origin pattern %s: %s", pattern, err)
+		}
+		compiled.patterns = append(compiled.patterns, re)
+	}
+
+	if len(policy.Methods) > 0 {
+		compiled.methods = strings.Join(policy.Methods, ",")
+	}
+
+	if len(policy.Headers) > 0 {
+		compiled.headers = strings.Join(policy.Headers, ",")
+	}
+
+	if policy.MaxAgeSeconds > 0 {
+		compiled.maxAge = strconv.Itoa(policy.MaxAgeSeconds)
+	}
+
+	return compiled, nil
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	if p.origins[origin] {
+		return true
+	}
+
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply sets the cors headers for an allowed origin. Disallowed origins get
+// none, so browsers refuse the response.
+func (p *corsPolicy) apply(rw http.ResponseWriter, r *http.Request) {
+	header := rw.Header()
+	header.Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !p.allowed(origin) {
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+		header.Set("Access-Control-Allow-Methods", p.methods)
+		header.Set("Access-Control-Allow-Headers", p.headers)
+		if p.maxAge != "" {
+			header.Set("Access-Control-Max-Age", p.maxAge)
+		}
+	}
+}
+
+// corsHandler applies a cors policy by path before handing the request on.
+// It's outside the router since tp answers every preflight from one route.
+type corsHandler struct {
+	graphql *corsPolicy
+	admin   *corsPolicy
+	next    http.Handler
+}
+
+func newCORSHandler(config CORSConfig, next http.Handler) (*corsHandler, error) {
+	graphqlPolicy := config.GraphQL
+	if graphqlPolicy == nil {
+		graphqlPolicy = defaultCORSPolicy
+	}
+
+	adminPolicy := config.Admin
+	if adminPolicy == nil {
+		adminPolicy = graphqlPolicy
+	}
+
+	graphql, err := graphqlPolicy.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := adminPolicy.compile()
+	if err != nil {
+		return nil, fmt.Errorf("admin %s", err)
+	}
+
+	return &corsHandler{graphql: graphql, admin: admin, next: next}, nil
+}
+
+func (h *corsHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	policy := h.graphql
+	if r.URL.Path == adminGraphQLPath {
+		policy = h.admin
+	}
+
+	policy.apply(rw, r)
+	h.next.ServeHTTP(rw, r)
+}
@@ -0,0 +1,98 @@
+package composter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opsee/compost/resolver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	assert := assert.New(t)
+	c, err := New(&resolver.Client{}, Config{
+		CORS: CORSConfig{
+			GraphQL: &CORSPolicy{
+				Origins:        []string{"https://embedded.example.com"},
+				OriginPatterns: []string{`https://([^/]+\.)?opsee\.com`},
+				MaxAgeSeconds:  600,
+			},
+			Admin: &CORSPolicy{
+				Origins:          []string{"https://console.opsee.com"},
+				Methods:          []string{"POST"},
+				AllowCredentials: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preflight := func(path, origin string) http.Header {
+		req, err := http.NewRequest("OPTIONS", "http://compost"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+
+		w := httptest.NewRecorder()
+		c.server.Handler.ServeHTTP(w, req)
+		assert.Equal(http.StatusOK, w.Code)
+
+		return w.Header()
+	}
+
+	header := preflight("/graphql", "https://embedded.example.com")
+	assert.Equal("https://embedded.example.com", header.Get("Access-Control-Allow-Origin"))
+	assert.Equal("GET,POST", header.Get("Access-Control-Allow-Methods"))
+	assert.Equal("600", header.Get("Access-Control-Max-Age"))
+	assert.Equal("", header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal("Origin", header.Get("Vary"))
+
+	header = preflight("/graphql", "https://app.opsee.com")
+	assert.Equal("https://app.opsee.com", header.Get("Access-Control-Allow-Origin"))
+
+	// patterns match the whole origin
+	header = preflight("/graphql", "https://app.opsee.com.evil.com")
+	assert.Equal("", header.Get("Access-Control-Allow-Origin"))
+
+	header = preflight(adminGraphQLPath, "https://app.opsee.com")
+	assert.Equal("", header.Get("Access-Control-Allow-Origin"))
+
+	header = preflight(adminGraphQLPath, "https://console.opsee.com")
+	assert.Equal("https://console.opsee.com", header.Get("Access-Control-Allow-Origin"))
+	assert.Equal("POST", header.Get("Access-Control-Allow-Methods"))
+	assert.Equal("true", header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal("", header.Get("Access-Control-Max-Age"))
+
+	_, err = New(&resolver.Client{}, Config{
+		CORS: CORSConfig{GraphQL: &CORSPolicy{OriginPatterns: []string{"("}}},
+	})
+	assert.Error(err)
+}
+
+func TestDefaultCORSPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := defaultCORSPolicy.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for origin, allowed := range map[string]bool{
+		"http://localhost:8080":      true,
+		"https://localhost:8008":     true,
+		"https://opsee.com":          true,
+		"https://app.opsee.com":      true,
+		"https://staging.opsy.co":    true,
+		"http://app.opsee.com":       false,
+		"https://evilopsee.com":      false,
+		"https://opsee.com.evil.com": false,
+		"https://coreys-mbp-8:8080":  false,
+		"https://localhost:8081":     false,
+	} {
+		assert.Equal(allowed, policy.allowed(origin), origin)
+	}
+}
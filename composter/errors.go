@@ -0,0 +1,387 @@
+package composter
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/opsee/compost/apikey"
+	"github.com/opsee/compost/audit"
+	"github.com/opsee/compost/resolver"
+	"github.com/opsee/compost/scope"
+	"github.com/opsee/compost/session"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrorCode is the kind of a graphql error, sent in the error's extensions
+// so clients don't have to match on messages.
+type ErrorCode string
+
+const (
+	ErrorUnauthenticated     ErrorCode = "UNAUTHENTICATED"
+	ErrorForbidden           ErrorCode = "FORBIDDEN"
+	ErrorInvalidArgument     ErrorCode = "INVALID_ARGUMENT"
+	ErrorNotFound            ErrorCode = "NOT_FOUND"
+	ErrorUpstreamUnavailable ErrorCode = "UPSTREAM_UNAVAILABLE"
+	ErrorUpstream            ErrorCode = "UPSTREAM_ERROR"
+	ErrorAborted             ErrorCode = "ABORTED"
+	ErrorInternal            ErrorCode = "INTERNAL"
+
+	// errors with the query itself, before anything is resolved
+	ErrorParseFailed                ErrorCode = "GRAPHQL_PARSE_FAILED"
+	ErrorValidationFailed           ErrorCode = "GRAPHQL_VALIDATION_FAILED"
+	ErrorQueryTooComplex            ErrorCode = "QUERY_TOO_COMPLEX"
+	ErrorPersistedQueryNotFound     ErrorCode = "PERSISTED_QUERY_NOT_FOUND"
+	ErrorPersistedQueryNotSupported ErrorCode = "PERSISTED_QUERY_NOT_SUPPORTED"
+)
+
+// errorCodes are the codes of errors we return ourselves.
+var errorCodes = map[error]ErrorCode{
+	errDecodeUser:                  ErrorUnauthenticated,
+	errMissingRegion:               ErrorInvalidArgument,
+	errMissingVpc:                  ErrorInvalidArgument,
+	errMissingService:              ErrorInvalidArgument,
+	errMissingInstanceType:         ErrorInvalidArgument,
+	errMissingGroupType:            ErrorInvalidArgument,
+	errDecodeInstances:             ErrorInvalidArgument,
+	errDecodeInstanceIds:           ErrorInvalidArgument,
+	errDecodeUserPermissions:       ErrorInvalidArgument,
+	errUnknownInstanceMetricType:   ErrorInvalidArgument,
+	errDecodeMetricStatisticsInput: ErrorInvalidArgument,
+	errDecodeCheckInput:            ErrorInvalidArgument,
+	errDecodeTeamInput:             ErrorInvalidArgument,
+	errDecodeUserInput:             ErrorInvalidArgument,
+	errDecodeNotificationsInput:    ErrorInvalidArgument,
+	errUnknownAction:               ErrorInvalidArgument,
+
+	resolver.ErrInvalidCheckInput: ErrorInvalidArgument,
+	resolver.ErrCheckAborted:      ErrorAborted,
+
+	apikey.ErrNotFound:          ErrorNotFound,
+	apikey.ErrMissingName:       ErrorInvalidArgument,
+	apikey.ErrUnknownPermission: ErrorInvalidArgument,
+	errApiKeyExpiry:             ErrorInvalidArgument,
+	errMissingApiKeyId:          ErrorInvalidArgument,
+
+	session.ErrNotFound: ErrorNotFound,
+	errMissingSessionId: ErrorInvalidArgument,
+
+	audit.ErrNotQueryable: ErrorInvalidArgument,
+	errAuditLogLimit:      ErrorInvalidArgument,
+	errAuditLogRange:      ErrorInvalidArgument,
+
+	scope.ErrMissingRegion:   ErrorInvalidArgument,
+	scope.ErrDuplicateRegion: ErrorInvalidArgument,
+	errMissingScopeUserId:    ErrorInvalidArgument,
+	errDecodeScope:           ErrorInvalidArgument,
+
+	errActAsNotAllowed:     ErrorInvalidArgument,
+	errMissingActAs:        ErrorInvalidArgument,
+	errActAsUserNotFound:   ErrorNotFound,
+	errActAsReadOnly:       ErrorForbidden,
+	errImpersonationRecord: ErrorInternal,
+
+	errNoQuery:                    ErrorInvalidArgument,
+	errReadOnly:                   ErrorInvalidArgument,
+	errIntrospectionDisabled:      ErrorForbidden,
+	errOperationNameRequired:      ErrorValidationFailed,
+	errUnknownOperation:           ErrorValidationFailed,
+	errNotSubscription:            ErrorValidationFailed,
+	errDuplicateSubscription:      ErrorInvalidArgument,
+	errPersistedQueryNotFound:     ErrorPersistedQueryNotFound,
+	errPersistedQueryNotSupported: ErrorPersistedQueryNotSupported,
+	errPersistedQueryHashMismatch: ErrorInvalidArgument,
+	errQueryNotPersisted:          ErrorForbidden,
+}
+
+var grpcErrorCodes = map[codes.Code]ErrorCode{
+	codes.Unauthenticated:    ErrorUnauthenticated,
+	codes.PermissionDenied:   ErrorForbidden,
+	codes.InvalidArgument:    ErrorInvalidArgument,
+	codes.FailedPrecondition: ErrorInvalidArgument,
+	codes.OutOfRange:         ErrorInvalidArgument,
+	codes.AlreadyExists:      ErrorInvalidArgument,
+	codes.NotFound:           ErrorNotFound,
+	codes.Unavailable:        ErrorUpstreamUnavailable,
+	codes.DeadlineExceeded:   ErrorUpstreamUnavailable,
+}
+
+// Error is a graphql error with a code, and the backend that caused it if
+// there was one.
+type Error struct {
+	Code      ErrorCode
+	Backend   string
+	Message   string
+	Locations []location.SourceLocation
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	locations := e.Locations
+	if locations == nil {
+		locations = []location.SourceLocation{}
+	}
+
+	return json.Marshal(struct {
+		Message    string                    `json:"message"`
+		Locations  []location.SourceLocation `json:"locations"`
+		Extensions errorExtensions           `json:"extensions"`
+	}{e.Message, locations, errorExtensions{e.Code, e.Backend}})
+}
+
+type errorExtensions struct {
+	Code    ErrorCode `json:"code"`
+	Backend string    `json:"backend,omitempty"`
+}
+
+// Result is a graphql.Result whose errors have codes.
+type Result struct {
+	Data   interface{} `json:"data"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+func (r *Result) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// err is the result's first error, or nil.
+func (r *Result) err() error {
+	if !r.HasErrors() {
+		return nil
+	}
+
+	return r.Errors[0]
+}
+
+// newError returns err with a code.
+func newError(err error) *Error {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case *resolver.BackendError:
+		return backendError(e)
+	case gqlerrors.FormattedError:
+		return &Error{Code: ErrorInternal, Message: e.Message, Locations: e.Locations}
+	}
+
+	if code, ok := errorCodes[err]; ok {
+		return &Error{Code: code, Message: err.Error()}
+	}
+
+	return &Error{Code: ErrorInternal, Message: err.Error()}
+}
+
+// backendError codes an error by the backend's grpc code or http status.
+func backendError(err *resolver.BackendError) *Error {
+	e := &Error{
+		Code:    ErrorUpstream,
+		Backend: err.Backend,
+		Message: grpc.ErrorDesc(err.Err),
+	}
+
+	if code, ok := grpcErrorCodes[grpc.Code(err.Err)]; ok {
+		e.Code = code
+		return e
+	}
+
+	status := err.HTTPStatus()
+	switch {
+	case status == http.StatusUnauthorized:
+		e.Code = ErrorUnauthenticated
+	case status == http.StatusForbidden:
+		e.Code = ErrorForbidden
+	case status == http.StatusNotFound:
+		e.Code = ErrorNotFound
+	case status == http.StatusBadRequest, status == http.StatusConflict, status == 422:
+		e.Code = ErrorInvalidArgument
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout:
+		e.Code = ErrorUpstreamUnavailable
+	case status == 0:
+		if _, ok := err.Err.(net.Error); ok {
+			e.Code = ErrorUpstreamUnavailable
+		}
+	}
+
+	return e
+}
+
+// forbidden codes a failed permission check.
+func forbidden(err error) error {
+	return &Error{Code: ErrorForbidden, Message: err.Error()}
+}
+
+// queryErrors is a result for a query that couldn't be run at all.
+func queryErrors(code ErrorCode, errs ...gqlerrors.FormattedError) *Result {
+	result := &Result{}
+	for _, err := range errs {
+		result.Errors = append(result.Errors, &Error{Code: code, Message: err.Message, Locations: err.Locations})
+	}
+
+	return result
+}
+
+// resolverErrors collects the coded errors of a query's resolvers, since the
+// executor only keeps their messages.
+type resolverErrors struct {
+	mut    sync.Mutex
+	errors []*Error
+}
+
+func withResolverErrors(ctx context.Context) (context.Context, *resolverErrors) {
+	errs := &resolverErrors{}
+	return context.WithValue(ctx, resolverErrorsKey, errs), errs
+}
+
+func (r *resolverErrors) add(err *Error) {
+	r.mut.Lock()
+	r.errors = append(r.errors, err)
+	r.mut.Unlock()
+}
+
+// take removes and returns the first error with message.
+func (r *resolverErrors) take(message string) *Error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for i, err := range r.errors {
+		if err.Message == message {
+			r.errors = append(r.errors[:i], r.errors[i+1:]...)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// result codes an executor result's errors with the collected resolver errors.
+// Anything else that went wrong during execution is an internal error.
+func (r *resolverErrors) result(result *graphql.Result) *Result {
+	coded := &Result{Data: result.Data}
+
+	for _, formatted := range result.Errors {
+		err := r.take(formatted.Message)
+		if err == nil {
+			err = &Error{Code: ErrorInternal, Message: formatted.Message}
+		}
+
+		if len(formatted.Locations) > 0 {
+			err.Locations = formatted.Locations
+		}
+
+		coded.Errors = append(coded.Errors, err)
+	}
+
+	return coded
+}
+
+// wrappedObjects are the objects whose resolvers are already wrapped. Most
+// types are shared between schemas, so they'd otherwise be wrapped once per
+// composter.
+var wrappedObjects = struct {
+	sync.Mutex
+	objects map[*graphql.Object]bool
+}{objects: make(map[*graphql.Object]bool)}
+
+// wrapResolvers makes every resolver in schemas code its errors and add them
+// to the query's resolverErrors, traces them, and times the root types' fields. Objects with
+// thunked fields (the generated types) can't be changed, but their resolvers
+// don't return errors.
+func wrapResolvers(schemas ...graphql.Schema) {
+	wrappedObjects.Lock()
+	defer wrappedObjects.Unlock()
+
+	roots := make(map[*graphql.Object]bool)
+	for _, schema := range schemas {
+		roots[schema.QueryType()] = true
+		if mutation := schema.MutationType(); mutation != nil {
+			roots[mutation] = true
+		}
+	}
+
+	for _, schema := range schemas {
+		for _, typ := range schema.TypeMap() {
+			object, ok := typ.(*graphql.Object)
+			if !ok || wrappedObjects.objects[object] {
+				continue
+			}
+
+			for name, field := range object.Fields() {
+				if field.Resolve == nil {
+					continue
+				}
+
+				args := graphql.FieldConfigArgument{}
+				for _, arg := range field.Args {
+					args[arg.Name()] = &graphql.ArgumentConfig{
+						Type:         arg.Type,
+						DefaultValue: arg.DefaultValue,
+						Description:  arg.Description(),
+					}
+				}
+
+				resolve := tracedResolve(object.Name()+"."+name, codedResolve(field.Resolve))
+				if roots[object] {
+					resolve = timedResolve(object.Name()+"."+name, resolve)
+				}
+
+				object.AddFieldConfig(name, &graphql.Field{
+					Name:              field.Name,
+					Description:       field.Description,
+					Type:              field.Type,
+					Args:              args,
+					Resolve:           resolve,
+					DeprecationReason: field.DeprecationReason,
+				})
+			}
+
+			wrappedObjects.objects[object] = true
+		}
+	}
+}
+
+func codedResolve(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		result, err := resolve(p)
+		if err == nil {
+			return result, nil
+		}
+
+		coded := newError(err)
+		coded = &Error{
+			Code:      coded.Code,
+			Backend:   coded.Backend,
+			Message:   coded.Message,
+			Locations: fieldLocations(p.Info.FieldASTs),
+		}
+
+		if p.Context != nil {
+			if errs, ok := p.Context.Value(resolverErrorsKey).(*resolverErrors); ok {
+				errs.add(coded)
+			}
+		}
+
+		// the executor keeps the locations of formatted errors
+		return result, gqlerrors.FormattedError{Message: coded.Message, Locations: coded.Locations}
+	}
+}
+
+func fieldLocations(fields []*ast.Field) []location.SourceLocation {
+	locations := []location.SourceLocation{}
+	for _, field := range fields {
+		if field.Loc != nil {
+			locations = append(locations, location.GetLocation(field.Loc.Source, field.Loc.Start))
+		}
+	}
+
+	return locations
+}
@@ -0,0 +1,78 @@
+package composter
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/fake"
+	"github.com/opsee/compost/resolver"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestNewError(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		err     error
+		code    ErrorCode
+		backend string
+		message string
+	}{
+		{errDecodeUser, ErrorUnauthenticated, "", "error decoding user"},
+		{errMissingRegion, ErrorInvalidArgument, "", "missing region id"},
+		{errors.New("oops"), ErrorInternal, "", "oops"},
+		{&resolver.BackendError{Backend: "cats", Err: grpc.Errorf(codes.NotFound, "user 1 not found")}, ErrorNotFound, "cats", "user 1 not found"},
+		{&resolver.BackendError{Backend: "spanx", Err: grpc.Errorf(codes.Unavailable, "down")}, ErrorUpstreamUnavailable, "spanx", "down"},
+		{&resolver.BackendError{Backend: "bartnet", Err: errors.New("bartnet responded with error status: 401 Unauthorized")}, ErrorUnauthenticated, "bartnet", "bartnet responded with error status: 401 Unauthorized"},
+		{&resolver.BackendError{Backend: "hugs", Err: errors.New("hugs responded with error status: 503 Service Unavailable")}, ErrorUpstreamUnavailable, "hugs", "hugs responded with error status: 503 Service Unavailable"},
+		{&resolver.BackendError{Backend: "hugs", Err: errors.New("hugs responded with error status: 500 Internal Server Error")}, ErrorUpstream, "hugs", "hugs responded with error status: 500 Internal Server Error"},
+	} {
+		err := newError(test.err)
+		assert.Equal(test.code, err.Code, test.message)
+		assert.Equal(test.backend, err.Backend, test.message)
+		assert.Equal(test.message, err.Message)
+	}
+}
+
+func TestErrorExtensions(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &schema.User{Id: 1, CustomerId: fake.CustomerId, Email: "fake@opsee.com", Status: "active", Perms: &schema.UserFlags{Edit: true}}
+	ctx := context.WithValue(context.Background(), userKey, user)
+	ctx = context.WithValue(ctx, queryContextKey, &QueryContext{})
+
+	result := c.execute(ctx, c.Schema, `{ checks(id: "nope") { id } }`, &GraphQLRequest{})
+	if assert.Len(result.Errors, 1) {
+		assert.Equal(ErrorNotFound, result.Errors[0].Code)
+		assert.Equal(resolver.BackendBartnet, result.Errors[0].Backend)
+	}
+
+	result = c.execute(ctx, c.Schema, `mutation reboot { region(id: "us-west-2") { rebootInstances(ids: ["i-1"]) } }`, &GraphQLRequest{})
+	if assert.Len(result.Errors, 1) {
+		data, err := json.Marshal(result.Errors[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.JSONEq(`{
+			"message": "missing permission: admin",
+			"locations": [{"line": 1, "column": 45}],
+			"extensions": {"code": "FORBIDDEN"}
+		}`, string(data))
+	}
+
+	result = c.execute(ctx, c.Schema, `{ nope }`, &GraphQLRequest{})
+	if assert.Len(result.Errors, 1) {
+		assert.Equal(ErrorValidationFailed, result.Errors[0].Code)
+	}
+}
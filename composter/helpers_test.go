@@ -0,0 +1,23 @@
+package composter
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/opsee/compost/fake"
+)
+
+// testUserRequest posts body to /graphql as the fake customer's user id, with
+// perms as json, and returns the response body.
+func testUserRequest(t *testing.T, c *Composter, id int, perms, body string) string {
+	user := `{"id": ` + strconv.Itoa(id) + `, "customer_id": "` + fake.CustomerId + `", "email": "user@opsee.com", "active": true, "status": "active", "perms": ` + perms + `}`
+
+	req := newTestGraphQLRequest(t, "POST", "/graphql", body)
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user)))
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	return w.Body.String()
+}
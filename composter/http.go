@@ -2,7 +2,6 @@ package composter
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -10,8 +9,9 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/opsee/basic/schema"
 	"github.com/opsee/basic/tp"
+	"github.com/opsee/compost/metrics"
+	"github.com/opsee/compost/static"
 	log "github.com/opsee/logrus"
-	"github.com/opsee/vaper"
 	"golang.org/x/net/context"
 )
 
@@ -19,75 +19,110 @@ var (
 	errUnknown = errors.New("unknown error.")
 )
 
-func (s *Composter) StartHTTP(addr string) {
-	http.ListenAndServe(addr, s.router)
-}
-
-func (s *Composter) initHTTP() {
+func (s *Composter) initHTTP(corsConfig CORSConfig) error {
 	router := tp.NewHTTPRouter(context.Background())
 
-	router.CORS(
-		[]string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"},
-		[]string{`https?://localhost:8080`, `https?://localhost:8008`, `https://(.+)?(opsy\.co|opsee\.co|opsee\.com)`, `https?://coreys-mbp-8:\d+`},
-	)
-
 	// graph q l
 	router.Handle("POST", "/graphql", []tp.DecodeFunc{
-		tp.AuthorizationDecodeFunc(userKey, schema.User{}),
-		tp.RequestDecodeFunc(requestKey, GraphQLRequest{}),
-	}, s.graphQL())
-	router.Handle("POST", "/admin/graphql", []tp.DecodeFunc{
+		traceDecodeFunc(),
+		s.userDecodeFunc(),
+		graphQLRequestDecodeFunc(),
+		s.rateLimitDecodeFunc(),
+	}, s.logAccess(s.graphQL()))
+	router.Handle("GET", "/graphql", []tp.DecodeFunc{
+		traceDecodeFunc(),
+		s.userDecodeFunc(),
+		graphQLRequestDecodeFunc(),
+		s.rateLimitDecodeFunc(),
+	}, s.logAccess(s.graphQL()))
+	router.Handle("POST", adminGraphQLPath, []tp.DecodeFunc{
+		traceDecodeFunc(),
 		s.authorizationDecodeFunc(),
-		tp.RequestDecodeFunc(requestKey, GraphQLRequest{}),
-	}, s.adminGraphQL())
+		graphQLRequestDecodeFunc(),
+	}, s.logAccess(s.adminGraphQL()))
+	router.HandlerFunc("GET", "/graphql/subscriptions", s.subscriptions())
+	router.HandlerFunc("GET", "/schema.graphql", s.schemaSDL())
 
-	// fileserver for static things
-	router.Handler("GET", "/static/*stuff", http.StripPrefix("/static/", http.FileServer(http.Dir("/static"))))
+	// tp serves /health, which only means the process is up
+	router.HandlerFunc("GET", "/ready", s.ready())
+	router.Handler("GET", "/metrics", metrics.Default)
+
+	// the graphiql console, served from the binary
+	router.HandlerFunc("GET", "/graphiql", graphiQL())
+	router.Handler("GET", "/static/*stuff", http.StripPrefix("/static/", http.FileServer(http.FS(static.Files))))
 
 	// set a big timeout bc aws be slow
 	router.Timeout(5 * time.Minute)
 
+	cors, err := newCORSHandler(corsConfig, router)
+	if err != nil {
+		return err
+	}
+
 	s.router = router
+	s.server = &http.Server{Handler: cors}
+	return nil
 }
 
-func (s *Composter) authorizationDecodeFunc() tp.DecodeFunc {
+// userDecodeFunc decodes the user from a vaper bearer token, an api key, or
+// the basic user json tp decodes.
+func (s *Composter) userDecodeFunc() tp.DecodeFunc {
+	basic := tp.AuthorizationDecodeFunc(userKey, schema.User{})
+
 	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request, p httprouter.Params) (context.Context, int, error) {
 		header := r.Header.Get("authorization")
-		if header == "" {
-			return ctx, http.StatusUnauthorized, nil
-		}
 
-		var (
-			authType string
-			token    string
-		)
+		switch lower := strings.ToLower(header); {
+		case strings.HasPrefix(lower, "bearer "):
+			user, session, err := s.bearerUser(ctx, header)
+			if err != nil {
+				return ctx, authStatus(err), err
+			}
+
+			ctx = context.WithValue(ctx, sessionKey, session)
+			return context.WithValue(ctx, userKey, user), 0, nil
+
+		case strings.HasPrefix(lower, "apikey "):
+			key, user, err := s.apiKeyUser(header)
+			if err != nil {
+				return ctx, http.StatusUnauthorized, err
+			}
 
-		_, err := fmt.Sscanf(header, "%s %s", &authType, &token)
-		if err != nil || token == "" {
-			return ctx, http.StatusUnauthorized, fmt.Errorf("Authorization header is malformed.")
+			ctx = context.WithValue(ctx, apiKeyKey, key)
+			return context.WithValue(ctx, userKey, user), 0, nil
 		}
 
-		if strings.ToLower(authType) != "bearer" {
-			return ctx, http.StatusUnauthorized, fmt.Errorf("Authorization type not supported.")
+		ctx, status, err := basic(ctx, rw, r, p)
+		if status != 0 || err != nil {
+			return ctx, status, err
 		}
 
-		decoded, err := vaper.Unmarshal(token)
-		if err != nil {
-			log.WithError(err).Error("error decoding bearer token")
-			return ctx, http.StatusUnauthorized, fmt.Errorf("Authorization token decode error.")
+		user, ok := ctx.Value(userKey).(*schema.User)
+		if !ok {
+			return ctx, http.StatusUnauthorized, errDecodeUser
 		}
 
-		user := &schema.User{}
-		err = decoded.Reify(user)
-		if err != nil {
-			return ctx, http.StatusUnauthorized, fmt.Errorf("authorization token unmarshal error.")
+		if err := s.sessions.checkBasic(ctx, header, user); err != nil {
+			return ctx, authStatus(err), err
 		}
 
-		err = user.Validate()
+		return ctx, 0, nil
+	}
+}
+
+func (s *Composter) authorizationDecodeFunc() tp.DecodeFunc {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request, p httprouter.Params) (context.Context, int, error) {
+		header := r.Header.Get("authorization")
+		if header == "" {
+			return ctx, http.StatusUnauthorized, nil
+		}
+
+		user, session, err := s.bearerUser(ctx, header)
 		if err != nil {
-			return ctx, http.StatusUnauthorized, err
+			return ctx, authStatus(err), err
 		}
 
+		ctx = context.WithValue(ctx, sessionKey, session)
 		return context.WithValue(ctx, userKey, user), 0, nil
 	}
 }
@@ -99,7 +134,11 @@ func (s *Composter) graphQL() tp.HandleFunc {
 			return nil, http.StatusUnauthorized, errDecodeUser
 		}
 
-		response, err := s.Compost(ctx, s.Schema)
+		if s.introspectionDisabled(ctx) {
+			ctx = context.WithValue(ctx, introspectionDisabledKey, true)
+		}
+
+		response, err := s.compostRequest(ctx, s.Schema)
 		if err != nil {
 			return nil, http.StatusInternalServerError, err
 		}
@@ -108,6 +147,28 @@ func (s *Composter) graphQL() tp.HandleFunc {
 	}
 }
 
+// introspectionDisabled is whether the requestor can't introspect /graphql.
+// Only opsee admins with a vape token are let through, since basic user json
+// could claim to be one.
+func (s *Composter) introspectionDisabled(ctx context.Context) bool {
+	return s.disableIntrospection && !tokenOpseeAdmin(ctx)
+}
+
+// graphiQL serves the graphiql console.
+func graphiQL() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		index, err := static.Files.ReadFile("index.html")
+		if err != nil {
+			log.WithError(err).Error("error reading the graphiql console")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.Write(index)
+	}
+}
+
 func (s *Composter) adminGraphQL() tp.HandleFunc {
 	return func(ctx context.Context) (interface{}, int, error) {
 		_, ok := ctx.Value(userKey).(*schema.User)
@@ -115,7 +176,9 @@ func (s *Composter) adminGraphQL() tp.HandleFunc {
 			return nil, http.StatusUnauthorized, errDecodeUser
 		}
 
-		response, err := s.Compost(ctx, s.AdminSchema)
+		ctx = context.WithValue(ctx, actAsAllowedKey, true)
+
+		response, err := s.compostRequest(ctx, s.AdminSchema)
 		if err != nil {
 			return nil, http.StatusInternalServerError, err
 		}
@@ -2,12 +2,17 @@ package composter
 
 import (
 	"bytes"
-	"github.com/opsee/compost/resolver"
-	"github.com/opsee/vaper"
-	"github.com/stretchr/testify/assert"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/fake"
+	"github.com/opsee/compost/resolver"
+	"github.com/opsee/vaper"
+	"github.com/stretchr/testify/assert"
 )
 
 const (
@@ -24,7 +29,10 @@ func init() {
 
 func TestAdminAuth(t *testing.T) {
 	assert := assert.New(t)
-	c := New(&resolver.Client{})
+	c, err := New(&resolver.Client{}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	req, err := http.NewRequest("POST", "http://compost/admin/graphql", bytes.NewBuffer([]byte(`{"query": "{}"}`)))
 	if err != nil {
@@ -39,3 +47,101 @@ func TestAdminAuth(t *testing.T) {
 
 	assert.Equal(401, w.Code)
 }
+
+func TestBearerAuth(t *testing.T) {
+	assert := assert.New(t)
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &schema.User{Id: 1, CustomerId: fake.CustomerId, Email: "fake@opsee.com", Active: true, Status: "active", Perms: &schema.UserFlags{Admin: true}}
+	token, err := vaper.New(user, user.Email, time.Now(), time.Now().Add(time.Hour)).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := newTestGraphQLRequest(t, "POST", "/graphql", `{"query": "{ checks { id } }"}`)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "fake-check-1")
+
+	req.Header.Set("Authorization", "Bearer nope")
+	w = httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestIntrospection(t *testing.T) {
+	assert := assert.New(t)
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{DisableIntrospection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for query, allowed := range map[string]bool{
+		`{ __schema { queryType { name } } }`:                                  false,
+		`{ __type(name: \"Query\") { name } }`:                                 false,
+		`query q { ...f } fragment f on Query { __schema { types { name } } }`: false,
+		`{ checks { __typename id } }`:                                         true,
+	} {
+		w := testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "`+query+`"}`)
+		assert.Equal(http.StatusOK, w.Code)
+		if allowed {
+			assert.NotContains(w.Body.String(), "FORBIDDEN", query)
+		} else {
+			assert.Contains(w.Body.String(), `"code":"FORBIDDEN"`, query)
+		}
+	}
+
+	// opsee admins can still introspect, but only with a vape token, since
+	// basic user json could claim to be one
+	introspect := func(authorization string) string {
+		req := newTestGraphQLRequest(t, "POST", "/graphql", `{"query": "{ __schema { queryType { name } } }"}`)
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		assert.Equal(http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	user := `{"id": 1, "customer_id": "` + fake.CustomerId + `", "email": "fake@opsee.com", "admin": true, "active": true, "status": "active"}`
+	assert.Contains(introspect("Basic "+base64.StdEncoding.EncodeToString([]byte(user))), `"code":"FORBIDDEN"`)
+
+	now := time.Now()
+	admin := fake.DefaultFixtures().Users[0]
+	token, err := vaper.New(admin, admin.Email, now, now.Add(time.Hour)).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(introspect("Bearer "+token), `"queryType":{"name":"Query"}`)
+
+	w := testGraphQLRequest(t, c, "GET", "/schema.graphql", "")
+	assert.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestGraphiQL(t *testing.T) {
+	assert := assert.New(t)
+	c, err := New(&resolver.Client{}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, contains := range map[string]string{
+		"/graphiql":                  "renderGraphiql",
+		"/static/js/app-graphiql.js": "Bearer",
+		"/static/css/graphiql.css":   "#graphiql-container",
+	} {
+		req, err := http.NewRequest("GET", "http://compost"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		assert.Equal(http.StatusOK, w.Code, path)
+		assert.Contains(w.Body.String(), contains, path)
+	}
+}
@@ -0,0 +1,124 @@
+package composter
+
+import (
+	"errors"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"github.com/opsee/compost/audit"
+	log "github.com/opsee/logrus"
+	"golang.org/x/net/context"
+)
+
+var (
+	errActAsNotAllowed     = errors.New("actAs is only allowed on " + adminGraphQLPath)
+	errMissingActAs        = errors.New("actAs needs a customer_id and user_id")
+	errActAsUserNotFound   = errors.New("no user with that id in that customer")
+	errActAsReadOnly       = errors.New("requests acting as a user may only run queries, unless elevated")
+	errImpersonationRecord = errors.New("error recording the request in the audit log")
+)
+
+// ActAs runs an operation on /admin/graphql as one of a customer's users, so
+// that opsee admins see what they see.
+type ActAs struct {
+	CustomerId string `json:"customer_id"`
+	UserId     int32  `json:"user_id"`
+
+	// Elevated lets the operation be a mutation.
+	Elevated bool `json:"elevated,omitempty"`
+}
+
+// impersonation is an opsee admin acting as a user, for one operation.
+type impersonation struct {
+	admin *schema.User
+	actAs *ActAs
+}
+
+// actAs is the request's actAs extension, if any.
+func (r *GraphQLRequest) actAs() *ActAs {
+	if r.Extensions == nil {
+		return nil
+	}
+
+	return r.Extensions.ActAs
+}
+
+// impersonate replaces the user in the context with the user actAs names, for
+// the rest of the operation. Only opsee admins may, and only on
+// /admin/graphql.
+func (c *Composter) impersonate(ctx context.Context, actAs *ActAs) (context.Context, error) {
+	admin, err := requestorFromContext(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, impersonationKey, &impersonation{admin: admin, actAs: actAs})
+
+	if allowed, _ := ctx.Value(actAsAllowedKey).(bool); !allowed {
+		return ctx, errActAsNotAllowed
+	}
+
+	if err := opseeAdmin(admin); err != nil {
+		return ctx, forbidden(err)
+	}
+
+	if actAs.CustomerId == "" || actAs.UserId == 0 {
+		return ctx, errMissingActAs
+	}
+
+	resp, err := c.resolver.GetUser(ctx, &opsee.GetUserRequest{
+		Requestor:  admin,
+		CustomerId: actAs.CustomerId,
+		Id:         actAs.UserId,
+	})
+	if err != nil {
+		return ctx, err
+	}
+
+	if resp.User == nil || resp.User.CustomerId != actAs.CustomerId {
+		return ctx, errActAsUserNotFound
+	}
+
+	return context.WithValue(ctx, userKey, resp.User), nil
+}
+
+// impersonationFromContext is the impersonation the operation runs under, or
+// nil.
+func impersonationFromContext(ctx context.Context) *impersonation {
+	imp, _ := ctx.Value(impersonationKey).(*impersonation)
+	return imp
+}
+
+// auditImpersonation records an operation run with actAs, whether or not it
+// was allowed to run.
+func (c *Composter) auditImpersonation(ctx context.Context, imp *impersonation, operationName string, document *ast.Document, operation *ast.OperationDefinition, result *Result) error {
+	entry := audit.NewEntry()
+	entry.ActorCustomerId = imp.admin.CustomerId
+	entry.ActorId = imp.admin.Id
+	entry.ActorEmail = imp.admin.Email
+	entry.CustomerId = imp.actAs.CustomerId
+	entry.UserId = imp.actAs.UserId
+	entry.Action = audit.ActionImpersonate
+	entry.Elevated = imp.actAs.Elevated
+	entry.Operation = operationName
+	entry.Outcome = audit.OutcomeSuccess
+
+	if operation != nil {
+		entry.OperationType = operation.Operation
+		entry.Fields = topLevelFields(document, operation.SelectionSet, make(map[string]bool))
+	}
+
+	if result != nil && len(result.Errors) > 0 {
+		entry.Outcome = audit.OutcomeFailure
+		for _, err := range result.Errors {
+			entry.Errors = append(entry.Errors, err.Message)
+		}
+	}
+
+	if err := c.audit.Record(ctx, entry); err != nil {
+		log.WithError(err).WithField("customer_id", imp.actAs.CustomerId).Error("error recording impersonated request")
+		return errImpersonationRecord
+	}
+
+	return nil
+}
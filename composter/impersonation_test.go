@@ -0,0 +1,109 @@
+package composter
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/audit"
+	"github.com/opsee/compost/fake"
+	"github.com/opsee/vaper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+type testAuditSink struct {
+	entries []*audit.Entry
+	err     error
+}
+
+func (s *testAuditSink) Record(ctx context.Context, entry *audit.Entry) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *testAuditSink) Query(ctx context.Context, q audit.Query) ([]*audit.Entry, error) {
+	return nil, audit.ErrNotQueryable
+}
+
+func TestImpersonation(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := fake.DefaultFixtures()
+	support := &schema.User{Id: 100, CustomerId: "opsee", Email: "support@opsee.com", Admin: true, Active: true, Status: "active", Perms: &schema.UserFlags{Admin: true}}
+	member := &schema.User{Id: 2, CustomerId: fake.CustomerId, Email: "member@opsee.com", Active: true, Status: "active", Perms: &schema.UserFlags{Edit: true}}
+	fixtures.Users = append(fixtures.Users, support, member)
+
+	c, err := New(fake.NewClient(fixtures), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &testAuditSink{}
+	c.audit = sink
+
+	request := func(path string, user *schema.User, body string) string {
+		now := time.Now()
+		token, err := vaper.New(user, user.Email, now, now.Add(time.Hour)).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := newTestGraphQLRequest(t, "POST", path, body)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	actAs := `"extensions": {"actAs": {"customer_id": "` + fake.CustomerId + `", "user_id": 2}}`
+
+	// support sees the customer's checks, as the member sees them
+	body := request(adminGraphQLPath, support, `{"query": "{ checks { id } }", `+actAs+`}`)
+	assert.Contains(body, "fake-check-1")
+	if assert.Len(sink.entries, 1) {
+		entry := sink.entries[0]
+		assert.Equal(int32(100), entry.ActorId)
+		assert.Equal(fake.CustomerId, entry.CustomerId)
+		assert.Equal(int32(2), entry.UserId)
+		assert.Equal("query", entry.OperationType)
+		assert.Equal([]string{"checks"}, entry.Fields)
+		assert.Equal(audit.OutcomeSuccess, entry.Outcome)
+	}
+
+	// and has the member's permissions, not their own
+	body = request(adminGraphQLPath, support, `{"query": "{ listCustomers { customers { id } } }", `+actAs+`}`)
+	assert.Contains(body, `"code":"FORBIDDEN"`)
+
+	// mutations need elevating
+	deleteCheck := `"query": "mutation remove { deleteChecks(ids: [\"fake-check-1\"]) { id } }"`
+	body = request(adminGraphQLPath, support, `{`+deleteCheck+`, `+actAs+`}`)
+	assert.Contains(body, `"code":"FORBIDDEN"`)
+	assert.Equal(audit.OutcomeFailure, sink.entries[len(sink.entries)-1].Outcome)
+
+	elevated := `"extensions": {"actAs": {"customer_id": "` + fake.CustomerId + `", "user_id": 2, "elevated": true}}`
+	body = request(adminGraphQLPath, support, `{`+deleteCheck+`, `+elevated+`}`)
+	assert.NotContains(body, "errors")
+	assert.True(sink.entries[len(sink.entries)-1].Elevated)
+
+	// only opsee admins, only on /admin/graphql, and only as users of the
+	// customer
+	entries := len(sink.entries)
+	assert.Contains(request(adminGraphQLPath, member, `{"query": "{ checks { id } }", `+actAs+`}`), `"code":"FORBIDDEN"`)
+	assert.Contains(request("/graphql", support, `{"query": "{ checks { id } }", `+actAs+`}`), `"code":"INVALID_ARGUMENT"`)
+	assert.Contains(request(adminGraphQLPath, support, `{"query": "{ checks { id } }", "extensions": {"actAs": {"customer_id": "opsee", "user_id": 2}}}`), `"code":"NOT_FOUND"`)
+	assert.Len(sink.entries, entries+3)
+
+	// results are withheld if they can't be audited
+	sink.err = errors.New("disk full")
+	body = request(adminGraphQLPath, support, `{"query": "{ checks { id } }", `+actAs+`}`)
+	assert.Contains(body, `"code":"INTERNAL"`)
+	assert.NotContains(body, "fake-check-2")
+}
@@ -0,0 +1,133 @@
+package composter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/julienschmidt/httprouter"
+	"github.com/opsee/basic/tp"
+	"github.com/opsee/compost/metrics"
+	"github.com/opsee/compost/tracing"
+	"golang.org/x/net/context"
+)
+
+var (
+	operationRequests = metrics.NewCounter(
+		"compost_graphql_requests_total",
+		"GraphQL operations by operation name and whether they returned errors.",
+		"operation", "status",
+	)
+	operationDuration = metrics.NewHistogram(
+		"compost_graphql_request_duration_seconds",
+		"GraphQL operation latency by operation name.",
+		metrics.DefaultBuckets,
+		"operation",
+	)
+	fieldRequests = metrics.NewCounter(
+		"compost_graphql_field_requests_total",
+		"Top level field resolves by field and whether they failed.",
+		"field", "status",
+	)
+	fieldDuration = metrics.NewHistogram(
+		"compost_graphql_field_duration_seconds",
+		"Top level field resolve latency by field.",
+		metrics.DefaultBuckets,
+		"field",
+	)
+)
+
+// operationLabels are the operation names that get series of their own, since
+// clients pick them: the named operations in the persisted queries file, and
+// the root fields of the schemas. Anything else is counted as other.
+type operationLabels map[string]bool
+
+func newOperationLabels(persisted *persistedQueries, schemas ...*graphql.Schema) operationLabels {
+	labels := make(operationLabels)
+	for name := range persisted.operationNames {
+		labels[name] = true
+	}
+
+	for _, schema := range schemas {
+		for _, root := range []*graphql.Object{schema.QueryType(), schema.MutationType()} {
+			if root == nil {
+				continue
+			}
+
+			for name := range root.Fields() {
+				labels[name] = true
+			}
+		}
+	}
+
+	return labels
+}
+
+// label is the label an operation is counted under.
+func (labels operationLabels) label(name string) string {
+	if name == "" {
+		return "anonymous"
+	}
+
+	if !labels[name] {
+		return "other"
+	}
+
+	return name
+}
+
+func observeOperation(label string, start time.Time, result *Result) {
+	status := "ok"
+	if result.HasErrors() {
+		status = "error"
+	}
+
+	operationRequests.Inc(label, status)
+	operationDuration.Since(start, label)
+}
+
+// timedResolve counts and times a top level field, labeled as Type.field.
+func timedResolve(field string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (result interface{}, err error) {
+		defer func(start time.Time) {
+			status := "ok"
+			if err != nil {
+				status = "error"
+			}
+
+			fieldRequests.Inc(field, status)
+			fieldDuration.Since(start, field)
+		}(time.Now())
+
+		return resolve(p)
+	}
+}
+
+// tracedResolve resolves a field in its own span, so backend calls made by the
+// resolver are its children.
+func tracedResolve(field string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if p.Context == nil {
+			return resolve(p)
+		}
+
+		span, ctx := tracing.StartSpan(p.Context, field)
+		p.Context = ctx
+
+		result, err := resolve(p)
+		span.Finish(err)
+
+		return result, err
+	}
+}
+
+// traceDecodeFunc continues the trace a client sent in a traceparent header.
+func traceDecodeFunc() tp.DecodeFunc {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request, p httprouter.Params) (context.Context, int, error) {
+		if traceparent := r.Header.Get(tracing.Header); traceparent != "" {
+			ctx = tracing.WithTraceparent(ctx, traceparent)
+		}
+
+		return ctx, 0, nil
+	}
+}
@@ -0,0 +1,124 @@
+package composter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/opsee/compost/fake"
+	"github.com/opsee/compost/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	client := fake.NewClient(fake.DefaultFixtures())
+	client.Instrument()
+
+	c, err := New(client, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "query checks { checks { id } }"}`)
+	testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "query listChecks { checks { id } }"}`)
+	testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "{ checks(id: \"nope\") { id } }"}`)
+
+	req, err := http.NewRequest("GET", "http://compost/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+
+	// other tests share the counters, so only check that each series is there
+	body := w.Body.String()
+	for _, series := range []string{
+		`compost_graphql_requests_total{operation="checks",status="ok"}`,
+		`compost_graphql_requests_total{operation="other",status="ok"}`,
+		`compost_graphql_requests_total{operation="anonymous",status="error"}`,
+		`compost_graphql_request_duration_seconds_count{operation="checks"}`,
+		`compost_graphql_field_requests_total{field="Query.checks",status="ok"}`,
+		`compost_graphql_field_requests_total{field="Query.checks",status="error"}`,
+		`compost_backend_requests_total{backend="bartnet",call="GET /gql/checks/:id",status="error"}`,
+	} {
+		assert.Regexp(regexp.QuoteMeta(series)+` \d+\n`, body)
+	}
+}
+
+func TestOperationLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := ioutil.TempFile("", "compost-queries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"checks": "query getChecks { checks { id } }", "anonymous": "{ team { name } }"}`)
+	f.Close()
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{PersistedQueriesFile: f.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// clients pick names, so only persisted ones and schema fields are kept
+	assert.Equal("anonymous", c.operationLabels.label(""))
+	assert.Equal("getChecks", c.operationLabels.label("getChecks"))
+	assert.Equal("checks", c.operationLabels.label("checks"))
+	assert.Equal("other", c.operationLabels.label("whatever"))
+}
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	tracing.SetExporter(tracing.NewWriterExporter(buf))
+	defer tracing.SetExporter(nil)
+
+	client := fake.NewClient(fake.DefaultFixtures())
+	client.Instrument()
+
+	c, err := New(client, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := newTestGraphQLRequest(t, "POST", "/graphql", `{"query": "query listChecks { checks { id } }"}`)
+	req.Header.Set(tracing.Header, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+
+	spans := make(map[string]*tracing.Span)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		span := &tracing.Span{}
+		if err := json.Unmarshal([]byte(line), span); err != nil {
+			t.Fatal(err)
+		}
+		spans[span.Name] = span
+	}
+
+	request, field, backend := spans["graphql"], spans["Query.checks"], spans["bartnet GET /gql/checks"]
+	if !assert.NotNil(request) || !assert.NotNil(field) || !assert.NotNil(backend) {
+		return
+	}
+
+	assert.Equal("0af7651916cd43dd8448eb211c80319c", request.TraceId)
+	assert.Equal("b7ad6b7169203331", request.ParentId)
+	assert.Equal("listChecks", request.Tags["operation"])
+	assert.Equal(request.SpanId, field.ParentId)
+	assert.Equal(field.SpanId, backend.ParentId)
+	assert.Equal(request.TraceId, backend.TraceId)
+}
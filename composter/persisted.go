@@ -0,0 +1,141 @@
+package composter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// clients that use automatic persisted queries (apollo) look for these
+// messages to decide whether to retry with the full query.
+var (
+	errPersistedQueryNotFound     = errors.New("PersistedQueryNotFound")
+	errPersistedQueryNotSupported = errors.New("PersistedQueryNotSupported")
+	errPersistedQueryHashMismatch = errors.New("provided sha256Hash does not match query")
+	errQueryNotPersisted          = errors.New("query is not in the persisted query registry")
+)
+
+// maxAutomaticPersistedQueries caps how many queries clients can register
+// themselves. Past that, queries still work but have to be sent in full.
+const maxAutomaticPersistedQueries = 10000
+
+// persistedQueries looks up queries by id or sha256 hash. Queries are loaded
+// from a file, and unless the registry is strict, clients may also register
+// queries by sending them along with their hash.
+type persistedQueries struct {
+	mut       sync.RWMutex
+	queries   map[string]string
+	automatic int
+	strict    bool
+
+	// operationNames are the names of the operations in the file.
+	operationNames map[string]bool
+}
+
+func newPersistedQueries(strict bool) *persistedQueries {
+	return &persistedQueries{
+		queries:        make(map[string]string),
+		strict:         strict,
+		operationNames: make(map[string]bool),
+	}
+}
+
+// loadPersistedQueries reads a json object of id to query from path. Each
+// query can be requested by its id or by the sha256 hash of the query.
+func loadPersistedQueries(path string, strict bool) (*persistedQueries, error) {
+	registry := newPersistedQueries(strict)
+
+	if path == "" {
+		return registry, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := make(map[string]string)
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("error parsing persisted queries %s: %s", path, err)
+	}
+
+	for id, query := range queries {
+		if query == "" {
+			return nil, fmt.Errorf("persisted query %s is empty", id)
+		}
+
+		registry.queries[id] = query
+		registry.queries[queryHash(query)] = query
+
+		// queries that don't parse are rejected when they're run
+		document, err := parser.Parse(parser.ParseParams{Source: query})
+		if err != nil {
+			continue
+		}
+
+		for _, definition := range document.Definitions {
+			if operation, ok := definition.(*ast.OperationDefinition); ok && operation.Name != nil {
+				registry.operationNames[operation.Name.Value] = true
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+// resolve returns the query to run for a request, registering it if the
+// client sent both a query and its hash.
+func (p *persistedQueries) resolve(request *GraphQLRequest) (string, error) {
+	if ext := request.Extensions; ext != nil && ext.PersistedQuery != nil && ext.PersistedQuery.Version != 1 {
+		return "", errPersistedQueryNotSupported
+	}
+
+	id := request.persistedQueryId()
+	hash := queryHash(request.Query)
+
+	if request.Query == "" {
+		p.mut.RLock()
+		query, ok := p.queries[id]
+		p.mut.RUnlock()
+
+		if !ok {
+			return "", errPersistedQueryNotFound
+		}
+
+		return query, nil
+	}
+
+	if request.Extensions != nil && request.Extensions.PersistedQuery != nil && request.Extensions.PersistedQuery.Sha256Hash != hash {
+		return "", errPersistedQueryHashMismatch
+	}
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if _, ok := p.queries[hash]; ok {
+		return request.Query, nil
+	}
+
+	if p.strict {
+		return "", errQueryNotPersisted
+	}
+
+	if id != "" && p.automatic < maxAutomaticPersistedQueries {
+		p.queries[hash] = request.Query
+		p.automatic++
+	}
+
+	return request.Query, nil
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
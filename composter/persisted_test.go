@@ -0,0 +1,69 @@
+package composter
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistedQueries(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := ioutil.TempFile("", "compost-queries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"checks": "{ checks { id } }"}`)
+	f.Close()
+
+	registry, err := loadPersistedQueries(f.Name(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := registry.resolve(&GraphQLRequest{Id: "checks"})
+	assert.NoError(err)
+	assert.Equal("{ checks { id } }", query)
+
+	query, err = registry.resolve(&GraphQLRequest{Extensions: persistedQueryExtensions(queryHash("{ checks { id } }"))})
+	assert.NoError(err)
+	assert.Equal("{ checks { id } }", query)
+
+	// automatic persisted queries are registered when sent with their hash
+	newQuery := "{ team { name } }"
+	_, err = registry.resolve(&GraphQLRequest{Extensions: persistedQueryExtensions(queryHash(newQuery))})
+	assert.Equal(errPersistedQueryNotFound, err)
+
+	_, err = registry.resolve(&GraphQLRequest{Query: newQuery, Extensions: persistedQueryExtensions("nope")})
+	assert.Equal(errPersistedQueryHashMismatch, err)
+
+	_, err = registry.resolve(&GraphQLRequest{Query: newQuery, Extensions: persistedQueryExtensions(queryHash(newQuery))})
+	assert.NoError(err)
+
+	query, err = registry.resolve(&GraphQLRequest{Extensions: persistedQueryExtensions(queryHash(newQuery))})
+	assert.NoError(err)
+	assert.Equal(newQuery, query)
+
+	// strict registries only run what's in the file
+	strict, err := loadPersistedQueries(f.Name(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = strict.resolve(&GraphQLRequest{Query: "{ checks { id } }"})
+	assert.NoError(err)
+
+	_, err = strict.resolve(&GraphQLRequest{Query: newQuery, Extensions: persistedQueryExtensions(queryHash(newQuery))})
+	assert.Equal(errQueryNotPersisted, err)
+
+	_, err = strict.resolve(&GraphQLRequest{Extensions: persistedQueryExtensions(queryHash(newQuery))})
+	assert.Equal(errPersistedQueryNotFound, err)
+}
+
+func persistedQueryExtensions(hash string) *GraphQLExtensions {
+	return &GraphQLExtensions{PersistedQuery: &PersistedQuery{Version: 1, Sha256Hash: hash}}
+}
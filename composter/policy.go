@@ -0,0 +1,210 @@
+package composter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/session"
+	"golang.org/x/net/context"
+)
+
+var errNotOpseeAdmin = errors.New("only opsee admins can do that")
+
+// policy is who may resolve a field: it returns an error for users who may
+// not.
+type policy func(user *schema.User) error
+
+var (
+	// authenticated lets any signed in user resolve a field, leaving anything
+	// finer to the resolver.
+	authenticated policy = func(user *schema.User) error { return nil }
+
+	// opseeAdmin only lets active opsee admins resolve a field.
+	opseeAdmin policy = func(user *schema.User) error {
+		if err := user.CheckActiveStatus(); err != nil {
+			return err
+		}
+
+		if !user.IsOpseeAdmin() {
+			return errNotOpseeAdmin
+		}
+
+		return nil
+	}
+)
+
+// tokenOpseeAdmin is whether the requestor is an opsee admin according to a
+// vape token. Basic user json isn't signed, so its admin flag isn't trusted
+// for anything outside of field policies, which are only opsee admin on
+// /admin/graphql.
+func tokenOpseeAdmin(ctx context.Context) bool {
+	if _, ok := ctx.Value(sessionKey).(*session.Session); !ok {
+		return false
+	}
+
+	user, ok := ctx.Value(userKey).(*schema.User)
+	return ok && user != nil && user.IsOpseeAdmin()
+}
+
+// anyOf lets active users with any of perms resolve a field. Opsee admins have
+// every perm.
+func anyOf(perms ...string) policy {
+	return func(user *schema.User) error {
+		var err error
+		for _, perm := range perms {
+			if err = user.CheckPermission(perm); err == nil {
+				return nil
+			}
+		}
+
+		return err
+	}
+}
+
+// fieldPolicies are who may resolve each field of the root types, and of the
+// objects that mutations nest more mutations in. mustSchema panics if any of
+// their fields is missing from here, so every field has to decide.
+var fieldPolicies = map[string]map[string]policy{
+	"Query": {
+		"checks":        authenticated,
+		"region":        authenticated,
+		"hasRole":       authenticated,
+		"role":          authenticated,
+		"team":          authenticated,
+		"notifications": authenticated,
+		"apiKeys":       anyOf("admin"),
+		"sessions":      authenticated,
+		"auditLog":      anyOf("admin"),
+		"userScopes":    anyOf("admin"),
+
+		// admin schema
+		"listCustomers":  opseeAdmin,
+		"getUser":        opseeAdmin,
+		"getCredentials": opseeAdmin,
+	},
+	"Mutation": {
+		"checks":                    anyOf("admin", "edit"),
+		"deleteChecks":              anyOf("admin", "edit"),
+		"testCheck":                 anyOf("admin", "edit"),
+		"makeLaunchRoleUrlTemplate": anyOf("admin", "edit"),
+		"makeLaunchRoleUrl":         anyOf("admin", "edit"),
+		"region":                    anyOf("admin", "edit"),
+		"team":                      anyOf("admin", "billing"),
+		"user":                      anyOf("admin"),
+		"notifications":             anyOf("admin", "edit"),
+		"createApiKey":              anyOf("admin"),
+		"revokeApiKey":              anyOf("admin"),
+		"revokeSession":             authenticated,
+		"revokeAllSessions":         authenticated,
+		"setUserScope":              anyOf("admin"),
+	},
+	"RegionMutation": {
+		"rebootInstances": anyOf("admin"),
+		"startInstances":  anyOf("admin"),
+		"stopInstances":   anyOf("admin"),
+		"scan":            anyOf("admin", "edit"),
+		"launchStack":     anyOf("admin", "edit"),
+	},
+	"Subscription": {
+		"checkStateChanged": authenticated,
+	},
+}
+
+// authorizeFields wraps the resolvers of every field in fieldPolicies with its
+// policy. It panics if a field has no policy, or a policy has no field.
+func authorizeFields(policies map[string]map[string]policy, schemas ...graphql.Schema) {
+	var (
+		authorized = make(map[*graphql.Object]bool)
+		used       = make(map[string]bool)
+	)
+
+	for _, s := range schemas {
+		for typeName, typ := range s.TypeMap() {
+			object, ok := typ.(*graphql.Object)
+			if !ok || authorized[object] {
+				continue
+			}
+
+			fields, ok := policies[typeName]
+			if !ok {
+				continue
+			}
+
+			for name, field := range object.Fields() {
+				p, ok := fields[name]
+				if !ok {
+					panic(fmt.Sprintf("no authorization policy for %s.%s", typeName, name))
+				}
+				used[typeName+"."+name] = true
+
+				if field.Resolve == nil {
+					panic(fmt.Sprintf("%s.%s has an authorization policy but no resolver", typeName, name))
+				}
+
+				args := graphql.FieldConfigArgument{}
+				for _, arg := range field.Args {
+					args[arg.Name()] = &graphql.ArgumentConfig{
+						Type:         arg.Type,
+						DefaultValue: arg.DefaultValue,
+						Description:  arg.Description(),
+					}
+				}
+
+				object.AddFieldConfig(name, &graphql.Field{
+					Name:              field.Name,
+					Description:       field.Description,
+					Type:              field.Type,
+					Args:              args,
+					Resolve:           authorizedResolve(p, field.Resolve),
+					DeprecationReason: field.DeprecationReason,
+				})
+			}
+
+			authorized[object] = true
+		}
+	}
+
+	var unused []string
+	for typeName, fields := range policies {
+		for name := range fields {
+			if !used[typeName+"."+name] {
+				unused = append(unused, typeName+"."+name)
+			}
+		}
+	}
+
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		panic(fmt.Sprintf("authorization policies for fields that don't exist: %s", strings.Join(unused, ", ")))
+	}
+}
+
+func authorizedResolve(p policy, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		user, ok := params.Context.Value(userKey).(*schema.User)
+		if !ok || user == nil {
+			return nil, errDecodeUser
+		}
+
+		if err := p(user); err != nil {
+			return nil, forbidden(err)
+		}
+
+		return resolve(params)
+	}
+}
+
+// requestorFromContext is the user making the request. Their permissions are
+// checked by field policies, before resolvers run.
+func requestorFromContext(ctx context.Context) (*schema.User, error) {
+	user, ok := ctx.Value(userKey).(*schema.User)
+	if !ok || user == nil {
+		return nil, errDecodeUser
+	}
+
+	return user, nil
+}
@@ -0,0 +1,70 @@
+package composter
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldPolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	client := fake.NewClient(fake.DefaultFixtures())
+	c, err := New(client, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nested mutations are checked too
+	body := testUserRequest(t, c, 2, `{"edit": true}`, `{"query": "mutation reboot { region(id: \"us-west-2\") { rebootInstances(ids: [\"i-fa7e0001\"]) } }"}`)
+	assert.Contains(body, `"code":"FORBIDDEN"`)
+	assert.Empty(client.EC2.(*fake.EC2).Actions())
+
+	// team admins pass "any of admin, edit" without edit
+	body = testUserRequest(t, c, 2, `{"admin": true}`, `{"query": "mutation remove { deleteChecks(ids: [\"fake-check-1\"]) { id } }"}`)
+	assert.NotContains(body, "errors")
+
+	body = testUserRequest(t, c, 2, `{}`, `{"query": "{ checks { id } }"}`)
+	assert.Contains(body, "fake-check-2")
+
+	body = testUserRequest(t, c, 2, `{"edit": true}`, `{"query": "mutation team { team(team: {name: \"nope\"}) { name } }"}`)
+	assert.Contains(body, `"code":"FORBIDDEN"`)
+}
+
+func TestAuthorizeFields(t *testing.T) {
+	assert := assert.New(t)
+
+	newSchema := func() graphql.Schema {
+		schema, err := graphql.NewSchema(graphql.SchemaConfig{
+			Query: graphql.NewObject(graphql.ObjectConfig{
+				Name: "Query",
+				Fields: graphql.Fields{
+					"ping": &graphql.Field{
+						Type: graphql.String,
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							return "pong", nil
+						},
+					},
+				},
+			}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return schema
+	}
+
+	assert.Panics(func() {
+		authorizeFields(map[string]map[string]policy{"Query": {}}, newSchema())
+	})
+
+	assert.Panics(func() {
+		authorizeFields(map[string]map[string]policy{"Query": {"ping": authenticated, "pong": authenticated}}, newSchema())
+	})
+
+	assert.NotPanics(func() {
+		authorizeFields(map[string]map[string]policy{"Query": {"ping": authenticated}}, newSchema())
+	})
+}
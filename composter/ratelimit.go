@@ -0,0 +1,398 @@
+package composter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/julienschmidt/httprouter"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/basic/tp"
+	"github.com/opsee/compost/apikey"
+	"github.com/opsee/compost/metrics"
+	log "github.com/opsee/logrus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultPlan is the rate limit for plans without their own.
+	defaultPlan = "default"
+
+	// mutationCost is added to the cost of every mutation, since they write
+	// to backends (and aws, for instance actions).
+	mutationCost = 25
+
+	// planCacheTTL is how long a customer's plan is cached before asking cats
+	// again.
+	planCacheTTL = 5 * time.Minute
+
+	// rateLimiterSweepInterval is how often full buckets and expired plans are
+	// dropped, so that customers and users who've gone away don't pile up.
+	rateLimiterSweepInterval = time.Minute
+)
+
+var (
+	errTooManyConcurrent = errors.New("too many requests in flight for this customer, try again shortly")
+	errNegativeRateLimit = errors.New("rate limits can't be negative")
+
+	// defaultRateLimits apply if none are configured.
+	defaultRateLimits = map[string]*RateLimit{
+		defaultPlan: &RateLimit{
+			CustomerRate:  200,
+			CustomerBurst: 2000,
+			UserRate:      100,
+			UserBurst:     1000,
+			MaxConcurrent: 20,
+		},
+	}
+
+	rateLimited = metrics.NewCounter(
+		"compost_rate_limited_total",
+		"GraphQL requests rejected by rate limits, by plan and reason.",
+		"plan", "reason",
+	)
+)
+
+// RateLimit limits a customer's and each of its users' query cost per second
+// with token buckets, and how many requests the customer can have in flight.
+// A zero rate or MaxConcurrent turns that limit off.
+type RateLimit struct {
+	// CustomerRate is the cost a customer's buckets refill per second, and
+	// CustomerBurst is how much it can spend at once.
+	CustomerRate  float64 `json:"customer_rate"`
+	CustomerBurst float64 `json:"customer_burst"`
+
+	// UserRate and UserBurst are the same, for each user.
+	UserRate  float64 `json:"user_rate"`
+	UserBurst float64 `json:"user_burst"`
+
+	MaxConcurrent int `json:"max_concurrent"`
+}
+
+func (limit *RateLimit) Validate() error {
+	if limit.CustomerRate < 0 || limit.CustomerBurst < 0 || limit.UserRate < 0 || limit.UserBurst < 0 || limit.MaxConcurrent < 0 {
+		return errNegativeRateLimit
+	}
+
+	return nil
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate per second.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+
+	// full is when the bucket will have refilled, after which it's no
+	// different from a new one.
+	full time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+}
+
+func (b *tokenBucket) spend(cost, rate, burst float64) {
+	b.tokens -= cost
+	b.full = b.last.Add(time.Duration((burst - b.tokens) / rate * float64(time.Second)))
+}
+
+type cachedPlan struct {
+	plan    string
+	expires time.Time
+}
+
+// rateLimiter tracks the buckets, in flight requests and plans of every
+// customer and user.
+type rateLimiter struct {
+	mut      sync.Mutex
+	limits   map[string]*RateLimit
+	buckets  map[string]*tokenBucket
+	inFlight map[string]int
+	plans    map[string]cachedPlan
+	swept    time.Time
+	now      func() time.Time
+}
+
+func newRateLimiter(limits map[string]*RateLimit) (*rateLimiter, error) {
+	if len(limits) == 0 {
+		limits = defaultRateLimits
+	}
+
+	for plan, limit := range limits {
+		if limit == nil {
+			return nil, fmt.Errorf("rate limit for plan %s is empty", plan)
+		}
+
+		if err := limit.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", err, plan)
+		}
+	}
+
+	if _, ok := limits[defaultPlan]; !ok {
+		return nil, fmt.Errorf("rate limits must include a %s plan", defaultPlan)
+	}
+
+	return &rateLimiter{
+		limits:   limits,
+		buckets:  make(map[string]*tokenBucket),
+		inFlight: make(map[string]int),
+		plans:    make(map[string]cachedPlan),
+		now:      time.Now,
+	}, nil
+}
+
+// limit returns the rate limit for plan.
+func (r *rateLimiter) limit(plan string) *RateLimit {
+	if limit, ok := r.limits[plan]; ok {
+		return limit
+	}
+
+	return r.limits[defaultPlan]
+}
+
+// perPlan is whether any plan has its own limits, otherwise there's no need to
+// look plans up.
+func (r *rateLimiter) perPlan() bool {
+	return len(r.limits) > 1
+}
+
+// acquire takes one of the customer's in flight slots, returning a func that
+// gives it back, or false if they're all taken.
+func (r *rateLimiter) acquire(customerId string, max int) (func(), bool) {
+	if max == 0 {
+		return func() {}, true
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.inFlight[customerId] >= max {
+		return nil, false
+	}
+	r.inFlight[customerId]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mut.Lock()
+			r.inFlight[customerId]--
+			if r.inFlight[customerId] == 0 {
+				delete(r.inFlight, customerId)
+			}
+			r.mut.Unlock()
+		})
+	}, true
+}
+
+// userBucket is the key of the requestor's user bucket. Requests made with an
+// api key all act as the same user, so each key gets a bucket of its own.
+func userBucket(ctx context.Context, user *schema.User) string {
+	if key, ok := ctx.Value(apiKeyKey).(*apikey.Key); ok {
+		return fmt.Sprintf("apikey:%s:%s", user.CustomerId, key.Id)
+	}
+
+	return fmt.Sprintf("user:%s:%d", user.CustomerId, user.Id)
+}
+
+// take spends cost from both the customer's bucket and the user bucket
+// userKey, or if either is short, spends nothing and returns how long until
+// both would have enough. A cost larger than a bucket's burst only needs a full
+// bucket.
+func (r *rateLimiter) take(limit *RateLimit, customerId, userKey string, cost float64) (time.Duration, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	now := r.now()
+	if now.Sub(r.swept) >= rateLimiterSweepInterval {
+		r.sweep(now)
+	}
+
+	limits := []struct {
+		key         string
+		rate, burst float64
+	}{
+		{key: "customer:" + customerId, rate: limit.CustomerRate, burst: limit.CustomerBurst},
+		{key: userKey, rate: limit.UserRate, burst: limit.UserBurst},
+	}
+
+	var (
+		buckets = make([]*tokenBucket, len(limits))
+		wait    time.Duration
+	)
+
+	for i, l := range limits {
+		if l.rate == 0 {
+			continue
+		}
+
+		bucket, ok := r.buckets[l.key]
+		if !ok {
+			bucket = &tokenBucket{tokens: l.burst, last: now}
+			r.buckets[l.key] = bucket
+		}
+		bucket.refill(now, l.rate, l.burst)
+		buckets[i] = bucket
+
+		need := math.Min(cost, l.burst)
+		if bucket.tokens < need {
+			if w := time.Duration((need - bucket.tokens) / l.rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+
+	if wait > 0 {
+		return wait, false
+	}
+
+	for i, bucket := range buckets {
+		if bucket != nil {
+			bucket.spend(math.Min(cost, limits[i].burst), limits[i].rate, limits[i].burst)
+		}
+	}
+
+	return 0, true
+}
+
+// sweep drops buckets that have refilled and plans that have expired. It must
+// be called with the lock held.
+func (r *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range r.buckets {
+		if !now.Before(bucket.full) {
+			delete(r.buckets, key)
+		}
+	}
+
+	for customerId, cached := range r.plans {
+		if !now.Before(cached.expires) {
+			delete(r.plans, customerId)
+		}
+	}
+
+	r.swept = now
+}
+
+// plan returns the customer's subscription plan, cached for planCacheTTL. If
+// cats can't be reached, the default plan is used.
+func (s *Composter) plan(ctx context.Context, user *schema.User) string {
+	if !s.rateLimiter.perPlan() {
+		return defaultPlan
+	}
+
+	s.rateLimiter.mut.Lock()
+	cached, ok := s.rateLimiter.plans[user.CustomerId]
+	s.rateLimiter.mut.Unlock()
+
+	now := s.rateLimiter.now()
+	if ok && now.Before(cached.expires) {
+		return cached.plan
+	}
+
+	team, err := s.resolver.GetTeam(ctx, user)
+	if err != nil {
+		log.WithError(err).Warn("error getting plan for rate limits, using the default")
+		return defaultPlan
+	}
+
+	s.rateLimiter.mut.Lock()
+	s.rateLimiter.plans[user.CustomerId] = cachedPlan{plan: team.SubscriptionPlan, expires: now.Add(planCacheTTL)}
+	s.rateLimiter.mut.Unlock()
+
+	return team.SubscriptionPlan
+}
+
+// requestCost is the rate limit cost of the request or batch in the context:
+// its complexity cost, plus mutationCost for each mutation. Queries that don't
+// parse cost 1, and are rejected when they're run.
+func (s *Composter) requestCost(ctx context.Context, schema *graphql.Schema) float64 {
+	var requests []*GraphQLRequest
+	switch request := ctx.Value(requestKey).(type) {
+	case *GraphQLRequest:
+		requests = []*GraphQLRequest{request}
+	case GraphQLBatch:
+		requests = request
+	}
+
+	cost := 0
+	for _, request := range requests {
+		cost += s.operationCost(schema, request)
+	}
+
+	return float64(cost)
+}
+
+func (s *Composter) operationCost(schema *graphql.Schema, request *GraphQLRequest) int {
+	query, err := s.persistedQueries.resolve(request)
+	if err != nil {
+		return 1
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return 1
+	}
+
+	operation, err := operationDefinition(document, request.OperationName)
+	if err != nil {
+		return 1
+	}
+
+	cost := analyzeComplexity(schema, document, request.OperationName).cost
+	if operation.Operation == "mutation" {
+		cost = saturatingAdd(cost, mutationCost)
+	}
+
+	if cost < 1 {
+		cost = 1
+	}
+
+	return cost
+}
+
+// rateLimitDecodeFunc rejects requests with a 429 and Retry-After when the
+// user's customer has too many requests in flight, or the customer or user
+// has spent their query cost. It must come after the request is decoded.
+func (s *Composter) rateLimitDecodeFunc() tp.DecodeFunc {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request, p httprouter.Params) (context.Context, int, error) {
+		user, ok := ctx.Value(userKey).(*schema.User)
+		if !ok {
+			// the handler rejects these
+			return ctx, 0, nil
+		}
+
+		plan := s.plan(ctx, user)
+		limit := s.rateLimiter.limit(plan)
+
+		release, ok := s.rateLimiter.acquire(user.CustomerId, limit.MaxConcurrent)
+		if !ok {
+			rateLimited.Inc(plan, "concurrency")
+			rw.Header().Set("Retry-After", "1")
+			return ctx, http.StatusTooManyRequests, errTooManyConcurrent
+		}
+
+		// tp cancels the context once the response is written
+		go func() {
+			<-ctx.Done()
+			release()
+		}()
+
+		wait, ok := s.rateLimiter.take(limit, user.CustomerId, userBucket(ctx, user), s.requestCost(ctx, &s.Schema))
+		if !ok {
+			release()
+
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			rateLimited.Inc(plan, "cost")
+			rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			return ctx, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded, retry in %ds", retryAfter)
+		}
+
+		return ctx, 0, nil
+	}
+}
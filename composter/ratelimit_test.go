@@ -0,0 +1,159 @@
+package composter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/apikey"
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter, err := newRateLimiter(map[string]*RateLimit{
+		defaultPlan: &RateLimit{CustomerRate: 10, CustomerBurst: 20, UserRate: 100, UserBurst: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	limit := limiter.limit("anything")
+
+	_, ok := limiter.take(limit, "customer", "user:customer:1", 15)
+	assert.True(ok)
+
+	wait, ok := limiter.take(limit, "customer", "user:customer:2", 10)
+	assert.False(ok)
+	assert.Equal(500*time.Millisecond, wait)
+
+	now = now.Add(500 * time.Millisecond)
+	_, ok = limiter.take(limit, "customer", "user:customer:2", 10)
+	assert.True(ok)
+
+	// too big for the bucket, so it needs the whole thing
+	now = now.Add(2 * time.Second)
+	_, ok = limiter.take(limit, "customer", "user:customer:1", 50)
+	assert.True(ok)
+	_, ok = limiter.take(limit, "customer", "user:customer:1", 1)
+	assert.False(ok)
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter, err := newRateLimiter(map[string]*RateLimit{
+		defaultPlan: &RateLimit{CustomerRate: 10, CustomerBurst: 20, UserRate: 1, UserBurst: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	limit := limiter.limit("anything")
+
+	_, ok := limiter.take(limit, "customer", "user:customer:1", 100)
+	assert.True(ok)
+	limiter.plans["customer"] = cachedPlan{plan: "free", expires: now.Add(planCacheTTL)}
+	assert.Len(limiter.buckets, 2)
+
+	// the customer's bucket has refilled, the user's hasn't
+	now = now.Add(rateLimiterSweepInterval)
+	_, ok = limiter.take(limit, "other", "user:other:2", 0)
+	assert.True(ok)
+	assert.Contains(limiter.buckets, "user:customer:1")
+	assert.NotContains(limiter.buckets, "customer:customer")
+	assert.Contains(limiter.plans, "customer")
+
+	now = now.Add(planCacheTTL)
+	_, ok = limiter.take(limit, "other", "user:other:2", 0)
+	assert.True(ok)
+	assert.NotContains(limiter.buckets, "user:customer:1")
+	assert.Empty(limiter.plans)
+}
+
+func TestUserBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &schema.User{Id: -1, CustomerId: "customer"}
+	ctx := context.Background()
+	assert.Equal("user:customer:-1", userBucket(ctx, user))
+
+	// every api key acts as user -1, but has a bucket of its own
+	assert.Equal("apikey:customer:key-1", userBucket(context.WithValue(ctx, apiKeyKey, &apikey.Key{Id: "key-1"}), user))
+	assert.Equal("apikey:customer:key-2", userBucket(context.WithValue(ctx, apiKeyKey, &apikey.Key{Id: "key-2"}), user))
+}
+
+func TestRateLimiterAcquire(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter, err := newRateLimiter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, ok := limiter.acquire("customer", 1)
+	assert.True(ok)
+
+	_, ok = limiter.acquire("customer", 1)
+	assert.False(ok)
+
+	_, ok = limiter.acquire("other", 1)
+	assert.True(ok)
+
+	release()
+	release()
+	_, ok = limiter.acquire("customer", 1)
+	assert.True(ok)
+	assert.Equal(1, limiter.inFlight["customer"])
+
+	_, err = newRateLimiter(map[string]*RateLimit{"team_beta": &RateLimit{}})
+	assert.Error(err)
+
+	_, err = newRateLimiter(map[string]*RateLimit{defaultPlan: &RateLimit{UserRate: -1}})
+	assert.Error(err)
+}
+
+func TestOperationCost(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(1, c.operationCost(&c.Schema, &GraphQLRequest{Query: "{ checks { id } }"}))
+	assert.Equal(1+mutationCost, c.operationCost(&c.Schema, &GraphQLRequest{Query: `mutation remove { deleteChecks(ids: ["a"]) { id } }`}))
+	assert.Equal(1, c.operationCost(&c.Schema, &GraphQLRequest{Query: "{ nope"}))
+}
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{
+		RateLimits: map[string]*RateLimit{
+			defaultPlan: &RateLimit{CustomerRate: 1000, CustomerBurst: 1000},
+			"team_beta": &RateLimit{CustomerRate: 1, CustomerBurst: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		w := testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "{ checks { id } }"}`)
+		assert.Equal(http.StatusOK, w.Code)
+	}
+
+	w := testGraphQLRequest(t, c, "POST", "/graphql", `{"query": "{ checks { id } }"}`)
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+	assert.Contains(w.Body.String(), "rate limit exceeded")
+}
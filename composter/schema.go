@@ -7,8 +7,6 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/net/context"
-
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/graphql-go/graphql"
 	"github.com/opsee/basic/schema"
@@ -19,6 +17,7 @@ import (
 	opsee_aws_elb "github.com/opsee/basic/schema/aws/elb"
 	opsee_aws_rds "github.com/opsee/basic/schema/aws/rds"
 	opsee "github.com/opsee/basic/service"
+	"github.com/opsee/compost/resolver"
 	log "github.com/opsee/logrus"
 	opsee_types "github.com/opsee/protobuf/opseeproto/types"
 	opsee_scalars "github.com/opsee/protobuf/plugin/graphql/scalars"
@@ -52,6 +51,10 @@ var (
 	EcsServiceType *graphql.Object
 	CheckType      *graphql.Object
 
+	ErrorType             *graphql.Object
+	CheckResultType       *graphql.Object
+	DeleteCheckResultType *graphql.Object
+
 	CheckInputType        *graphql.InputObject
 	TeamInputType         *graphql.InputObject
 	UserInputType         *graphql.InputObject
@@ -68,44 +71,6 @@ const (
 	instanceStop
 )
 
-type PermissionOp struct {
-	op   string
-	perm string
-}
-
-func (p PermissionOp) Op(user *schema.User, has error) error {
-	switch p.op {
-	case "and":
-		if has != nil {
-			return has
-		}
-		return user.CheckPermission(p.perm)
-	case "or":
-		has = user.CheckPermission(p.perm)
-	default:
-		return fmt.Errorf("invalid op: %s", p.op)
-	}
-	return has
-}
-
-func UserPermittedFromContext(ctx context.Context, perm string, extra ...PermissionOp) (*schema.User, error) {
-	log.Debugf("checking permission %v for context %v", ctx, perm)
-	user, ok := ctx.Value(userKey).(*schema.User)
-	if !ok || user == nil {
-		return nil, errDecodeUser
-	}
-
-	has := user.CheckPermission(perm)
-	for _, op := range extra {
-		has = op.Op(user, has)
-		if has != nil {
-			return user, has
-		}
-	}
-
-	return user, has
-}
-
 func (c *Composter) mustSchema() {
 	c.initTypes()
 
@@ -127,11 +92,29 @@ func (c *Composter) mustSchema() {
 		panic(fmt.Sprint("error generating graphql schema: ", err))
 	}
 
+	subscriptionSchema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: c.subscription(),
+	})
+
+	if err != nil {
+		panic(fmt.Sprint("error generating graphql schema: ", err))
+	}
+
+	authorizeFields(fieldPolicies, schema, adminSchema, subscriptionSchema)
+	c.auditMutations(schema, adminSchema)
+	wrapResolvers(schema, adminSchema, subscriptionSchema)
+
 	c.Schema = schema
 	c.AdminSchema = adminSchema
+	c.SubscriptionSchema = subscriptionSchema
 }
 
 func (c *Composter) initTypes() {
+	initScopeTypes()
+	initApiKeyTypes()
+	initSessionTypes()
+	initAuditTypes()
+
 	if UserStatusEnumType == nil {
 		UserStatusEnumType = graphql.NewEnum(graphql.EnumConfig{
 			Name: "UserStatus",
@@ -257,6 +240,82 @@ func (c *Composter) initTypes() {
 		addFields(CheckType, schema.GraphQLCheckType.Fields())
 	}
 
+	if ErrorType == nil {
+		ErrorType = graphql.NewObject(graphql.ObjectConfig{
+			Name:        "MutationError",
+			Description: "An error from one item of a mutation, coded as in graphql error extensions",
+			Fields: graphql.Fields{
+				"message": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*Error).Message, nil
+					},
+				},
+				"code": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return string(p.Source.(*Error).Code), nil
+					},
+				},
+				"backend": &graphql.Field{
+					Type:        graphql.String,
+					Description: "The backend that failed, if any",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*Error).Backend, nil
+					},
+				},
+			},
+		})
+	}
+
+	if CheckResultType == nil {
+		CheckResultType = graphql.NewObject(graphql.ObjectConfig{
+			Name:        "CheckResult",
+			Description: "The outcome of upserting one check",
+			Fields: graphql.Fields{
+				"check": &graphql.Field{
+					Type: CheckType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						check := p.Source.(*resolver.CheckResult).Check
+						if check == nil {
+							return nil, nil
+						}
+						return check, nil
+					},
+				},
+				"error": &graphql.Field{
+					Type:    ErrorType,
+					Resolve: resolveResultError,
+				},
+			},
+		})
+	}
+
+	if DeleteCheckResultType == nil {
+		DeleteCheckResultType = graphql.NewObject(graphql.ObjectConfig{
+			Name:        "DeleteCheckResult",
+			Description: "The outcome of deleting one check",
+			Fields: graphql.Fields{
+				"id": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*resolver.DeleteCheckResult).Id, nil
+					},
+				},
+				"deleted": &graphql.Field{
+					Type: graphql.Boolean,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*resolver.DeleteCheckResult).Deleted, nil
+					},
+				},
+				"error": &graphql.Field{
+					Type:    ErrorType,
+					Resolve: resolveResultError,
+				},
+			},
+		})
+	}
+
 	if TeamInputType == nil {
 		TeamInputType = graphql.NewInputObject(graphql.InputObjectConfig{
 			Name:        "Team",
@@ -502,6 +561,10 @@ func (c *Composter) query() *graphql.Object {
 			"role":          c.queryRole(),
 			"team":          c.queryTeam(),
 			"notifications": c.queryNotifications(),
+			"apiKeys":       c.queryApiKeys(),
+			"sessions":      c.querySessions(),
+			"auditLog":      c.queryAuditLog(),
+			"userScopes":    c.queryUserScopes(),
 		},
 	})
 
@@ -652,6 +715,10 @@ func (c *Composter) adminQuery() *graphql.Object {
 			"role":          c.queryRole(),
 			"team":          c.queryTeam(),
 			"notifications": c.queryNotifications(),
+			"apiKeys":       c.queryApiKeys(),
+			"sessions":      c.querySessions(),
+			"auditLog":      c.queryAuditLog(),
+			"userScopes":    c.queryUserScopes(),
 			"listCustomers": &graphql.Field{
 				Type: opsee.GraphQLListCustomersResponseType,
 				Args: graphql.FieldConfigArgument{
@@ -665,7 +732,7 @@ func (c *Composter) adminQuery() *graphql.Object {
 					},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					requestor, err := UserPermittedFromContext(p.Context, opsee_types.OpseeAdmin)
+					requestor, err := requestorFromContext(p.Context)
 					if err != nil {
 						return nil, err
 					}
@@ -702,7 +769,7 @@ func (c *Composter) adminQuery() *graphql.Object {
 					},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					requestor, err := UserPermittedFromContext(p.Context, opsee_types.OpseeAdmin)
+					requestor, err := requestorFromContext(p.Context)
 					if err != nil {
 						return nil, err
 					}
@@ -878,6 +945,10 @@ func (c *Composter) queryRegion() *graphql.Field {
 
 			queryContext.Region = region
 
+			if _, err := c.scopedQueryContext(p.Context); err != nil {
+				return nil, err
+			}
+
 			return struct{}{}, nil
 		},
 	}
@@ -898,9 +969,9 @@ func (c *Composter) queryTaskDefinition() *graphql.Field {
 				return nil, errDecodeUser
 			}
 
-			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			queryContext, err := c.scopedQueryContext(p.Context)
+			if err != nil {
+				return nil, err
 			}
 
 			id, _ := p.Args["id"].(string)
@@ -947,6 +1018,10 @@ func (c *Composter) queryVpc() *graphql.Field {
 
 			queryContext.VpcId = vpc
 
+			if _, err := c.scopedQueryContext(p.Context); err != nil {
+				return nil, err
+			}
+
 			return struct{}{}, nil
 		},
 	}
@@ -993,9 +1068,9 @@ func (c *Composter) queryGroups() *graphql.Field {
 				return nil, errDecodeUser
 			}
 
-			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			queryContext, err := c.scopedQueryContext(p.Context)
+			if err != nil {
+				return nil, err
 			}
 
 			groupId, _ := p.Args["id"].(string)
@@ -1047,9 +1122,9 @@ func (c *Composter) queryInstances() *graphql.Field {
 				return nil, errDecodeUser
 			}
 
-			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			queryContext, err := c.scopedQueryContext(p.Context)
+			if err != nil {
+				return nil, err
 			}
 
 			instanceId, _ := p.Args["id"].(string)
@@ -1074,14 +1149,14 @@ func (c *Composter) instanceAction(action instanceAction) *graphql.Field {
 			},
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			requestor, err := UserPermittedFromContext(p.Context, "admin")
+			requestor, err := requestorFromContext(p.Context)
 			if err != nil {
 				return nil, err
 			}
 			user := requestor
-			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			queryContext, err := c.scopedQueryContext(p.Context)
+			if err != nil {
+				return nil, err
 			}
 
 			var ids []string
@@ -1099,6 +1174,10 @@ func (c *Composter) instanceAction(action instanceAction) *graphql.Field {
 				ids = append(ids, idstr)
 			}
 
+			if err := c.requireScopedInstances(p.Context, user, queryContext.Region, ids); err != nil {
+				return nil, err
+			}
+
 			switch action {
 			case instanceReboot:
 				err = c.resolver.RebootInstances(p.Context, user, queryContext.Region, ids)
@@ -1243,9 +1322,8 @@ func (c *Composter) queryMetrics() *graphql.Field {
 				return nil, errDecodeUser
 			}
 
-			_, ok = p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			if _, err := c.scopedQueryContext(p.Context); err != nil {
+				return nil, err
 			}
 
 			var (
@@ -1324,9 +1402,9 @@ func (c *Composter) queryMetricName(metricName string) *graphql.Field {
 				return nil, errDecodeUser
 			}
 
-			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			queryContext, err := c.scopedQueryContext(p.Context)
+			if err != nil {
+				return nil, err
 			}
 
 			input, ok := p.Source.(*opsee_aws_cloudwatch.GetMetricStatisticsInput)
@@ -1354,6 +1432,11 @@ func (c *Composter) mutation() *graphql.Object {
 			"team":                      c.mutateTeam(),
 			"user":                      c.mutateUser(),
 			"notifications":             c.mutateNotifications(),
+			"createApiKey":              c.createApiKey(),
+			"revokeApiKey":              c.revokeApiKey(),
+			"revokeSession":             c.revokeSession(),
+			"revokeAllSessions":         c.revokeAllSessions(),
+			"setUserScope":              c.setUserScope(),
 		},
 	})
 
@@ -1370,7 +1453,7 @@ func (c *Composter) mutateNotifications() *graphql.Field {
 			},
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			requestor, err := UserPermittedFromContext(p.Context, "admin", PermissionOp{"or", "edit"})
+			requestor, err := requestorFromContext(p.Context)
 			if err != nil {
 				return nil, err
 			}
@@ -1395,7 +1478,7 @@ func (c *Composter) mutateTeam() *graphql.Field {
 			},
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			requestor, err := UserPermittedFromContext(p.Context, "admin", PermissionOp{"or", "billing"})
+			requestor, err := requestorFromContext(p.Context)
 			if err != nil {
 				return nil, err
 			}
@@ -1425,7 +1508,7 @@ func (c *Composter) mutateUser() *graphql.Field {
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			// TODO(dan) only admins mutate users rn
-			requestor, err := UserPermittedFromContext(p.Context, "admin")
+			requestor, err := requestorFromContext(p.Context)
 			if err != nil {
 				return nil, err
 			}
@@ -1455,6 +1538,10 @@ func (c *Composter) mutateUser() *graphql.Field {
 
 			// invites
 			if newUser.Id == 0 && newUser.Email != "" && newUser.Perms != nil {
+				if err := c.requireCapability(p.Context, requestor, capabilityMultiUser); err != nil {
+					return nil, err
+				}
+
 				req := &opsee.InviteUserRequest{
 					Requestor: requestor,
 					Email:     newUser.Email,
@@ -1477,7 +1564,20 @@ func (c *Composter) mutateUser() *graphql.Field {
 				Password: password,
 			}
 
-			return c.resolver.PutUser(p.Context, req)
+			user, err := c.resolver.PutUser(p.Context, req)
+			if err != nil {
+				return nil, err
+			}
+
+			// tokens carry the user's status and perms, so removing a user
+			// or changing what they can do has to revoke the tokens they have
+			if newUser.Status == "inactive" || (newUser.Perms != nil && newUser.Id != requestor.Id) {
+				if err := c.revokeUserSessions(p.Context, requestor.CustomerId, newUser.Id); err != nil {
+					return nil, err
+				}
+			}
+
+			return user, nil
 		},
 	}
 }
@@ -1503,11 +1603,6 @@ func (c *Composter) mutateRegion() *graphql.Field {
 			},
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			_, err := UserPermittedFromContext(p.Context, "admin", PermissionOp{"or", "edit"})
-			if err != nil {
-				return nil, err
-			}
-
 			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
 			if !ok {
 				return nil, errDecodeQueryContext
@@ -1520,6 +1615,10 @@ func (c *Composter) mutateRegion() *graphql.Field {
 
 			queryContext.Region = region
 
+			if _, err := c.scopedQueryContext(p.Context); err != nil {
+				return nil, err
+			}
+
 			return struct{}{}, nil
 		},
 	}
@@ -1552,9 +1651,9 @@ func (c *Composter) launchStack() *graphql.Field {
 				return nil, errDecodeUser
 			}
 
-			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			queryContext, err := c.scopedQueryContext(p.Context)
+			if err != nil {
+				return nil, err
 			}
 
 			if queryContext.Region == "" {
@@ -1569,6 +1668,19 @@ func (c *Composter) launchStack() *graphql.Field {
 				instanceSize = "t2.micro"
 			}
 
+			s, err := c.scope(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			if !s.AllowsVpc(queryContext.Region, vpcId) {
+				return nil, forbidden(fmt.Errorf("vpc %s is outside your scope", vpcId))
+			}
+
+			if err := c.requireBastionCapacity(p.Context, user); err != nil {
+				return nil, err
+			}
+
 			return c.resolver.LaunchBastionStack(p.Context, user, queryContext.Region, vpcId, subnetId, subnetRouting, instanceSize)
 		},
 	}
@@ -1583,16 +1695,21 @@ func (c *Composter) scanRegion() *graphql.Field {
 				return nil, errDecodeUser
 			}
 
-			queryContext, ok := p.Context.Value(queryContextKey).(*QueryContext)
-			if !ok {
-				return nil, errDecodeQueryContext
+			queryContext, err := c.scopedQueryContext(p.Context)
+			if err != nil {
+				return nil, err
 			}
 
 			if queryContext.Region == "" {
 				return nil, errMissingRegion
 			}
 
-			return c.resolver.ScanRegion(p.Context, user, queryContext.Region)
+			region, err := c.resolver.ScanRegion(p.Context, user, queryContext.Region)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.scopeRegion(p.Context, region)
 		},
 	}
 }
@@ -1639,20 +1756,18 @@ func (c *Composter) makeLaunchRoleUrl() *graphql.Field {
 
 func (c *Composter) upsertChecks() *graphql.Field {
 	return &graphql.Field{
-		Type: graphql.NewList(CheckType),
+		Type: graphql.NewList(CheckResultType),
 		Args: graphql.FieldConfigArgument{
 			"checks": &graphql.ArgumentConfig{
 				Description: "A list of checks to create",
 				Type:        graphql.NewList(CheckInputType),
 			},
+			"atomic": &graphql.ArgumentConfig{
+				Description: "Delete the created checks and stop if any check fails",
+				Type:        graphql.Boolean,
+			},
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			// must have admin or edit to upsert checks
-			_, err := UserPermittedFromContext(p.Context, "admin", PermissionOp{"or", "edit"})
-			if err != nil {
-				return nil, err
-			}
-
 			user, ok := p.Context.Value(userKey).(*schema.User)
 			if !ok {
 				return nil, errDecodeUser
@@ -1662,14 +1777,16 @@ func (c *Composter) upsertChecks() *graphql.Field {
 			if !ok {
 				return nil, errDecodeCheckInput
 			}
-			return c.resolver.UpsertChecks(p.Context, user, checksInput)
+
+			atomic, _ := p.Args["atomic"].(bool)
+			return c.resolver.UpsertChecks(p.Context, user, checksInput, atomic)
 		},
 	}
 }
 
 func (c *Composter) deleteChecks() *graphql.Field {
 	return &graphql.Field{
-		Type: graphql.NewList(graphql.String),
+		Type: graphql.NewList(DeleteCheckResultType),
 		Args: graphql.FieldConfigArgument{
 			"ids": &graphql.ArgumentConfig{
 				Description: "A list of check ids to delete",
@@ -1677,8 +1794,7 @@ func (c *Composter) deleteChecks() *graphql.Field {
 			},
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			// must have admin or edit to delete checks
-			requestor, err := UserPermittedFromContext(p.Context, "admin", PermissionOp{"or", "edit"})
+			requestor, err := requestorFromContext(p.Context)
 			if err != nil {
 				return nil, err
 			}
@@ -1704,7 +1820,7 @@ func (c *Composter) testCheck() *graphql.Field {
 		},
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			// TODO(dan) not sure about this one
-			requestor, err := UserPermittedFromContext(p.Context, "admin", PermissionOp{"or", "edit"})
+			requestor, err := requestorFromContext(p.Context)
 			if err != nil {
 				return nil, err
 			}
@@ -1719,6 +1835,73 @@ func (c *Composter) testCheck() *graphql.Field {
 	}
 }
 
+func (c *Composter) subscription() *graphql.Object {
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"checkStateChanged": c.subscribeCheckStateChanged(),
+		},
+	})
+
+	return subscription
+}
+
+func (c *Composter) subscribeCheckStateChanged() *graphql.Field {
+	return &graphql.Field{
+		Type:        schema.GraphQLCheckStateTransitionType,
+		Description: "State transitions for a check as they happen",
+		Args: graphql.FieldConfigArgument{
+			"check_id": &graphql.ArgumentConfig{
+				Description: "The check id",
+				Type:        graphql.NewNonNull(graphql.String),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			user, ok := p.Context.Value(userKey).(*schema.User)
+			if !ok {
+				return nil, errDecodeUser
+			}
+
+			checkId, _ := p.Args["check_id"].(string)
+
+			// the first execution registers the subscription, later ones
+			// resolve the transition that fired it
+			if op, ok := p.Context.Value(subscriptionKey).(*subscriptionOperation); ok {
+				return nil, op.watchCheckState(p.Context, c.checkStates, user, checkId)
+			}
+
+			source, ok := p.Source.(map[string]interface{})
+			if !ok {
+				return nil, errNotSubscribing
+			}
+
+			transition, ok := source["checkStateChanged"].(*schema.CheckStateTransition)
+			if !ok || transition.CheckId != checkId {
+				return nil, nil
+			}
+
+			return transition, nil
+		},
+	}
+}
+
+// resolveResultError resolves the error of a per item mutation result.
+func resolveResultError(p graphql.ResolveParams) (interface{}, error) {
+	var err error
+	switch result := p.Source.(type) {
+	case *resolver.CheckResult:
+		err = result.Error
+	case *resolver.DeleteCheckResult:
+		err = result.Error
+	}
+
+	if err == nil {
+		return nil, nil
+	}
+
+	return newError(err), nil
+}
+
 func addFields(obj *graphql.Object, fields graphql.FieldDefinitionMap) {
 	for fname, f := range fields {
 		obj.AddFieldConfig(fname, &graphql.Field{
@@ -0,0 +1,337 @@
+package composter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/opsee/basic/schema"
+	opsee_aws_ec2 "github.com/opsee/basic/schema/aws/ec2"
+	"github.com/opsee/compost/apikey"
+	"github.com/opsee/compost/resolver"
+	"github.com/opsee/compost/scope"
+	"golang.org/x/net/context"
+)
+
+var (
+	errScopedScopeManager = errors.New("only users who aren't scoped can scope users")
+	errApiKeyScope        = errors.New("an api key's scope must be within your own")
+	errMissingScopeUserId = errors.New("missing user id")
+	errDecodeScope        = errors.New("error decoding scope")
+
+	RegionScopeType      *graphql.Object
+	RegionScopeInputType *graphql.InputObject
+	UserScopeType        *graphql.Object
+)
+
+func initScopeTypes() {
+	if RegionScopeType != nil {
+		return
+	}
+
+	RegionScopeType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "RegionScope",
+		Description: "A region someone is allowed to use",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Description: "The region id",
+				Type:        graphql.String,
+			},
+			"vpc_ids": &graphql.Field{
+				Description: "The only VPCs in the region they may use, or every VPC if there are none",
+				Type:        graphql.NewList(graphql.String),
+			},
+		},
+	})
+
+	RegionScopeInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "RegionScopeInput",
+		Description: "A region to allow, and optionally the only VPCs in it to allow",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"id": &graphql.InputObjectFieldConfig{
+				Description: "The region id",
+				Type:        graphql.NewNonNull(graphql.String),
+			},
+			"vpc_ids": &graphql.InputObjectFieldConfig{
+				Description: "The only VPCs in the region to allow, or every VPC if there are none",
+				Type:        graphql.NewList(graphql.String),
+			},
+		},
+	})
+
+	UserScopeType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "UserScope",
+		Description: "The regions and VPCs a user is restricted to",
+		Fields: graphql.Fields{
+			"user_id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"regions": &graphql.Field{
+				Type: graphql.NewList(RegionScopeType),
+			},
+		},
+	})
+}
+
+type userScope struct {
+	UserId  int32           `json:"user_id"`
+	Regions []*scope.Region `json:"regions"`
+}
+
+type byUserId []*userScope
+
+func (l byUserId) Len() int           { return len(l) }
+func (l byUserId) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byUserId) Less(i, j int) bool { return l[i].UserId < l[j].UserId }
+
+// scopeFromArgs decodes a [RegionScopeInput] argument.
+func scopeFromArgs(arg interface{}) (scope.Scope, error) {
+	if arg == nil {
+		return nil, nil
+	}
+
+	regions, ok := arg.([]interface{})
+	if !ok {
+		return nil, errDecodeScope
+	}
+
+	var s scope.Scope
+	for _, r := range regions {
+		region, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, errDecodeScope
+		}
+
+		id, _ := region["id"].(string)
+		scoped := &scope.Region{Id: strings.TrimSpace(id)}
+
+		if vpcs, ok := region["vpc_ids"].([]interface{}); ok {
+			for _, vpc := range vpcs {
+				vpcId, ok := vpc.(string)
+				if !ok {
+					return nil, errDecodeScope
+				}
+				scoped.VpcIds = append(scoped.VpcIds, vpcId)
+			}
+		}
+
+		s = append(s, scoped)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// scope is what the requestor may use: their api key's scope if they used
+// one, or else their own.
+func (c *Composter) scope(ctx context.Context) (scope.Scope, error) {
+	if key, ok := ctx.Value(apiKeyKey).(*apikey.Key); ok {
+		return key.Scope, nil
+	}
+
+	user, err := requestorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// resolvers under the same region check the scope, so it's loaded once
+	// per request
+	s, err := resolver.LoaderFromContext(ctx).Load(fmt.Sprintf("scope:%s:%d", user.CustomerId, user.Id), func() (interface{}, error) {
+		return c.scopes.Get(ctx, user.CustomerId, user.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.(scope.Scope), nil
+}
+
+// scopedQueryContext is the query context, if its region, and its VPC if
+// there is one, are within the requestor's scope.
+func (c *Composter) scopedQueryContext(ctx context.Context) (*QueryContext, error) {
+	queryContext, ok := ctx.Value(queryContextKey).(*QueryContext)
+	if !ok {
+		return nil, errDecodeQueryContext
+	}
+
+	s, err := c.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.AllowsRegion(queryContext.Region) {
+		return nil, forbidden(fmt.Errorf("region %s is outside your scope", queryContext.Region))
+	}
+
+	if queryContext.VpcId != "" && !s.AllowsVpc(queryContext.Region, queryContext.VpcId) {
+		return nil, forbidden(fmt.Errorf("vpc %s is outside your scope", queryContext.VpcId))
+	}
+
+	return queryContext, nil
+}
+
+// requireScopedInstances returns an error unless every instance is in a VPC
+// within the requestor's scope. Instances can only be listed by VPC, so in
+// regions whose VPCs aren't restricted, there's nothing to check.
+func (c *Composter) requireScopedInstances(ctx context.Context, user *schema.User, region string, ids []string) error {
+	s, err := c.scope(ctx)
+	if err != nil {
+		return err
+	}
+
+	vpcs, restricted := s.Vpcs(region)
+	if !restricted {
+		return nil
+	}
+
+	allowed := make(map[string]bool)
+	for _, vpc := range vpcs {
+		instances, err := c.resolver.GetInstances(ctx, user, region, vpc, "ec2", "")
+		if err != nil {
+			return err
+		}
+
+		list, ok := instances.([]*opsee_aws_ec2.Instance)
+		if !ok {
+			return errDecodeInstances
+		}
+
+		for _, instance := range list {
+			if instance.InstanceId != nil {
+				allowed[*instance.InstanceId] = true
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if !allowed[id] {
+			return forbidden(fmt.Errorf("instance %s is outside your scope", id))
+		}
+	}
+
+	return nil
+}
+
+// scopeRegion removes the VPCs and subnets of a scanned region that are
+// outside the requestor's scope.
+func (c *Composter) scopeRegion(ctx context.Context, region *schema.Region) (*schema.Region, error) {
+	s, err := c.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if region == nil {
+		return nil, nil
+	}
+
+	if _, restricted := s.Vpcs(region.Region); !restricted {
+		return region, nil
+	}
+
+	scoped := *region
+	scoped.Vpcs = nil
+	for _, vpc := range region.Vpcs {
+		if s.AllowsVpc(region.Region, vpc.VpcId) {
+			scoped.Vpcs = append(scoped.Vpcs, vpc)
+		}
+	}
+
+	scoped.Subnets = nil
+	for _, subnet := range region.Subnets {
+		if s.AllowsVpc(region.Region, subnet.VpcId) {
+			scoped.Subnets = append(scoped.Subnets, subnet)
+		}
+	}
+
+	return &scoped, nil
+}
+
+// scopeManager is the requestor, if they can change scopes. Their policy lets
+// team admins, but scoped admins are turned away here, so they can't widen
+// their own scope.
+func (c *Composter) scopeManager(ctx context.Context) (*schema.User, error) {
+	requestor, err := requestorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := c.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.Unrestricted() {
+		return nil, forbidden(errScopedScopeManager)
+	}
+
+	return requestor, nil
+}
+
+func (c *Composter) queryUserScopes() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(UserScopeType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, err := requestorFromContext(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			scopes, err := c.scopes.List(p.Context, requestor.CustomerId)
+			if err != nil {
+				return nil, err
+			}
+
+			userScopes := make([]*userScope, 0, len(scopes))
+			for userId, s := range scopes {
+				userScopes = append(userScopes, &userScope{UserId: userId, Regions: s})
+			}
+
+			sort.Sort(byUserId(userScopes))
+
+			return userScopes, nil
+		},
+	}
+}
+
+func (c *Composter) setUserScope() *graphql.Field {
+	return &graphql.Field{
+		Type: UserScopeType,
+		Args: graphql.FieldConfigArgument{
+			"user_id": &graphql.ArgumentConfig{
+				Description: "The user to scope",
+				Type:        graphql.NewNonNull(graphql.Int),
+			},
+			"regions": &graphql.ArgumentConfig{
+				Description: "The regions the user may use, or every region if there are none",
+				Type:        graphql.NewList(RegionScopeInputType),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, err := c.scopeManager(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			userId, ok := p.Args["user_id"].(int)
+			if !ok || userId <= 0 {
+				return nil, errMissingScopeUserId
+			}
+
+			s, err := scopeFromArgs(p.Args["regions"])
+			if err != nil {
+				return nil, err
+			}
+
+			if err := c.scopes.Put(p.Context, requestor.CustomerId, int32(userId), s); err != nil {
+				return nil, err
+			}
+
+			return &userScope{UserId: int32(userId), Regions: s}, nil
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package composter
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	admin := `{"admin": true}`
+	client := fake.NewClient(fake.DefaultFixtures())
+	c, err := New(client, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := testUserRequest(t, c, 1, admin, `{"query": "mutation scope { setUserScope(user_id: 2, regions: [{id: \"us-west-2\", vpc_ids: [\"`+fake.VpcId+`\"]}, {id: \"us-east-1\"}]) { user_id regions { id vpc_ids } } }"}`)
+	assert.Contains(body, `"vpc_ids":["`+fake.VpcId+`"]`)
+
+	body = testUserRequest(t, c, 1, admin, `{"query": "{ userScopes { user_id regions { id } } }"}`)
+	assert.Contains(body, `"user_id":2`)
+
+	// the scoped user only sees their own regions and vpcs
+	assert.Contains(testUserRequest(t, c, 2, admin, `{"query": "{ region(id: \"eu-west-1\") { vpc(id: \"vpc-1\") { instances(type: \"ec2\") { ... on ec2Instance { InstanceId } } } } }"}`), `"code":"FORBIDDEN"`)
+	assert.Contains(testUserRequest(t, c, 2, admin, `{"query": "{ region(id: \"us-west-2\") { vpc(id: \"vpc-other\") { instances(type: \"ec2\") { ... on ec2Instance { InstanceId } } } } }"}`), `"code":"FORBIDDEN"`)
+	assert.Contains(testUserRequest(t, c, 2, admin, `{"query": "{ region(id: \"us-west-2\") { vpc(id: \"`+fake.VpcId+`\") { instances(type: \"ec2\") { ... on ec2Instance { InstanceId } } } } }"}`), "i-fa7e0001")
+
+	// and can only reboot instances in them
+	assert.Contains(testUserRequest(t, c, 2, admin, `{"query": "mutation reboot { region(id: \"us-west-2\") { rebootInstances(ids: [\"i-fa7e0001\", \"i-elsewhere\"]) } }"}`), "instance i-elsewhere is outside your scope")
+	assert.NotContains(testUserRequest(t, c, 2, admin, `{"query": "mutation reboot { region(id: \"us-west-2\") { rebootInstances(ids: [\"i-fa7e0001\"]) } }"}`), "errors")
+	assert.Equal([]*fake.InstanceAction{{Action: "reboot", CustomerId: fake.CustomerId, Region: "us-west-2", InstanceIds: []string{"i-fa7e0001"}}}, client.EC2.(*fake.EC2).Actions())
+	assert.Contains(testUserRequest(t, c, 2, admin, `{"query": "mutation launch { region(id: \"us-west-2\") { launchStack(vpc_id: \"vpc-other\", subnet_id: \"subnet-1\", subnet_routing: \"public\") } }"}`), "vpc vpc-other is outside your scope")
+
+	// scans leave out vpcs outside the scope
+	testUserRequest(t, c, 1, admin, `{"query": "mutation scope { setUserScope(user_id: 2, regions: [{id: \"us-west-2\", vpc_ids: [\"vpc-other\"]}]) { user_id } }"}`)
+	body = testUserRequest(t, c, 2, admin, `{"query": "mutation scan { region(id: \"us-west-2\") { scan { vpcs { vpc_id } subnets { subnet_id } } } }"}`)
+	assert.NotContains(body, fake.VpcId)
+	assert.NotContains(body, "subnet-fa7e0001")
+	assert.Contains(testUserRequest(t, c, 1, admin, `{"query": "mutation scan { region(id: \"us-west-2\") { scan { vpcs { vpc_id } } } }"}`), fake.VpcId)
+
+	// scoped admins can't change scopes, so can't widen their own
+	assert.Contains(testUserRequest(t, c, 2, admin, `{"query": "mutation scope { setUserScope(user_id: 2) { user_id } }"}`), `"code":"FORBIDDEN"`)
+
+	// and their api keys are scoped within theirs
+	assert.Contains(testUserRequest(t, c, 2, admin, `{"query": "mutation create { createApiKey(name: \"ci\", permission: read, scope: [{id: \"eu-west-1\"}]) { token } }"}`), `"code":"FORBIDDEN"`)
+
+	var created struct {
+		Data struct {
+			CreateApiKey struct {
+				Token string
+				Key   map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(testUserRequest(t, c, 2, admin, `{"query": "mutation create { createApiKey(name: \"ci\", permission: read) { token key { scope { id vpc_ids } } } }"}`)), &created); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]interface{}{map[string]interface{}{"id": "us-west-2", "vpc_ids": []interface{}{"vpc-other"}}}, created.Data.CreateApiKey.Key["scope"])
+
+	// unscoping the user doesn't unscope their key
+	testUserRequest(t, c, 1, admin, `{"query": "mutation scope { setUserScope(user_id: 2, regions: []) { user_id } }"}`)
+	assert.NotContains(testUserRequest(t, c, 1, admin, `{"query": "{ userScopes { user_id } }"}`), `"user_id":2`)
+
+	req := newTestGraphQLRequest(t, "POST", "/graphql", `{"query": "{ region(id: \"us-east-1\") { task_definition(id: \"td\") { Family } } }"}`)
+	req.Header.Set("Authorization", "ApiKey "+created.Data.CreateApiKey.Token)
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	assert.Contains(w.Body.String(), "region us-east-1 is outside your scope")
+
+	// invalid scopes are rejected
+	assert.Contains(testUserRequest(t, c, 1, admin, `{"query": "mutation scope { setUserScope(user_id: 2, regions: [{id: \"us-west-2\"}, {id: \"us-west-2\"}]) { user_id } }"}`), `"code":"INVALID_ARGUMENT"`)
+}
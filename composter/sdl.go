@@ -0,0 +1,479 @@
+package composter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/opsee/basic/schema"
+	"golang.org/x/net/context"
+)
+
+var (
+	errAdminSchema   = errors.New("the admin schema is only for opsee admins")
+	errUnknownSchema = errors.New("schema must be empty or admin")
+)
+
+// builtinScalars are part of every schema, so they aren't printed.
+var builtinScalars = map[string]bool{
+	"String":  true,
+	"Int":     true,
+	"Float":   true,
+	"Boolean": true,
+	"ID":      true,
+}
+
+// PrintSchema prints schema's types as SDL, sorted by name so the output only
+// changes when the schema does. Descriptions and deprecations are comments,
+// since our graphql parser can't read them.
+func PrintSchema(schema graphql.Schema) string {
+	typeMap := schema.TypeMap()
+
+	names := make([]string, 0, len(typeMap))
+	for name := range typeMap {
+		if strings.HasPrefix(name, "__") || builtinScalars[name] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		printType(buf, typeMap[name])
+	}
+
+	return buf.String()
+}
+
+func printType(buf *bytes.Buffer, ttype graphql.Type) {
+	printDescription(buf, "", ttype.Description())
+
+	switch t := ttype.(type) {
+	case *graphql.Object:
+		fmt.Fprintf(buf, "type %s", t.Name())
+		if interfaces := t.Interfaces(); len(interfaces) > 0 {
+			names := make([]string, len(interfaces))
+			for i, iface := range interfaces {
+				names[i] = iface.Name()
+			}
+			sort.Strings(names)
+			fmt.Fprintf(buf, " implements %s", strings.Join(names, ", "))
+		}
+		buf.WriteString(" {\n")
+		printFields(buf, t.Fields())
+		buf.WriteString("}\n")
+
+	case *graphql.Interface:
+		fmt.Fprintf(buf, "interface %s {\n", t.Name())
+		printFields(buf, t.Fields())
+		buf.WriteString("}\n")
+
+	case *graphql.Union:
+		types := t.PossibleTypes()
+		names := make([]string, len(types))
+		for i, member := range types {
+			names[i] = member.Name()
+		}
+		sort.Strings(names)
+		fmt.Fprintf(buf, "union %s = %s\n", t.Name(), strings.Join(names, " | "))
+
+	case *graphql.Enum:
+		values := t.Values()
+		sort.Sort(enumValuesByName(values))
+
+		fmt.Fprintf(buf, "enum %s {\n", t.Name())
+		for _, value := range values {
+			printDescription(buf, "  ", value.Description)
+			printDeprecation(buf, "  ", value.DeprecationReason)
+			fmt.Fprintf(buf, "  %s\n", value.Name)
+		}
+		buf.WriteString("}\n")
+
+	case *graphql.InputObject:
+		fields := t.Fields()
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(buf, "input %s {\n", t.Name())
+		for _, name := range names {
+			field := fields[name]
+			printDescription(buf, "  ", field.Description())
+			fmt.Fprintf(buf, "  %s: %s%s\n", name, field.Type, printDefault(field.DefaultValue))
+		}
+		buf.WriteString("}\n")
+
+	default:
+		fmt.Fprintf(buf, "scalar %s\n", ttype.Name())
+	}
+}
+
+func printFields(buf *bytes.Buffer, fields graphql.FieldDefinitionMap) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := fields[name]
+		printDescription(buf, "  ", field.Description)
+		printDeprecation(buf, "  ", field.DeprecationReason)
+
+		fmt.Fprintf(buf, "  %s", name)
+		if len(field.Args) > 0 {
+			// args are defined in a map, so their order is random
+			args := make([]string, len(field.Args))
+			for i, arg := range field.Args {
+				args[i] = fmt.Sprintf("%s: %s%s", arg.Name(), arg.Type, printDefault(arg.DefaultValue))
+			}
+			sort.Strings(args)
+			fmt.Fprintf(buf, "(%s)", strings.Join(args, ", "))
+		}
+		fmt.Fprintf(buf, ": %s\n", field.Type)
+	}
+}
+
+func printDescription(buf *bytes.Buffer, indent, description string) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return
+	}
+
+	for _, line := range strings.Split(description, "\n") {
+		fmt.Fprintf(buf, "%s# %s\n", indent, strings.TrimSpace(line))
+	}
+}
+
+func printDeprecation(buf *bytes.Buffer, indent, reason string) {
+	if reason != "" {
+		fmt.Fprintf(buf, "%s# deprecated: %s\n", indent, reason)
+	}
+}
+
+// printDefault prints a default value as a graphql literal. Objects print as
+// json, which only differs from graphql in its quoted keys.
+func printDefault(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	return " = " + string(data)
+}
+
+type enumValuesByName []*graphql.EnumValueDefinition
+
+func (v enumValuesByName) Len() int           { return len(v) }
+func (v enumValuesByName) Less(i, j int) bool { return v[i].Name < v[j].Name }
+func (v enumValuesByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+// SchemaChange is a difference between two versions of a schema.
+type SchemaChange struct {
+	// Breaking changes can fail queries that worked before.
+	Breaking    bool
+	Description string
+}
+
+func (change SchemaChange) String() string {
+	if change.Breaking {
+		return "breaking: " + change.Description
+	}
+
+	return "safe: " + change.Description
+}
+
+// sdlType is the part of a type definition that clients depend on.
+type sdlType struct {
+	kind string
+
+	// fields are output fields for types and interfaces, and input fields for
+	// inputs, whose args are always empty.
+	fields map[string]*sdlField
+
+	// members are enum values, union members, or implemented interfaces.
+	members map[string]bool
+}
+
+type sdlField struct {
+	ttype string
+	args  map[string]string
+}
+
+// DiffSchemas compares two schemas printed by PrintSchema, returning changes
+// sorted breaking first.
+func DiffSchemas(old, new string) ([]SchemaChange, error) {
+	oldTypes, err := parseSDL(old)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing old schema: %s", err)
+	}
+
+	newTypes, err := parseSDL(new)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing new schema: %s", err)
+	}
+
+	var changes []SchemaChange
+	add := func(breaking bool, format string, args ...interface{}) {
+		changes = append(changes, SchemaChange{Breaking: breaking, Description: fmt.Sprintf(format, args...)})
+	}
+
+	for name, oldType := range oldTypes {
+		newType, ok := newTypes[name]
+		if !ok {
+			add(true, "%s %s was removed", oldType.kind, name)
+			continue
+		}
+
+		if oldType.kind != newType.kind {
+			add(true, "%s changed from %s to %s", name, oldType.kind, newType.kind)
+			continue
+		}
+
+		diffMembers(add, name, oldType, newType)
+		diffFields(add, name, oldType, newType)
+	}
+
+	for name, newType := range newTypes {
+		if _, ok := oldTypes[name]; !ok {
+			add(false, "%s %s was added", newType.kind, name)
+		}
+	}
+
+	sort.Sort(schemaChanges(changes))
+	return changes, nil
+}
+
+func diffMembers(add func(bool, string, ...interface{}), name string, oldType, newType *sdlType) {
+	member := map[string]string{
+		"enum":  "value",
+		"union": "member",
+		"type":  "interface",
+	}[oldType.kind]
+
+	for m := range oldType.members {
+		if !newType.members[m] {
+			add(true, "%s %s %s was removed", name, member, m)
+		}
+	}
+
+	for m := range newType.members {
+		if !oldType.members[m] {
+			add(false, "%s %s %s was added", name, member, m)
+		}
+	}
+}
+
+func diffFields(add func(bool, string, ...interface{}), name string, oldType, newType *sdlType) {
+	input := oldType.kind == "input"
+
+	for fieldName, oldField := range oldType.fields {
+		path := name + "." + fieldName
+
+		newField, ok := newType.fields[fieldName]
+		if !ok {
+			add(true, "%s was removed", path)
+			continue
+		}
+
+		if oldField.ttype != newField.ttype {
+			add(!safeTypeChange(oldField.ttype, newField.ttype, input), "%s changed type from %s to %s", path, oldField.ttype, newField.ttype)
+		}
+
+		for argName, oldArg := range oldField.args {
+			newArg, ok := newField.args[argName]
+			if !ok {
+				add(true, "%s argument %s was removed", path, argName)
+				continue
+			}
+
+			if oldArg != newArg {
+				add(!safeTypeChange(oldArg, newArg, true), "%s argument %s changed type from %s to %s", path, argName, oldArg, newArg)
+			}
+		}
+
+		for argName, newArg := range newField.args {
+			if _, ok := oldField.args[argName]; !ok {
+				add(isNonNull(newArg), "%s argument %s: %s was added", path, argName, newArg)
+			}
+		}
+	}
+
+	for fieldName, newField := range newType.fields {
+		if _, ok := oldType.fields[fieldName]; !ok {
+			add(input && isNonNull(newField.ttype), "%s.%s: %s was added", name, fieldName, newField.ttype)
+		}
+	}
+}
+
+// safeTypeChange is whether changing a type can't break clients: outputs can
+// become non null, and inputs can become nullable.
+func safeTypeChange(old, new string, input bool) bool {
+	if input {
+		return old == new+"!"
+	}
+
+	return new == old+"!"
+}
+
+// isNonNull is whether a type is required. Defaults are left out of SDL types,
+// so required fields with defaults also count.
+func isNonNull(ttype string) bool {
+	return strings.HasSuffix(ttype, "!")
+}
+
+type schemaChanges []SchemaChange
+
+func (c schemaChanges) Len() int      { return len(c) }
+func (c schemaChanges) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c schemaChanges) Less(i, j int) bool {
+	if c[i].Breaking != c[j].Breaking {
+		return c[i].Breaking
+	}
+
+	return c[i].Description < c[j].Description
+}
+
+func parseSDL(sdl string) (map[string]*sdlType, error) {
+	document, err := parser.Parse(parser.ParseParams{Source: sdl})
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]*sdlType)
+	for _, definition := range document.Definitions {
+		var (
+			name  string
+			ttype = &sdlType{fields: make(map[string]*sdlField), members: make(map[string]bool)}
+		)
+
+		switch def := definition.(type) {
+		case *ast.ObjectDefinition:
+			name, ttype.kind = def.Name.Value, "type"
+			for _, iface := range def.Interfaces {
+				ttype.members[iface.Name.Value] = true
+			}
+			addSDLFields(ttype, def.Fields)
+
+		case *ast.InterfaceDefinition:
+			name, ttype.kind = def.Name.Value, "interface"
+			addSDLFields(ttype, def.Fields)
+
+		case *ast.UnionDefinition:
+			name, ttype.kind = def.Name.Value, "union"
+			for _, member := range def.Types {
+				ttype.members[member.Name.Value] = true
+			}
+
+		case *ast.EnumDefinition:
+			name, ttype.kind = def.Name.Value, "enum"
+			for _, value := range def.Values {
+				ttype.members[value.Name.Value] = true
+			}
+
+		case *ast.InputObjectDefinition:
+			name, ttype.kind = def.Name.Value, "input"
+			for _, field := range def.Fields {
+				ttype.fields[field.Name.Value] = &sdlField{ttype: sdlTypeString(field.Type)}
+			}
+
+		case *ast.ScalarDefinition:
+			name, ttype.kind = def.Name.Value, "scalar"
+
+		default:
+			return nil, fmt.Errorf("unsupported definition %s", definition.GetKind())
+		}
+
+		types[name] = ttype
+	}
+
+	return types, nil
+}
+
+func addSDLFields(ttype *sdlType, fields []*ast.FieldDefinition) {
+	for _, field := range fields {
+		args := make(map[string]string, len(field.Arguments))
+		for _, arg := range field.Arguments {
+			args[arg.Name.Value] = sdlTypeString(arg.Type)
+		}
+
+		ttype.fields[field.Name.Value] = &sdlField{ttype: sdlTypeString(field.Type), args: args}
+	}
+}
+
+func sdlTypeString(ttype ast.Type) string {
+	switch t := ttype.(type) {
+	case *ast.NonNull:
+		return sdlTypeString(t.Type) + "!"
+	case *ast.List:
+		return "[" + sdlTypeString(t.Type) + "]"
+	case *ast.Named:
+		return t.Name.Value
+	}
+
+	return ""
+}
+
+// schemaSDL serves the schema as SDL to any user /graphql would let in, or the
+// admin schema with ?schema=admin to opsee admins signed in with a vape token,
+// like /admin/graphql. It's introspection, so it's off with introspection for
+// everyone but opsee admins.
+func (s *Composter) schemaSDL() http.HandlerFunc {
+	authorize := s.userDecodeFunc()
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		ctx, status, err := authorize(context.Background(), rw, r, nil)
+		if status != 0 {
+			if err == nil {
+				err = errDecodeUser
+			}
+			writeJSON(rw, status, map[string]string{"message": err.Error()})
+			return
+		}
+
+		_, ok := ctx.Value(userKey).(*schema.User)
+		if !ok {
+			writeJSON(rw, http.StatusUnauthorized, map[string]string{"message": errDecodeUser.Error()})
+			return
+		}
+
+		if s.introspectionDisabled(ctx) {
+			writeJSON(rw, http.StatusForbidden, map[string]string{"message": errIntrospectionDisabled.Error()})
+			return
+		}
+
+		printed := s.Schema
+		switch r.URL.Query().Get("schema") {
+		case "":
+		case "admin":
+			if !tokenOpseeAdmin(ctx) {
+				writeJSON(rw, http.StatusForbidden, map[string]string{"message": errAdminSchema.Error()})
+				return
+			}
+			printed = s.AdminSchema
+		default:
+			writeJSON(rw, http.StatusBadRequest, map[string]string{"message": errUnknownSchema.Error()})
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/graphql; charset=utf-8")
+		rw.Write([]byte(PrintSchema(printed)))
+	}
+}
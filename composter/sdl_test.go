@@ -0,0 +1,194 @@
+package composter
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opsee/compost/fake"
+	"github.com/opsee/compost/resolver"
+	"github.com/opsee/vaper"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSchemaSnapshots fails when the schema changes without its snapshot, so
+// schema changes show up in review.
+func TestSchemaSnapshots(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(&resolver.Client{}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, printed := range map[string]string{
+		"../schema/schema.graphql": PrintSchema(c.Schema),
+		"../schema/admin.graphql":  PrintSchema(c.AdminSchema),
+	} {
+		snapshot, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(string(snapshot), printed, "%s is out of date, update it with compost schema print -dir schema", file)
+	}
+}
+
+func TestDiffSchemas(t *testing.T) {
+	assert := assert.New(t)
+
+	old := `
+type Query {
+  checks(id: String, limit: Int): [Check]
+  team: Team
+  removed: String
+}
+
+type Check {
+  id: String
+  name: String
+}
+
+type Team {
+  id: String!
+}
+
+input CheckInput {
+  name: String
+  interval: Int
+}
+
+enum State {
+  OK
+  FAIL
+}
+
+union Response = Check | Team
+`
+
+	new := `
+# descriptions are comments, and are ignored
+type Query {
+  checks(id: String!, region: String): [Check]
+  team: Team!
+  customer: Customer
+}
+
+type Check {
+  id: Int
+  name: String
+}
+
+type Team {
+  id: String
+}
+
+input CheckInput {
+  name: String!
+  interval: Int
+  target: String!
+}
+
+enum State {
+  OK
+  WARN
+}
+
+union Response = Check
+
+scalar Customer
+`
+
+	changes, err := DiffSchemas(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	descriptions := make([]string, len(changes))
+	for i, change := range changes {
+		descriptions[i] = change.String()
+	}
+
+	assert.Equal([]string{
+		"breaking: Check.id changed type from String to Int",
+		"breaking: CheckInput.name changed type from String to String!",
+		"breaking: CheckInput.target: String! was added",
+		"breaking: Query.checks argument id changed type from String to String!",
+		"breaking: Query.checks argument limit was removed",
+		"breaking: Query.removed was removed",
+		"breaking: Response member Team was removed",
+		"breaking: State value FAIL was removed",
+		"breaking: Team.id changed type from String! to String",
+		"safe: Query.checks argument region: String was added",
+		"safe: Query.customer: Customer was added",
+		"safe: Query.team changed type from Team to Team!",
+		"safe: State value WARN was added",
+		"safe: scalar Customer was added",
+	}, descriptions)
+
+	_, err = DiffSchemas(old, "type {")
+	assert.Error(err)
+}
+
+func TestSchemaSDL(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(query, authorization string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://compost/schema.graphql"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		return w
+	}
+
+	basic := func(user string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user))
+	}
+
+	user := `{"id": 1, "customer_id": "` + fake.CustomerId + `", "email": "fake@opsee.com", "active": true, "status": "active", "perms": {"admin": true}}`
+	opseeAdmin := strings.Replace(user, `"active": true`, `"active": true, "admin": true`, 1)
+
+	now := time.Now()
+	admin := fake.DefaultFixtures().Users[0]
+	token, err := vaper.New(admin, admin.Email, now, now.Add(time.Hour)).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := request("", "")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = request("", basic(user))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(PrintSchema(c.Schema), w.Body.String())
+
+	w = request("?schema=admin", basic(user))
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	// basic user json isn't signed, so its admin flag doesn't count
+	w = request("?schema=admin", basic(opseeAdmin))
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = request("?schema=admin", "Bearer "+token)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "listCustomers")
+
+	w = request("?schema=nope", basic(user))
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
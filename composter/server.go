@@ -0,0 +1,92 @@
+package composter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/opsee/logrus"
+)
+
+// readiness is the body of /ready.
+type readiness struct {
+	Ready    bool              `json:"ready"`
+	Status   string            `json:"status,omitempty"`
+	Backends map[string]string `json:"backends,omitempty"`
+}
+
+// StartHTTP serves until Shutdown is called.
+func (s *Composter) StartHTTP(addr string) error {
+	s.server.Addr = addr
+
+	err := s.server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// Shutdown stops accepting requests, and waits up to grace for in flight
+// requests to finish. Subscriptions are closed, since they'd never finish.
+func (s *Composter) Shutdown(grace time.Duration) error {
+	s.shutdownOnce.Do(func() {
+		close(s.shuttingDown)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
+
+// ready answers with 200 if every backend is reachable, and 503 otherwise or
+// once we're shutting down. It's unauthenticated, so backends are only "ok" or
+// "fail", and why they failed is logged.
+func (s *Composter) ready() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-s.shuttingDown:
+			writeJSON(rw, http.StatusServiceUnavailable, readiness{Status: "shutting down"})
+			return
+		default:
+		}
+
+		status := readiness{
+			Ready:    true,
+			Backends: make(map[string]string),
+		}
+
+		for name, err := range s.resolver.Ready(r.Context()) {
+			if err != nil {
+				log.WithError(err).Warnf("%s is not ready", name)
+				status.Ready = false
+				status.Backends[name] = "fail"
+				continue
+			}
+
+			status.Backends[name] = "ok"
+		}
+
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(rw, code, status)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, code int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.WithError(err).Error("error encoding response")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	rw.Write(data)
+}
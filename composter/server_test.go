@@ -0,0 +1,105 @@
+package composter
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opsee/compost/resolver"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestReady(t *testing.T) {
+	assert := assert.New(t)
+
+	catsErr := error(nil)
+	client := &resolver.Client{
+		HealthChecks: map[string]resolver.HealthCheck{
+			resolver.BackendBartnet: func(ctx context.Context) error { return nil },
+			resolver.BackendCats:    func(ctx context.Context) error { return catsErr },
+		},
+	}
+
+	c, err := New(client, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := testReady(t, c, http.StatusOK)
+	assert.True(status.Ready)
+	assert.Equal(map[string]string{"bartnet": "ok", "cats": "ok"}, status.Backends)
+
+	catsErr = errors.New("transport is closing")
+	status = testReady(t, c, http.StatusServiceUnavailable)
+	assert.False(status.Ready)
+	assert.Equal(map[string]string{"bartnet": "ok", "cats": "fail"}, status.Backends)
+
+	catsErr = nil
+	assert.NoError(c.Shutdown(time.Second))
+	status = testReady(t, c, http.StatusServiceUnavailable)
+	assert.Equal("shutting down", status.Status)
+}
+
+func TestShutdown(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(&resolver.Client{}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- c.StartHTTP(addr)
+	}()
+
+	for i := 0; ; i++ {
+		resp, err := http.Get("http://" + addr + "/health")
+		if err == nil {
+			resp.Body.Close()
+			assert.Equal(http.StatusOK, resp.StatusCode)
+			break
+		}
+
+		if i > 50 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(c.Shutdown(time.Second))
+	assert.NoError(<-served)
+
+	_, err = http.Get("http://" + addr + "/health")
+	assert.Error(err)
+}
+
+func testReady(t *testing.T, c *Composter, code int) *readiness {
+	req, err := http.NewRequest("GET", "http://compost/ready", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	assert.Equal(t, code, w.Code)
+
+	status := &readiness{}
+	if err := json.Unmarshal(w.Body.Bytes(), status); err != nil {
+		t.Fatal(err)
+	}
+
+	return status
+}
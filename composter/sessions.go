@@ -0,0 +1,372 @@
+package composter
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/apikey"
+	"github.com/opsee/compost/session"
+	log "github.com/opsee/logrus"
+	opsee_scalars "github.com/opsee/protobuf/plugin/graphql/scalars"
+	"github.com/opsee/vaper"
+	"golang.org/x/net/context"
+)
+
+const (
+	// sessions are recorded as seen at most this often, so that every request
+	// isn't a write
+	sessionTouchInterval = time.Minute
+
+	// how many sessions are remembered as touched before the old ones are
+	// forgotten
+	maxTouchedSessions = 10000
+)
+
+var (
+	errTokenMalformed   = errors.New("Authorization header is malformed.")
+	errTokenType        = errors.New("Authorization type not supported.")
+	errTokenDecode      = errors.New("Authorization token decode error.")
+	errTokenClaims      = errors.New("Authorization token is missing its iat or exp.")
+	errTokenExpired     = errors.New("Authorization token has expired.")
+	errTokenLifetime    = errors.New("Authorization token lasts too long.")
+	errTokenRevoked     = errors.New("Authorization token has been revoked.")
+	errTokenUnmarshal   = errors.New("authorization token unmarshal error.")
+	errSessionCheck     = errors.New("error checking session, try again")
+	errApiKeySessions   = errors.New("api keys don't have sessions")
+	errMissingSessionId = errors.New("missing session id")
+
+	SessionType *graphql.Object
+)
+
+func initSessionTypes() {
+	if SessionType != nil {
+		return
+	}
+
+	SessionType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Session",
+		Description: "A token a user is signed in with",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"user_id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"current": &graphql.Field{
+				Description: "Whether this is the session of the token making the request",
+				Type:        graphql.Boolean,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					current, ok := p.Context.Value(sessionKey).(*session.Session)
+					return ok && current.Id == p.Source.(*session.Session).Id, nil
+				},
+			},
+			"issued_at": &graphql.Field{
+				Description: "unix timestamp the token was issued at",
+				Type:        opsee_scalars.Timestamp,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return unixOrNil(p.Source.(*session.Session).IssuedAt), nil
+				},
+			},
+			"expires_at": &graphql.Field{
+				Description: "unix timestamp the token expires at",
+				Type:        opsee_scalars.Timestamp,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return unixOrNil(p.Source.(*session.Session).ExpiresAt), nil
+				},
+			},
+			"last_seen": &graphql.Field{
+				Description: "unix timestamp the token was last used at, to within a minute",
+				Type:        opsee_scalars.Timestamp,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return unixOrNil(p.Source.(*session.Session).LastSeen), nil
+				},
+			},
+		},
+	})
+}
+
+// sessionTracker checks sessions against a store, and records when they're
+// used.
+type sessionTracker struct {
+	session.Store
+	mut     sync.Mutex
+	touched map[string]time.Time
+}
+
+func newSessionTracker(store session.Store) *sessionTracker {
+	return &sessionTracker{Store: store, touched: make(map[string]time.Time)}
+}
+
+// check returns an error if the session has expired or been revoked, and
+// otherwise records it as seen. Errors from the store fail the check, since
+// the session may have been revoked.
+func (t *sessionTracker) check(ctx context.Context, s *session.Session) error {
+	now := time.Now()
+
+	switch err := session.Check(ctx, t.Store, s, now); err {
+	case nil:
+	case session.ErrExpired:
+		return errTokenExpired
+	case session.ErrRevoked:
+		return errTokenRevoked
+	default:
+		log.WithError(err).Error("error checking session")
+		return errSessionCheck
+	}
+
+	if !t.shouldTouch(s.Id, now) {
+		return nil
+	}
+
+	touched := *s
+	touched.LastSeen = now.UTC()
+	if err := t.Touch(ctx, &touched); err != nil {
+		log.WithError(err).Error("error recording session")
+	}
+
+	return nil
+}
+
+// checkBasic returns an error if the session of a basic header has been
+// revoked. The header has no issue time, so revoking all of the user's
+// sessions doesn't cover it.
+func (t *sessionTracker) checkBasic(ctx context.Context, header string, user *schema.User) error {
+	revoked, err := t.Revoked(ctx, &session.Session{
+		Id:         session.Id(header),
+		CustomerId: user.CustomerId,
+		UserId:     user.Id,
+	})
+	if err != nil {
+		log.WithError(err).Error("error checking session")
+		return errSessionCheck
+	}
+
+	if revoked {
+		return errTokenRevoked
+	}
+
+	return nil
+}
+
+func (t *sessionTracker) shouldTouch(id string, now time.Time) bool {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if last, ok := t.touched[id]; ok && now.Sub(last) < sessionTouchInterval {
+		return false
+	}
+
+	if len(t.touched) >= maxTouchedSessions {
+		for touchedId, last := range t.touched {
+			if now.Sub(last) >= sessionTouchInterval {
+				delete(t.touched, touchedId)
+			}
+		}
+	}
+
+	t.touched[id] = now
+	return true
+}
+
+// authStatus is the http status for an authentication error.
+func authStatus(err error) int {
+	if err == errSessionCheck {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusUnauthorized
+}
+
+// bearerUser authenticates a vape bearer token header, checking that its
+// session hasn't expired or been revoked.
+func (c *Composter) bearerUser(ctx context.Context, header string) (*schema.User, *session.Session, error) {
+	user, s, err := userFromAuthorization(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.sessions.check(ctx, s); err != nil {
+		return nil, nil, err
+	}
+
+	return user, s, nil
+}
+
+// userFromAuthorization decodes the user and session from a vaper bearer
+// token header.
+func userFromAuthorization(header string) (*schema.User, *session.Session, error) {
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return nil, nil, errTokenMalformed
+	}
+
+	if strings.ToLower(fields[0]) != "bearer" {
+		return nil, nil, errTokenType
+	}
+
+	token := fields[1]
+	decoded, err := decodeToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := &schema.User{}
+	err = decoded.Reify(user)
+	if err != nil {
+		return nil, nil, errTokenUnmarshal
+	}
+
+	err = user.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iat, _ := (*decoded)["iat"].(int64)
+	exp, _ := (*decoded)["exp"].(int64)
+
+	// revoking a user's sessions is only remembered for MaxTokenLifetime
+	if time.Unix(exp, 0).Sub(time.Unix(iat, 0)) > session.MaxTokenLifetime {
+		return nil, nil, errTokenLifetime
+	}
+
+	return user, session.New(token, user, time.Unix(iat, 0), time.Unix(exp, 0)), nil
+}
+
+// decodeToken is vaper.Unmarshal, which checks the token's expiry, but panics
+// on tokens without one.
+func decodeToken(token string) (decoded *vaper.Token, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			decoded, err = nil, errTokenClaims
+		}
+	}()
+
+	decoded, err = vaper.Unmarshal(token)
+	if err != nil {
+		if err.Error() == "token expired" {
+			return nil, errTokenExpired
+		}
+
+		log.WithError(err).Error("error decoding bearer token")
+		return nil, errTokenDecode
+	}
+
+	return decoded, nil
+}
+
+// sessionUser is whose sessions a request is for: the requestor's, or if
+// userId is set, a member of their team's, which needs admin.
+func sessionUser(ctx context.Context, userId interface{}) (*schema.User, int32, error) {
+	if _, ok := ctx.Value(apiKeyKey).(*apikey.Key); ok {
+		return nil, 0, forbidden(errApiKeySessions)
+	}
+
+	user, ok := ctx.Value(userKey).(*schema.User)
+	if !ok || user == nil {
+		return nil, 0, errDecodeUser
+	}
+
+	id, ok := userId.(int)
+	if !ok || int32(id) == user.Id {
+		return user, user.Id, nil
+	}
+
+	if err := anyOf("admin")(user); err != nil {
+		return nil, 0, forbidden(err)
+	}
+
+	return user, int32(id), nil
+}
+
+func (c *Composter) querySessions() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(SessionType),
+		Args: graphql.FieldConfigArgument{
+			"user_id": &graphql.ArgumentConfig{
+				Description: "Whose sessions to list, if not your own. Only team admins can list other users' sessions.",
+				Type:        graphql.Int,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, userId, err := sessionUser(p.Context, p.Args["user_id"])
+			if err != nil {
+				return nil, err
+			}
+
+			return c.sessions.List(p.Context, requestor.CustomerId, userId)
+		},
+	}
+}
+
+func (c *Composter) revokeSession() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{
+				Description: "The session id",
+				Type:        graphql.NewNonNull(graphql.String),
+			},
+			"user_id": &graphql.ArgumentConfig{
+				Description: "Whose session it is, if not your own. Only team admins can revoke other users' sessions.",
+				Type:        graphql.Int,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, userId, err := sessionUser(p.Context, p.Args["user_id"])
+			if err != nil {
+				return nil, err
+			}
+
+			id, _ := p.Args["id"].(string)
+			if id == "" {
+				return nil, errMissingSessionId
+			}
+
+			if err := c.sessions.Revoke(p.Context, requestor.CustomerId, userId, id); err != nil {
+				return nil, err
+			}
+
+			return true, nil
+		},
+	}
+}
+
+func (c *Composter) revokeAllSessions() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"user_id": &graphql.ArgumentConfig{
+				Description: "Whose sessions to revoke, if not your own. Only team admins can revoke other users' sessions.",
+				Type:        graphql.Int,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			requestor, userId, err := sessionUser(p.Context, p.Args["user_id"])
+			if err != nil {
+				return nil, err
+			}
+
+			if err := c.revokeUserSessions(p.Context, requestor.CustomerId, userId); err != nil {
+				return nil, err
+			}
+
+			return true, nil
+		},
+	}
+}
+
+// revokeUserSessions revokes every token a user has been issued so far.
+func (c *Composter) revokeUserSessions(ctx context.Context, customerId string, userId int32) error {
+	if err := c.sessions.RevokeUser(ctx, customerId, userId, time.Now()); err != nil {
+		log.WithError(err).Error("error revoking sessions")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package composter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/fake"
+	"github.com/opsee/compost/session"
+	"github.com/opsee/vaper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := fake.DefaultFixtures()
+	admin := fixtures.Users[0]
+	member := &schema.User{Id: 2, CustomerId: fake.CustomerId, Email: "member@opsee.com", Active: true, Status: "active", Perms: &schema.UserFlags{Edit: true}}
+	fixtures.Users = append(fixtures.Users, member)
+
+	c, err := New(fake.NewClient(fixtures), Config{Sessions: session.Config{Store: session.StoreEtcd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := func(user *schema.User, iat, exp time.Time) string {
+		token, err := vaper.New(user, user.Email, iat, exp).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	bearerRequest := func(token, body string) *httptest.ResponseRecorder {
+		req := newTestGraphQLRequest(t, "POST", "/graphql", body)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		return w
+	}
+
+	listSessions := func(token, query string) []map[string]interface{} {
+		w := bearerRequest(token, `{"query": "`+query+`"}`)
+		assert.Equal(http.StatusOK, w.Code)
+
+		var result struct {
+			Data struct {
+				Sessions []map[string]interface{}
+			}
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result.Data.Sessions
+	}
+
+	basicRequest := func(user *schema.User) *httptest.ResponseRecorder {
+		data, err := json.Marshal(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := newTestGraphQLRequest(t, "POST", "/graphql", `{"query": "{ checks { id } }"}`)
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString(data))
+
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		return w
+	}
+
+	now := time.Now()
+	adminToken := newToken(admin, now, now.Add(time.Hour))
+	laptop := newToken(member, now, now.Add(time.Hour))
+	phone := newToken(member, now, now.Add(2*time.Hour))
+
+	assert.Equal(http.StatusOK, bearerRequest(phone, `{"query": "{ checks { id } }"}`).Code)
+
+	sessions := listSessions(laptop, `{ sessions { id current expires_at } }`)
+	if assert.Len(sessions, 2) {
+		assert.Equal(true, sessions[0]["current"])
+		assert.Equal(false, sessions[1]["current"])
+	}
+
+	// members can't see other users' sessions, but admins can
+	w := bearerRequest(laptop, `{"query": "{ sessions(user_id: 1) { id } }"}`)
+	assert.Contains(w.Body.String(), `"code":"FORBIDDEN"`)
+	assert.Len(listSessions(adminToken, `{ sessions(user_id: 2) { id } }`), 2)
+
+	phoneId := sessions[1]["id"].(string)
+	w = bearerRequest(laptop, `{"query": "mutation revoke { revokeSession(id: \"`+phoneId+`\") }"}`)
+	assert.Contains(w.Body.String(), `"revokeSession":true`)
+
+	w = bearerRequest(phone, `{"query": "{ checks { id } }"}`)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Contains(w.Body.String(), "revoked")
+	assert.Len(listSessions(laptop, `{ sessions { id } }`), 1)
+
+	w = bearerRequest(laptop, `{"query": "mutation revoke { revokeSession(id: \"`+phoneId+`\") }"}`)
+	assert.Contains(w.Body.String(), `"code":"NOT_FOUND"`)
+
+	// removing a member revokes every token they have, but not basic headers,
+	// which have no issue time
+	w = bearerRequest(adminToken, `{"query": "mutation remove { user(user: {id: 2, status: inactive}) { id status } }"}`)
+	assert.Contains(w.Body.String(), `"status":"inactive"`)
+	assert.Equal(http.StatusUnauthorized, bearerRequest(laptop, `{"query": "{ checks { id } }"}`).Code)
+	assert.Equal(http.StatusOK, basicRequest(member).Code)
+	assert.Equal(http.StatusOK, bearerRequest(adminToken, `{"query": "{ checks { id } }"}`).Code)
+
+	w = bearerRequest(adminToken, `{"query": "mutation revokeAll { revokeAllSessions }"}`)
+	assert.Contains(w.Body.String(), `"revokeAllSessions":true`)
+	assert.Equal(http.StatusUnauthorized, bearerRequest(adminToken, `{"query": "{ checks { id } }"}`).Code)
+	assert.Equal(http.StatusOK, basicRequest(admin).Code)
+
+	// signing in again afterwards works. Tokens are issued to the second, so
+	// it has to be the next one.
+	time.Sleep(time.Now().Truncate(time.Second).Add(time.Second).Sub(time.Now()))
+	signedIn := newToken(admin, time.Now(), time.Now().Add(time.Hour))
+	assert.Equal(http.StatusOK, bearerRequest(signedIn, `{"query": "{ checks { id } }"}`).Code)
+
+	// tokens can't outlast the revocation of their user's sessions
+	forever := newToken(admin, now, now.Add(session.MaxTokenLifetime+time.Hour))
+	assert.Equal(http.StatusUnauthorized, bearerRequest(forever, `{"query": "{ checks { id } }"}`).Code)
+
+	expired := newToken(admin, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	w = bearerRequest(expired, `{"query": "{ checks { id } }"}`)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Contains(w.Body.String(), "expired")
+
+	// tokens without an expiry are rejected, rather than panicking vaper
+	unexpiring := vaper.New(admin, admin.Email, now, now.Add(time.Hour))
+	delete(*unexpiring, "exp")
+	token, err := unexpiring.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(http.StatusUnauthorized, bearerRequest(token, `{"query": "{ checks { id } }"}`).Code)
+}
@@ -0,0 +1,498 @@
+package composter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/basic/tp"
+	"github.com/opsee/compost/session"
+	log "github.com/opsee/logrus"
+	"golang.org/x/net/context"
+)
+
+// subscriptions are served over a websocket with the graphql-ws protocol from
+// subscriptions-transport-ws, which is what apollo clients speak.
+const (
+	subscriptionProtocol   = "graphql-ws"
+	subscriptionKeepAlive  = 20 * time.Second
+	subscriptionMaxMessage = 1 << 20
+	subscriptionWriteWait  = 10 * time.Second
+
+	// subscriptionMaxOperations is how many subscriptions one connection can
+	// have running at once.
+	subscriptionMaxOperations = 20
+
+	// a close frame's payload is at most 125 bytes, two of which are the code
+	subscriptionMaxCloseReason = 123
+
+	gqlConnectionInit      = "connection_init"
+	gqlConnectionAck       = "connection_ack"
+	gqlConnectionError     = "connection_error"
+	gqlConnectionKeepAlive = "ka"
+	gqlConnectionTerminate = "connection_terminate"
+	gqlStart               = "start"
+	gqlStop                = "stop"
+	gqlData                = "data"
+	gqlError               = "error"
+	gqlComplete            = "complete"
+)
+
+var (
+	errNotSubscription       = errors.New("only subscription operations are supported over websocket")
+	errNotSubscribing        = errors.New("subscription fields can only be used in a subscription")
+	errDuplicateSubscription = errors.New("subscription id already in use")
+	errConnectionNotInit     = errors.New("connection_init must be sent first")
+	errConnectionInitTwice   = errors.New("connection_init was already sent")
+	errTooManySubscriptions  = errors.New("too many subscriptions")
+	errUnknownMessageType    = errors.New("unknown message type")
+)
+
+type subscriptionMessage struct {
+	Id      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// connectionParams are sent with connection_init, for clients that can't set
+// an authorization header on the websocket request (i.e. browsers).
+type connectionParams struct {
+	Authorization string `json:"Authorization"`
+	AuthToken     string `json:"authToken"`
+}
+
+// browsers authenticate subscriptions in connection_init rather than with
+// cookies, so there's nothing for another origin to ride on.
+var subscriptionUpgrader = websocket.Upgrader{
+	Subprotocols: []string{subscriptionProtocol},
+	CheckOrigin:  func(r *http.Request) bool { return true },
+}
+
+type subscriptionSession struct {
+	composter  *Composter
+	ws         *websocket.Conn
+	writeMut   sync.Mutex
+	user       *schema.User
+	auth       *session.Session
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mut        sync.Mutex
+	operations map[string]*subscriptionOperation
+}
+
+// subscriptionOperation is one started subscription. While its document is
+// first executed it's attached to the context, so that subscription fields
+// can register what they watch.
+type subscriptionOperation struct {
+	id            string
+	document      *ast.Document
+	operationName string
+	variables     map[string]interface{}
+	events        chan *schema.CheckStateTransition
+	subscribers   []*checkStateSubscriber
+	stop          chan struct{}
+}
+
+func (s *Composter) subscriptions() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var (
+			user *schema.User
+			auth *session.Session
+		)
+		if header := r.Header.Get("authorization"); header != "" {
+			var err error
+			user, auth, err = s.bearerUser(r.Context(), header)
+			if err != nil {
+				msg, _ := json.Marshal(tp.MessageResponse{Message: err.Error()})
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(authStatus(err))
+				rw.Write(msg)
+				return
+			}
+		}
+
+		ws, err := subscriptionUpgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			log.WithError(err).Error("error upgrading subscription websocket")
+			return
+		}
+
+		session := &subscriptionSession{
+			composter:  s,
+			ws:         ws,
+			user:       user,
+			auth:       auth,
+			operations: make(map[string]*subscriptionOperation),
+		}
+		session.ctx, session.cancel = context.WithCancel(context.Background())
+		ws.SetReadLimit(subscriptionMaxMessage)
+
+		go func() {
+			select {
+			case <-s.shuttingDown:
+				session.closeWith(websocket.CloseGoingAway, "server shutting down")
+			case <-session.ctx.Done():
+			}
+		}()
+
+		session.serve()
+	}
+}
+
+func (session *subscriptionSession) serve() {
+	defer session.close()
+
+	initialized := false
+
+	for {
+		_, data, err := session.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				log.WithError(err).Errorf("error reading from websocket %s", session.ws.RemoteAddr())
+			}
+			return
+		}
+
+		msg := &subscriptionMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			session.sendError("", err)
+			continue
+		}
+
+		switch msg.Type {
+		case gqlConnectionInit:
+			// the session's user is fixed once it's acknowledged
+			if initialized {
+				session.send("", gqlConnectionError, tp.MessageResponse{Message: errConnectionInitTwice.Error()})
+				session.closeWith(websocket.ClosePolicyViolation, errConnectionInitTwice.Error())
+				return
+			}
+
+			if err := session.init(msg.Payload); err != nil {
+				session.send("", gqlConnectionError, tp.MessageResponse{Message: err.Error()})
+				session.closeWith(websocket.ClosePolicyViolation, err.Error())
+				return
+			}
+
+			initialized = true
+			session.send("", gqlConnectionAck, nil)
+			go session.keepAlive()
+
+		case gqlStart:
+			if !initialized {
+				session.sendError(msg.Id, errConnectionNotInit)
+				continue
+			}
+
+			session.start(msg.Id, msg.Payload)
+
+		case gqlStop:
+			session.stop(msg.Id)
+			session.send(msg.Id, gqlComplete, nil)
+
+		case gqlConnectionTerminate:
+			session.closeWith(websocket.CloseNormalClosure, "")
+			return
+
+		default:
+			session.sendError(msg.Id, errUnknownMessageType)
+		}
+	}
+}
+
+// init authenticates the session from connection params, unless the websocket
+// request already had an authorization header.
+func (session *subscriptionSession) init(payload json.RawMessage) error {
+	if session.user != nil {
+		return nil
+	}
+
+	params := &connectionParams{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, params); err != nil {
+			return err
+		}
+	}
+
+	header := params.Authorization
+	if header == "" && params.AuthToken != "" {
+		header = "Bearer " + params.AuthToken
+	}
+
+	if header == "" {
+		return errDecodeUser
+	}
+
+	user, auth, err := session.composter.bearerUser(session.ctx, header)
+	if err != nil {
+		return err
+	}
+
+	session.user = user
+	session.auth = auth
+	return nil
+}
+
+func (session *subscriptionSession) start(id string, payload json.RawMessage) {
+	request := &GraphQLRequest{}
+	if err := json.Unmarshal(payload, request); err != nil {
+		session.sendError(id, err)
+		return
+	}
+
+	if err := request.Validate(); err != nil {
+		session.sendError(id, err)
+		return
+	}
+
+	query, err := session.composter.persistedQueries.resolve(request)
+	if err != nil {
+		session.sendError(id, err)
+		return
+	}
+
+	session.mut.Lock()
+	_, exists := session.operations[id]
+	running := len(session.operations)
+	session.mut.Unlock()
+	if exists {
+		session.sendError(id, errDuplicateSubscription)
+		return
+	}
+
+	if running >= subscriptionMaxOperations {
+		session.sendError(id, errTooManySubscriptions)
+		return
+	}
+
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: query,
+			Name: "GraphQL subscription",
+		}),
+	})
+	if err != nil {
+		session.send(id, gqlError, queryErrors(ErrorParseFailed, gqlerrors.FormatError(err)).Errors)
+		return
+	}
+
+	operation, err := operationDefinition(document, request.OperationName)
+	if err != nil {
+		session.send(id, gqlError, queryErrors(ErrorValidationFailed, gqlerrors.FormatError(err)).Errors)
+		return
+	}
+
+	if operation.Operation != "subscription" {
+		session.sendError(id, errNotSubscription)
+		return
+	}
+
+	// the graphql executor only knows about queries and mutations, so the
+	// subscription schema has its subscription root as its query root, and
+	// subscriptions are run as queries against it.
+	operation.Operation = "query"
+
+	validation := graphql.ValidateDocument(&session.composter.SubscriptionSchema, document, nil)
+	if !validation.IsValid {
+		session.send(id, gqlError, queryErrors(ErrorValidationFailed, validation.Errors...).Errors)
+		return
+	}
+
+	if err := session.composter.checkComplexity(&session.composter.SubscriptionSchema, document, request.OperationName); err != nil {
+		session.send(id, gqlError, queryErrors(ErrorQueryTooComplex, gqlerrors.FormatError(err)).Errors)
+		return
+	}
+
+	op := &subscriptionOperation{
+		id:            id,
+		document:      document,
+		operationName: request.OperationName,
+		variables:     request.Variables,
+		events:        make(chan *schema.CheckStateTransition, checkStateEventBuffer),
+		stop:          make(chan struct{}),
+	}
+
+	result := session.execute(op, context.WithValue(session.userContext(), subscriptionKey, op), map[string]interface{}{})
+	if result.HasErrors() {
+		session.unsubscribe(op)
+		session.send(id, gqlError, result.Errors)
+		return
+	}
+
+	session.mut.Lock()
+	session.operations[id] = op
+	session.mut.Unlock()
+
+	go session.run(op)
+}
+
+// run sends a data message each time one of the operation's subscriptions fires.
+func (session *subscriptionSession) run(op *subscriptionOperation) {
+	for {
+		select {
+		case transition := <-op.events:
+			result := session.execute(op, session.userContext(), map[string]interface{}{
+				"checkStateChanged": transition,
+			})
+			session.send(op.id, gqlData, result)
+
+		case <-op.stop:
+			return
+
+		case <-session.ctx.Done():
+			return
+		}
+	}
+}
+
+func (session *subscriptionSession) execute(op *subscriptionOperation, ctx context.Context, root map[string]interface{}) *Result {
+	ctx, errs := withResolverErrors(ctx)
+
+	return errs.result(graphql.Execute(graphql.ExecuteParams{
+		Schema:        session.composter.SubscriptionSchema,
+		Root:          root,
+		AST:           op.document,
+		OperationName: op.operationName,
+		Args:          op.variables,
+		Context:       ctx,
+	}))
+}
+
+func (session *subscriptionSession) userContext() context.Context {
+	return context.WithValue(session.ctx, userKey, session.user)
+}
+
+func (session *subscriptionSession) stop(id string) {
+	session.mut.Lock()
+	op, ok := session.operations[id]
+	delete(session.operations, id)
+	session.mut.Unlock()
+
+	if ok {
+		session.unsubscribe(op)
+		close(op.stop)
+	}
+}
+
+func (session *subscriptionSession) unsubscribe(op *subscriptionOperation) {
+	for _, sub := range op.subscribers {
+		session.composter.checkStates.unsubscribe(session.user, sub)
+	}
+}
+
+func (session *subscriptionSession) keepAlive() {
+	ticker := time.NewTicker(subscriptionKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// tokens can expire or be revoked while their subscriptions run
+			if err := session.checkAuth(); err != nil {
+				session.send("", gqlConnectionError, tp.MessageResponse{Message: err.Error()})
+				session.closeWith(websocket.ClosePolicyViolation, err.Error())
+				return
+			}
+
+			session.send("", gqlConnectionKeepAlive, nil)
+		case <-session.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkAuth returns an error if the session's token has expired or been
+// revoked. Errors checking it are let go, so that a store outage doesn't drop
+// every subscription.
+func (session *subscriptionSession) checkAuth() error {
+	if session.auth == nil {
+		return nil
+	}
+
+	if err := session.composter.sessions.check(session.ctx, session.auth); err != errSessionCheck {
+		return err
+	}
+
+	return nil
+}
+
+func (session *subscriptionSession) close() {
+	session.mut.Lock()
+	ids := make([]string, 0, len(session.operations))
+	for id := range session.operations {
+		ids = append(ids, id)
+	}
+	session.mut.Unlock()
+
+	for _, id := range ids {
+		session.stop(id)
+	}
+
+	session.cancel()
+	session.closeWith(websocket.CloseNormalClosure, "")
+}
+
+func (session *subscriptionSession) send(id, messageType string, payload interface{}) {
+	msg := &subscriptionMessage{Id: id, Type: messageType}
+
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			log.WithError(err).Error("error encoding subscription payload")
+			return
+		}
+		msg.Payload = data
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.WithError(err).Error("error encoding subscription message")
+		return
+	}
+
+	session.writeMut.Lock()
+	defer session.writeMut.Unlock()
+
+	session.ws.SetWriteDeadline(time.Now().Add(subscriptionWriteWait))
+	if err := session.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+		log.WithError(err).Errorf("error writing to websocket %s", session.ws.RemoteAddr())
+	}
+}
+
+// closeWith sends a close message with code and reason, then closes the
+// connection. Reasons are cut short to fit in a control frame.
+func (session *subscriptionSession) closeWith(code int, reason string) {
+	if len(reason) > subscriptionMaxCloseReason {
+		reason = reason[:subscriptionMaxCloseReason]
+	}
+
+	session.writeMut.Lock()
+	defer session.writeMut.Unlock()
+
+	session.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(subscriptionWriteWait))
+	session.ws.Close()
+}
+
+func (session *subscriptionSession) sendError(id string, err error) {
+	session.send(id, gqlError, []*Error{newError(err)})
+}
+
+// watchCheckState subscribes the operation to a check's state transitions.
+func (op *subscriptionOperation) watchCheckState(ctx context.Context, watcher *checkStateWatcher, user *schema.User, checkId string) error {
+	sub, err := watcher.subscribe(ctx, user, checkId, op.events)
+	if err != nil {
+		return err
+	}
+
+	op.subscribers = append(op.subscribers, sub)
+	return nil
+}
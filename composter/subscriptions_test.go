@@ -0,0 +1,232 @@
+package composter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"github.com/opsee/compost/fake"
+	opsee_types "github.com/opsee/protobuf/opseeproto/types"
+	"github.com/opsee/vaper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// transitioningCats adds a new state transition after the first call.
+type transitioningCats struct {
+	opsee.CatsClient
+	calls int32
+}
+
+func (c *transitioningCats) GetCheckStateTransitions(ctx context.Context, in *opsee.GetCheckStateTransitionsRequest, opts ...grpc.CallOption) (*opsee.GetCheckStateTransitionsResponse, error) {
+	resp, err := c.CatsClient.GetCheckStateTransitions(ctx, in, opts...)
+	if err != nil || atomic.AddInt32(&c.calls, 1) == 1 {
+		return resp, err
+	}
+
+	occurred := &opsee_types.Timestamp{}
+	occurred.Scan(time.Now())
+	resp.Transitions = append(resp.Transitions, &schema.CheckStateTransition{
+		Id:         100,
+		CheckId:    in.CheckId,
+		CustomerId: in.CustomerId,
+		From:       "passing",
+		To:         "warning",
+		OccurredAt: occurred,
+	})
+
+	return resp, nil
+}
+
+func TestSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+
+	client := fake.NewClient(fake.DefaultFixtures())
+	client.Cats = &transitioningCats{CatsClient: client.Cats}
+	c, err := New(client, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.checkStates = newCheckStateWatcher(client, 50*time.Millisecond)
+
+	server := httptest.NewServer(c.router)
+	defer server.Close()
+
+	conn := testWebsocketDial(t, server.URL)
+	defer conn.Close()
+
+	testWebsocketWrite(t, conn, testConnectionInit(t))
+	assert.Equal(gqlConnectionAck, testWebsocketRead(t, conn).Type)
+
+	testWebsocketWrite(t, conn, `{"id": "1", "type": "start", "payload": {"query": "subscription OnCheckState { checkStateChanged(check_id: \"fake-check-1\") { id from to } }"}}`)
+
+	msg := testWebsocketRead(t, conn)
+	assert.Equal(gqlData, msg.Type)
+	assert.Equal("1", msg.Id)
+	assert.JSONEq(`{"data": {"checkStateChanged": {"id": 100, "from": "passing", "to": "warning"}}}`, string(msg.Payload))
+
+	testWebsocketWrite(t, conn, `{"id": "2", "type": "start", "payload": {"query": "{ checkStateChanged(check_id: \"fake-check-1\") { id } }"}}`)
+	msg = testWebsocketRead(t, conn)
+	assert.Equal(gqlError, msg.Type)
+	assert.Equal("2", msg.Id)
+
+	testWebsocketWrite(t, conn, `{"id": "1", "type": "stop"}`)
+	msg = testWebsocketRead(t, conn)
+	assert.Equal(gqlComplete, msg.Type)
+}
+
+func TestSubscriptionsAuth(t *testing.T) {
+	assert := assert.New(t)
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(c.router)
+	defer server.Close()
+
+	conn := testWebsocketDial(t, server.URL)
+	defer conn.Close()
+
+	testWebsocketWrite(t, conn, `{"type": "connection_init", "payload": {"authToken": "`+bearerToke+`"}}`)
+	assert.Equal(gqlConnectionError, testWebsocketRead(t, conn).Type)
+
+	req, err := http.NewRequest("GET", server.URL+"/graphql/subscriptions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Basic nope")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestSubscriptionsConnectionInitTwice(t *testing.T) {
+	assert := assert.New(t)
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(c.router)
+	defer server.Close()
+
+	conn := testWebsocketDial(t, server.URL)
+	defer conn.Close()
+
+	testWebsocketWrite(t, conn, testConnectionInit(t))
+	assert.Equal(gqlConnectionAck, testWebsocketRead(t, conn).Type)
+
+	testWebsocketWrite(t, conn, testConnectionInit(t))
+	assert.Equal(gqlConnectionError, testWebsocketRead(t, conn).Type)
+
+	_, _, err = conn.ReadMessage()
+	assert.True(websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+}
+
+func TestSubscriptionsLimits(t *testing.T) {
+	assert := assert.New(t)
+	c, err := New(fake.NewClient(fake.DefaultFixtures()), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.checkStates = newCheckStateWatcher(c.resolver, time.Hour)
+
+	server := httptest.NewServer(c.router)
+	defer server.Close()
+
+	conn := testWebsocketDial(t, server.URL)
+	defer conn.Close()
+
+	testWebsocketWrite(t, conn, testConnectionInit(t))
+	assert.Equal(gqlConnectionAck, testWebsocketRead(t, conn).Type)
+
+	start := func(id string) {
+		testWebsocketWrite(t, conn, `{"id": "`+id+`", "type": "start", "payload": {"query": "subscription OnCheckState { checkStateChanged(check_id: \"fake-check-1\") { id } }"}}`)
+	}
+
+	for i := 0; i < subscriptionMaxOperations; i++ {
+		start(strconv.Itoa(i))
+	}
+
+	// the connection's subscriptions only answer on errors
+	start("one too many")
+	msg := testWebsocketRead(t, conn)
+	assert.Equal(gqlError, msg.Type)
+	assert.Equal("one too many", msg.Id)
+	assert.Contains(string(msg.Payload), errTooManySubscriptions.Error())
+
+	// and the customer's are limited across connections
+	c.checkStates.mut.Lock()
+	c.checkStates.maxSubscribers = subscriptionMaxOperations
+	c.checkStates.mut.Unlock()
+
+	other := testWebsocketDial(t, server.URL)
+	defer other.Close()
+
+	testWebsocketWrite(t, other, testConnectionInit(t))
+	assert.Equal(gqlConnectionAck, testWebsocketRead(t, other).Type)
+
+	testWebsocketWrite(t, other, `{"id": "1", "type": "start", "payload": {"query": "subscription OnCheckState { checkStateChanged(check_id: \"fake-check-2\") { id } }"}}`)
+	msg = testWebsocketRead(t, other)
+	assert.Equal(gqlError, msg.Type)
+	assert.Contains(string(msg.Payload), errTooManySubscriptions.Error())
+}
+
+// testConnectionInit is a connection_init message with an admin's token.
+func testConnectionInit(t *testing.T) string {
+	user := &schema.User{Id: 1, CustomerId: fake.CustomerId, Email: "fake@opsee.com", Active: true, Perms: &schema.UserFlags{Admin: true}}
+	token, err := vaper.New(user, user.Email, time.Now(), time.Now().Add(time.Hour)).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return `{"type": "connection_init", "payload": {"authToken": "` + token + `"}}`
+}
+
+func testWebsocketDial(t *testing.T, serverURL string) *websocket.Conn {
+	dialer := &websocket.Dialer{Subprotocols: []string{subscriptionProtocol}}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/graphql/subscriptions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Protocol") != subscriptionProtocol {
+		t.Fatal("websocket protocol not chosen")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func testWebsocketWrite(t *testing.T, conn *websocket.Conn, message string) {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWebsocketRead(t *testing.T, conn *websocket.Conn) *subscriptionMessage {
+	for {
+		msg := &subscriptionMessage{}
+		if err := conn.ReadJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		// skip keepalives
+		if msg.Type != gqlConnectionKeepAlive {
+			return msg
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package composter
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/resolver"
+	log "github.com/opsee/logrus"
+	opsee_types "github.com/opsee/protobuf/opseeproto/types"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultCheckStatePollInterval = 10 * time.Second
+	checkStateEventBuffer         = 16
+
+	// checkStateMaxSubscribers is how many check state subscriptions one
+	// customer can have across all of their connections.
+	checkStateMaxSubscribers = 200
+)
+
+// checkStateWatcher polls cats for new check state transitions on behalf of
+// subscribers. There is one poller per customer with subscribers, which only
+// asks about the checks somebody is watching, and stops when the last
+// subscriber for that customer goes away. Each check is polled as one of the
+// users still subscribed to it, who could see it when they subscribed.
+type checkStateWatcher struct {
+	resolver       *resolver.Client
+	interval       time.Duration
+	maxSubscribers int
+	mut            sync.Mutex
+	watches        map[string]*customerWatch
+}
+
+type customerWatch struct {
+	subscribers map[*checkStateSubscriber]struct{}
+	stop        chan struct{}
+
+	// the newest transition id seen per check, so that only new transitions
+	// are sent. polls overlap a little, in case cats is slow to write them.
+	lastIds  map[string]int64
+	lastPoll time.Time
+}
+
+type checkStateSubscriber struct {
+	user    *schema.User
+	checkId string
+	events  chan<- *schema.CheckStateTransition
+}
+
+func newCheckStateWatcher(resolver *resolver.Client, interval time.Duration) *checkStateWatcher {
+	return &checkStateWatcher{
+		resolver:       resolver,
+		interval:       interval,
+		maxSubscribers: checkStateMaxSubscribers,
+		watches:        make(map[string]*customerWatch),
+	}
+}
+
+// subscribe sends new transitions for checkId to events until unsubscribe is
+// called. Slow subscribers miss events rather than blocking the poller.
+func (w *checkStateWatcher) subscribe(ctx context.Context, user *schema.User, checkId string, events chan<- *schema.CheckStateTransition) (*checkStateSubscriber, error) {
+	if w.full(user.CustomerId) {
+		return nil, errTooManySubscriptions
+	}
+
+	// find where this check is at now, which also makes sure the user can see it
+	now := time.Now()
+	transitions, err := w.transitions(ctx, user, checkId, now.Add(-w.interval), now)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &checkStateSubscriber{user: user, checkId: checkId, events: events}
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	watch, ok := w.watches[user.CustomerId]
+	if ok && len(watch.subscribers) >= w.maxSubscribers {
+		return nil, errTooManySubscriptions
+	}
+
+	if !ok {
+		watch = &customerWatch{
+			subscribers: make(map[*checkStateSubscriber]struct{}),
+			stop:        make(chan struct{}),
+			lastIds:     make(map[string]int64),
+			lastPoll:    now,
+		}
+		w.watches[user.CustomerId] = watch
+
+		go w.poll(watch)
+	}
+
+	lastId := watch.lastIds[checkId]
+	for _, transition := range transitions {
+		if transition.Id > lastId {
+			lastId = transition.Id
+		}
+	}
+
+	watch.lastIds[checkId] = lastId
+	watch.subscribers[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// full reports whether the customer has as many subscribers as they can have.
+func (w *checkStateWatcher) full(customerId string) bool {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	watch, ok := w.watches[customerId]
+	return ok && len(watch.subscribers) >= w.maxSubscribers
+}
+
+func (w *checkStateWatcher) unsubscribe(user *schema.User, sub *checkStateSubscriber) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	watch, ok := w.watches[user.CustomerId]
+	if !ok {
+		return
+	}
+
+	delete(watch.subscribers, sub)
+	if len(watch.subscribers) == 0 {
+		close(watch.stop)
+		delete(w.watches, user.CustomerId)
+	}
+}
+
+func (w *checkStateWatcher) poll(watch *customerWatch) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.pollOnce(watch)
+		case <-watch.stop:
+			return
+		}
+	}
+}
+
+func (w *checkStateWatcher) pollOnce(watch *customerWatch) {
+	w.mut.Lock()
+	checkIds := make(map[string]*schema.User)
+	for sub := range watch.subscribers {
+		checkIds[sub.checkId] = sub.user
+	}
+
+	now := time.Now()
+	since := watch.lastPoll.Add(-w.interval)
+	watch.lastPoll = now
+	w.mut.Unlock()
+
+	for checkId, user := range checkIds {
+		ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+		transitions, err := w.transitions(ctx, user, checkId, since, now)
+		cancel()
+
+		if err != nil {
+			log.WithError(err).WithField("check_id", checkId).Error("error polling check state transitions")
+			continue
+		}
+
+		w.publish(watch, checkId, transitions)
+	}
+}
+
+func (w *checkStateWatcher) transitions(ctx context.Context, user *schema.User, checkId string, since, until time.Time) ([]*schema.CheckStateTransition, error) {
+	startTime := &opsee_types.Timestamp{}
+	startTime.Scan(since)
+	endTime := &opsee_types.Timestamp{}
+	endTime.Scan(until)
+
+	return w.resolver.GetCheckStateTransitions(ctx, user, checkId, startTime, endTime)
+}
+
+// publish sends transitions newer than the last one seen to the check's
+// subscribers, oldest first.
+func (w *checkStateWatcher) publish(watch *customerWatch, checkId string, transitions []*schema.CheckStateTransition) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	sorted := make([]*schema.CheckStateTransition, len(transitions))
+	copy(sorted, transitions)
+	sort.Sort(transitionList(sorted))
+
+	for _, transition := range sorted {
+		if transition.Id <= watch.lastIds[checkId] {
+			continue
+		}
+		watch.lastIds[checkId] = transition.Id
+
+		for sub := range watch.subscribers {
+			if sub.checkId != checkId {
+				continue
+			}
+
+			select {
+			case sub.events <- transition:
+			default:
+				log.WithField("check_id", checkId).Warn("dropping check state transition for slow subscriber")
+			}
+		}
+	}
+}
+
+type transitionList []*schema.CheckStateTransition
+
+func (l transitionList) Len() int           { return len(l) }
+func (l transitionList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l transitionList) Less(i, j int) bool { return l[i].Id < l[j].Id }
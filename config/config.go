@@ -0,0 +1,271 @@
+// Package config loads compost's settings from a json config file, with
+// overrides from the environment.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opsee/compost/composter"
+	"github.com/opsee/compost/resolver"
+	"github.com/opsee/compost/tracing"
+)
+
+const (
+	envPrefix = "COMPOST_"
+
+	defaultShutdownGraceSeconds = 30
+)
+
+var (
+	errMissingAddress        = errors.New("missing listen address")
+	errMissingVapeKeyfile    = errors.New("missing vape keyfile")
+	errNegativeShutdownGrace = errors.New("shutdown grace period can't be negative")
+)
+
+type Config struct {
+	Address     string                `json:"address"`
+	VapeKeyfile string                `json:"vape_keyfile"`
+	Backends    resolver.ClientConfig `json:"backends"`
+	GraphQL     composter.Config      `json:"graphql"`
+	Tracing     tracing.Config        `json:"tracing"`
+
+	// ShutdownGraceSeconds is how long in flight requests get to finish
+	// after a SIGTERM.
+	ShutdownGraceSeconds int `json:"shutdown_grace_seconds"`
+}
+
+// Default returns the production configuration, which is used for anything
+// not set in the config file or environment.
+func Default() *Config {
+	return &Config{
+		Backends: resolver.ClientConfig{
+			Bartnet:      "https://bartnet.in.opsee.com",
+			Beavis:       "https://beavis.in.opsee.com",
+			Spanx:        "spanx.in.opsee.com:8443",
+			Cats:         "cats.in.opsee.com:443",
+			Keelhaul:     "keelhaul.in.opsee.com:443",
+			Bezos:        "bezosphere.in.opsee.com:8443",
+			Hugs:         "https://hugs.in.opsee.com",
+			Marktricks:   "marktricks.in.opsee.com:443",
+			Etcd:         "http://etcd.in.opsee.com:2479",
+			DynamoRegion: "us-west-2",
+		},
+		ShutdownGraceSeconds: defaultShutdownGraceSeconds,
+	}
+}
+
+// Load reads the config file at path (if path isn't empty) over the defaults,
+// then applies environment overrides and validates the result.
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(data, config)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %s", path, err)
+		}
+	}
+
+	err := config.applyEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (config *Config) Validate() error {
+	if config.Address == "" {
+		return errMissingAddress
+	}
+
+	if config.VapeKeyfile == "" {
+		return errMissingVapeKeyfile
+	}
+
+	if config.ShutdownGraceSeconds < 0 {
+		return errNegativeShutdownGrace
+	}
+
+	if err := config.Tracing.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.GraphQL.ApiKeys.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.GraphQL.Sessions.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.GraphQL.Audit.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.GraphQL.Scopes.Validate(); err != nil {
+		return err
+	}
+
+	return config.Backends.Validate()
+}
+
+// ShutdownGrace is the shutdown grace period.
+func (config *Config) ShutdownGrace() time.Duration {
+	return time.Duration(config.ShutdownGraceSeconds) * time.Second
+}
+
+// applyEnv overrides config with any COMPOST_ environment variables that are set.
+// Backend addresses are set with COMPOST_<BACKEND> (e.g. COMPOST_BARTNET), and
+// backend tls with COMPOST_<BACKEND>_SKIP_VERIFY, _CA_FILE, _CERT_FILE, _KEY_FILE
+// and _PLAINTEXT.
+func (config *Config) applyEnv(getenv func(string) string) error {
+	setString(getenv, "ADDRESS", &config.Address)
+	setString(getenv, "VAPE_KEYFILE", &config.VapeKeyfile)
+	setString(getenv, "DYNAMO_REGION", &config.Backends.DynamoRegion)
+	setString(getenv, "PERSISTED_QUERIES_FILE", &config.GraphQL.PersistedQueriesFile)
+	setString(getenv, "TRACE_EXPORTER", &config.Tracing.Exporter)
+	setString(getenv, "TRACE_FILE", &config.Tracing.File)
+	setString(getenv, "API_KEY_STORE", &config.GraphQL.ApiKeys.Store)
+	setString(getenv, "API_KEY_FILE", &config.GraphQL.ApiKeys.File)
+	setString(getenv, "SESSION_STORE", &config.GraphQL.Sessions.Store)
+	setString(getenv, "AUDIT_SINK", &config.GraphQL.Audit.Sink)
+	setString(getenv, "AUDIT_FILE", &config.GraphQL.Audit.File)
+	setString(getenv, "AUDIT_TABLE", &config.GraphQL.Audit.Table)
+	setString(getenv, "SCOPE_STORE", &config.GraphQL.Scopes.Store)
+
+	if err := setBool(getenv, "SKIP_VERIFY", &config.Backends.SkipVerify); err != nil {
+		return err
+	}
+
+	if err := setBool(getenv, "STRICT_PERSISTED_QUERIES", &config.GraphQL.StrictPersistedQueries); err != nil {
+		return err
+	}
+
+	if err := setBool(getenv, "DISABLE_INTROSPECTION", &config.GraphQL.DisableIntrospection); err != nil {
+		return err
+	}
+
+	if err := setInt(getenv, "MAX_QUERY_DEPTH", &config.GraphQL.MaxQueryDepth); err != nil {
+		return err
+	}
+
+	if err := setInt(getenv, "MAX_QUERY_COST", &config.GraphQL.MaxQueryCost); err != nil {
+		return err
+	}
+
+	if err := setInt(getenv, "SHUTDOWN_GRACE_SECONDS", &config.ShutdownGraceSeconds); err != nil {
+		return err
+	}
+
+	for name, addr := range backendAddresses(&config.Backends) {
+		env := strings.ToUpper(name)
+		setString(getenv, env, addr)
+
+		tlsConfig := &resolver.TLSConfig{}
+		if existing, ok := config.Backends.TLS[name]; ok && existing != nil {
+			*tlsConfig = *existing
+		}
+
+		set := setString(getenv, env+"_CA_FILE", &tlsConfig.CAFile)
+		set = setString(getenv, env+"_CERT_FILE", &tlsConfig.CertFile) || set
+		set = setString(getenv, env+"_KEY_FILE", &tlsConfig.KeyFile) || set
+
+		for _, b := range []struct {
+			env string
+			val *bool
+		}{
+			{env + "_SKIP_VERIFY", &tlsConfig.SkipVerify},
+			{env + "_PLAINTEXT", &tlsConfig.Plaintext},
+		} {
+			if getenv(envPrefix+b.env) == "" {
+				continue
+			}
+
+			if err := setBool(getenv, b.env, b.val); err != nil {
+				return err
+			}
+			set = true
+		}
+
+		if set {
+			if config.Backends.TLS == nil {
+				config.Backends.TLS = make(map[string]*resolver.TLSConfig)
+			}
+			config.Backends.TLS[name] = tlsConfig
+		}
+	}
+
+	return nil
+}
+
+func backendAddresses(backends *resolver.ClientConfig) map[string]*string {
+	return map[string]*string{
+		resolver.BackendBartnet:    &backends.Bartnet,
+		resolver.BackendBeavis:     &backends.Beavis,
+		resolver.BackendSpanx:      &backends.Spanx,
+		resolver.BackendCats:       &backends.Cats,
+		resolver.BackendKeelhaul:   &backends.Keelhaul,
+		resolver.BackendBezos:      &backends.Bezos,
+		resolver.BackendHugs:       &backends.Hugs,
+		resolver.BackendMarktricks: &backends.Marktricks,
+		resolver.BackendEtcd:       &backends.Etcd,
+	}
+}
+
+func setString(getenv func(string) string, env string, val *string) bool {
+	v := getenv(envPrefix + env)
+	if v == "" {
+		return false
+	}
+
+	*val = v
+	return true
+}
+
+func setBool(getenv func(string) string, env string, val *bool) error {
+	v := getenv(envPrefix + env)
+	if v == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s%s: %s", envPrefix, env, v)
+	}
+
+	*val = b
+	return nil
+}
+
+func setInt(getenv func(string) string, env string, val *int) error {
+	v := getenv(envPrefix + env)
+	if v == "" {
+		return nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s%s: %s", envPrefix, env, v)
+	}
+
+	*val = i
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opsee/compost/resolver"
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := ioutil.TempFile("", "compost-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{
+		"address": ":9096",
+		"vape_keyfile": "/vape.test.key",
+		"backends": {
+			"cats": "localhost:9105",
+			"dynamo_region": "us-east-1",
+			"tls": {"cats": {"plaintext": true}}
+		}
+	}`)
+	f.Close()
+
+	config, err := Load(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(":9096", config.Address)
+	assert.Equal("localhost:9105", config.Backends.Cats)
+	assert.Equal("us-east-1", config.Backends.DynamoRegion)
+	assert.True(config.Backends.TLS[resolver.BackendCats].Plaintext)
+
+	// defaults are kept for anything not in the file
+	assert.Equal("https://bartnet.in.opsee.com", config.Backends.Bartnet)
+}
+
+func TestApplyEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	config := Default()
+	err := config.applyEnv(env(map[string]string{
+		"COMPOST_ADDRESS":                  ":8080",
+		"COMPOST_VAPE_KEYFILE":             "/vape.key",
+		"COMPOST_BEZOS":                    "localhost:9104",
+		"COMPOST_BEZOS_SKIP_VERIFY":        "true",
+		"COMPOST_SPANX_CA_FILE":            "/ca.pem",
+		"COMPOST_STRICT_PERSISTED_QUERIES": "true",
+		"COMPOST_DISABLE_INTROSPECTION":    "true",
+		"COMPOST_MAX_QUERY_COST":           "500",
+		"COMPOST_SHUTDOWN_GRACE_SECONDS":   "5",
+		"COMPOST_TRACE_EXPORTER":           "stdout",
+		"COMPOST_SESSION_STORE":            "etcd",
+		"COMPOST_AUDIT_SINK":               "file",
+		"COMPOST_AUDIT_FILE":               "/var/log/compost/audit.json",
+		"COMPOST_SCOPE_STORE":              "etcd",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(":8080", config.Address)
+	assert.Equal("localhost:9104", config.Backends.Bezos)
+	assert.True(config.Backends.TLS[resolver.BackendBezos].SkipVerify)
+	assert.Equal("/ca.pem", config.Backends.TLS[resolver.BackendSpanx].CAFile)
+	assert.Nil(config.Backends.TLS[resolver.BackendCats])
+	assert.True(config.GraphQL.StrictPersistedQueries)
+	assert.True(config.GraphQL.DisableIntrospection)
+	assert.Equal(500, config.GraphQL.MaxQueryCost)
+	assert.Equal(5*time.Second, config.ShutdownGrace())
+	assert.Equal("stdout", config.Tracing.Exporter)
+	assert.Equal("etcd", config.GraphQL.Sessions.Store)
+	assert.Equal("/var/log/compost/audit.json", config.GraphQL.Audit.File)
+	assert.Equal("etcd", config.GraphQL.Scopes.Store)
+	assert.NoError(config.Validate())
+
+	err = config.applyEnv(env(map[string]string{"COMPOST_SKIP_VERIFY": "sure"}))
+	assert.Error(err)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	config := Default()
+	assert.Error(config.Validate())
+
+	config.Address = ":9096"
+	config.VapeKeyfile = "/vape.key"
+	assert.NoError(config.Validate())
+
+	config.Backends.TLS = map[string]*resolver.TLSConfig{
+		resolver.BackendHugs: &resolver.TLSConfig{SkipVerify: true},
+	}
+	assert.NoError(config.Validate())
+
+	config.Backends.TLS = map[string]*resolver.TLSConfig{
+		"nope": &resolver.TLSConfig{SkipVerify: true},
+	}
+	assert.Error(config.Validate())
+
+	config.Backends.TLS = map[string]*resolver.TLSConfig{
+		resolver.BackendCats: &resolver.TLSConfig{CertFile: "/cert.pem"},
+	}
+	assert.Error(config.Validate())
+
+	config.Backends.TLS = nil
+	config.Tracing.Exporter = "file"
+	assert.Error(config.Validate())
+
+	config.Tracing.Exporter = ""
+	config.Backends.Etcd = ""
+	assert.Error(config.Validate())
+}
@@ -0,0 +1,405 @@
+package fake
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Cats implements opsee.CatsClient.
+type Cats struct {
+	*Store
+}
+
+func (c *Cats) GetCheckCount(ctx context.Context, in *opsee.GetCheckCountRequest, opts ...grpc.CallOption) (*opsee.GetCheckCountResponse, error) {
+	if err := requireUser(in.User); err != nil {
+		return nil, err
+	}
+
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var count int32
+	for _, check := range c.fixtures.Checks {
+		if check.CustomerId == in.User.CustomerId {
+			count++
+		}
+	}
+
+	return &opsee.GetCheckCountResponse{Count: count}, nil
+}
+
+func (c *Cats) GetUser(ctx context.Context, in *opsee.GetUserRequest, opts ...grpc.CallOption) (*opsee.GetUserResponse, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	for _, user := range c.fixtures.Users {
+		if in.Id != 0 && user.Id != in.Id {
+			continue
+		}
+
+		if in.Email != "" && !strings.EqualFold(user.Email, in.Email) {
+			continue
+		}
+
+		if in.CustomerId != "" && user.CustomerId != in.CustomerId {
+			continue
+		}
+
+		return &opsee.GetUserResponse{User: clone(user).(*schema.User)}, nil
+	}
+
+	return nil, notFound("user", in.Id)
+}
+
+func (c *Cats) UpdateUser(ctx context.Context, in *opsee.UpdateUserRequest, opts ...grpc.CallOption) (*opsee.UserTokenResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	if in.User == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing user")
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	user := c.user(in.User.Id)
+	if user == nil || user.CustomerId != in.Requestor.CustomerId {
+		return nil, notFound("user", in.User.Id)
+	}
+
+	if in.Email != "" {
+		user.Email = in.Email
+	}
+
+	if in.Name != "" {
+		user.Name = in.Name
+	}
+
+	if in.Status != "" {
+		user.Status = in.Status
+	}
+
+	if in.Perms != nil {
+		user.Perms = clone(in.Perms).(*schema.UserFlags)
+	}
+
+	user.UpdatedAt = timestamp(time.Now())
+
+	return &opsee.UserTokenResponse{User: clone(user).(*schema.User)}, nil
+}
+
+func (c *Cats) ListUsers(ctx context.Context, in *opsee.ListUsersRequest, opts ...grpc.CallOption) (*opsee.ListUsersResponse, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	page, perPage := in.Page, in.PerPage
+	if page < 1 {
+		page = 1
+	}
+
+	if perPage < 1 {
+		perPage = 20
+	}
+
+	users := make([]*schema.User, 0)
+	total := int32(len(c.fixtures.Users))
+	for i := (page - 1) * perPage; i < total && i < page*perPage; i++ {
+		users = append(users, clone(c.fixtures.Users[i]).(*schema.User))
+	}
+
+	return &opsee.ListUsersResponse{
+		Users:   users,
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+	}, nil
+}
+
+// InviteUser adds an invited user to the requestor's team.
+func (c *Cats) InviteUser(ctx context.Context, in *opsee.InviteUserRequest, opts ...grpc.CallOption) (*opsee.InviteUserResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	var id int32
+	for _, user := range c.fixtures.Users {
+		if user.Id > id {
+			id = user.Id
+		}
+	}
+	id++
+
+	perms := in.Perms
+	if perms != nil {
+		perms = clone(perms).(*schema.UserFlags)
+	}
+
+	now := timestamp(time.Now())
+	user := &schema.User{
+		Id:         id,
+		CustomerId: in.Requestor.CustomerId,
+		Email:      in.Email,
+		Name:       in.Name,
+		Status:     "invited",
+		Perms:      perms,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	c.fixtures.Users = append(c.fixtures.Users, user)
+
+	return &opsee.InviteUserResponse{
+		Invite: &schema.Invite{
+			Id:         id,
+			Email:      in.Email,
+			Name:       in.Name,
+			CustomerId: in.Requestor.CustomerId,
+			Perms:      in.Perms,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			Referrer:   in.Requestor.Email,
+		},
+	}, nil
+}
+
+func (c *Cats) DeleteUser(ctx context.Context, in *opsee.DeleteUserRequest, opts ...grpc.CallOption) (*opsee.DeleteUserResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	if in.User == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing user")
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for i, user := range c.fixtures.Users {
+		if user.Id == in.User.Id && user.CustomerId == in.Requestor.CustomerId {
+			c.fixtures.Users = append(c.fixtures.Users[:i], c.fixtures.Users[i+1:]...)
+			return &opsee.DeleteUserResponse{User: user}, nil
+		}
+	}
+
+	return nil, notFound("user", in.User.Id)
+}
+
+func (c *Cats) GetTeam(ctx context.Context, in *opsee.GetTeamRequest, opts ...grpc.CallOption) (*opsee.GetTeamResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	_, team := c.team(in.Requestor.CustomerId)
+	if team == nil {
+		return nil, notFound("team", in.Requestor.CustomerId)
+	}
+
+	return &opsee.GetTeamResponse{Team: c.teamWithUsers(team)}, nil
+}
+
+func (c *Cats) CreateTeam(ctx context.Context, in *opsee.CreateTeamRequest, opts ...grpc.CallOption) (*opsee.CreateTeamResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	if in.Team == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing team")
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if _, team := c.team(in.Requestor.CustomerId); team != nil {
+		return nil, grpc.Errorf(codes.AlreadyExists, "team %s already exists", team.Id)
+	}
+
+	team := clone(in.Team).(*schema.Team)
+	team.Id = in.Requestor.CustomerId
+	team.Users = nil
+	c.fixtures.Teams = append(c.fixtures.Teams, team)
+
+	return &opsee.CreateTeamResponse{Team: c.teamWithUsers(team)}, nil
+}
+
+func (c *Cats) UpdateTeam(ctx context.Context, in *opsee.UpdateTeamRequest, opts ...grpc.CallOption) (*opsee.UpdateTeamResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	if in.Team == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing team")
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	_, team := c.team(in.Requestor.CustomerId)
+	if team == nil {
+		return nil, notFound("team", in.Requestor.CustomerId)
+	}
+
+	if in.Team.Name != "" {
+		team.Name = in.Team.Name
+	}
+
+	if in.Team.SubscriptionPlan != "" {
+		team.SubscriptionPlan = in.Team.SubscriptionPlan
+	}
+
+	return &opsee.UpdateTeamResponse{Team: c.teamWithUsers(team)}, nil
+}
+
+func (c *Cats) DeleteTeam(ctx context.Context, in *opsee.DeleteTeamRequest, opts ...grpc.CallOption) (*opsee.DeleteTeamResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	i, team := c.team(in.Requestor.CustomerId)
+	if team == nil {
+		return nil, notFound("team", in.Requestor.CustomerId)
+	}
+
+	c.fixtures.Teams = append(c.fixtures.Teams[:i], c.fixtures.Teams[i+1:]...)
+
+	return &opsee.DeleteTeamResponse{Team: team}, nil
+}
+
+func (c *Cats) GetCheckResults(ctx context.Context, in *opsee.GetCheckResultsRequest, opts ...grpc.CallOption) (*opsee.GetCheckResultsResponse, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	return &opsee.GetCheckResultsResponse{Results: c.checkResults(in.CustomerId, in.CheckId)}, nil
+}
+
+func (c *Cats) GetCheckStateTransitions(ctx context.Context, in *opsee.GetCheckStateTransitionsRequest, opts ...grpc.CallOption) (*opsee.GetCheckStateTransitionsResponse, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	transitions := make([]*schema.CheckStateTransition, 0)
+	for _, t := range c.fixtures.Transitions {
+		if t.CustomerId != in.CustomerId || t.CheckId != in.CheckId {
+			continue
+		}
+
+		if in.StateTransitionId != 0 {
+			if t.Id == in.StateTransitionId {
+				transitions = append(transitions, clone(t).(*schema.CheckStateTransition))
+			}
+			continue
+		}
+
+		if in.AbsoluteStartTime != nil && millis(t.OccurredAt) < millis(in.AbsoluteStartTime) {
+			continue
+		}
+
+		if in.AbsoluteEndTime != nil && millis(t.OccurredAt) > millis(in.AbsoluteEndTime) {
+			continue
+		}
+
+		transitions = append(transitions, clone(t).(*schema.CheckStateTransition))
+	}
+
+	return &opsee.GetCheckStateTransitionsResponse{Transitions: transitions}, nil
+}
+
+func (c *Cats) GetChecks(ctx context.Context, in *opsee.GetChecksRequest, opts ...grpc.CallOption) (*opsee.GetChecksResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	checks := make([]*schema.Check, 0)
+	for _, check := range c.fixtures.Checks {
+		if check.CustomerId != in.Requestor.CustomerId || (in.CheckId != "" && check.Id != in.CheckId) {
+			continue
+		}
+
+		check = clone(check).(*schema.Check)
+		check.Results = c.checkResults(check.CustomerId, check.Id)
+		checks = append(checks, check)
+	}
+
+	return &opsee.GetChecksResponse{Checks: checks}, nil
+}
+
+// GetCheckSnapshot returns the check with its current results, since fixtures
+// don't keep history per state transition.
+func (c *Cats) GetCheckSnapshot(ctx context.Context, in *opsee.GetCheckSnapshotRequest, opts ...grpc.CallOption) (*opsee.GetCheckSnapshotResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	_, check := c.check(in.Requestor.CustomerId, in.CheckId)
+	if check == nil {
+		return nil, notFound("check", in.CheckId)
+	}
+
+	check = clone(check).(*schema.Check)
+	check.Results = c.checkResults(check.CustomerId, check.Id)
+
+	return &opsee.GetCheckSnapshotResponse{Check: check}, nil
+}
+
+func (c *Cats) team(id string) (int, *schema.Team) {
+	for i, team := range c.fixtures.Teams {
+		if team.Id == id {
+			return i, team
+		}
+	}
+
+	return -1, nil
+}
+
+func (c *Cats) teamWithUsers(team *schema.Team) *schema.Team {
+	team = clone(team).(*schema.Team)
+	team.Users = nil
+
+	for _, user := range c.fixtures.Users {
+		if user.CustomerId == team.Id {
+			team.Users = append(team.Users, clone(user).(*schema.User))
+		}
+	}
+
+	return team
+}
+
+// checkResults returns a check's results, newest first.
+func (c *Cats) checkResults(customerId, checkId string) []*schema.CheckResult {
+	results := make([]*schema.CheckResult, 0)
+	for _, result := range c.fixtures.Results {
+		if result.CustomerId == customerId && result.CheckId == checkId {
+			results = append(results, clone(result).(*schema.CheckResult))
+		}
+	}
+
+	sort.Sort(resultList(results))
+
+	return results
+}
+
+type resultList []*schema.CheckResult
+
+func (l resultList) Len() int           { return len(l) }
+func (l resultList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l resultList) Less(i, j int) bool { return millis(l[i].Timestamp) > millis(l[j].Timestamp) }
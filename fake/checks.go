@@ -0,0 +1,219 @@
+package fake
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Bartnet implements bartnet.Client.
+type Bartnet struct {
+	*Store
+}
+
+func (b *Bartnet) GetCheck(user *schema.User, id string) (*schema.Check, error) {
+	if err := requireUser(user); err != nil {
+		return nil, err
+	}
+
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+
+	_, check := b.check(user.CustomerId, id)
+	if check == nil {
+		return nil, notFound("check", id)
+	}
+
+	return clone(check).(*schema.Check), nil
+}
+
+func (b *Bartnet) ListChecks(user *schema.User) ([]*schema.Check, error) {
+	if err := requireUser(user); err != nil {
+		return nil, err
+	}
+
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+
+	checks := make([]*schema.Check, 0)
+	for _, check := range b.fixtures.Checks {
+		if check.CustomerId == user.CustomerId {
+			checks = append(checks, clone(check).(*schema.Check))
+		}
+	}
+
+	return checks, nil
+}
+
+func (b *Bartnet) CreateCheck(user *schema.User, check *schema.Check) (*schema.Check, error) {
+	if err := requireUser(user); err != nil {
+		return nil, err
+	}
+
+	check = clone(check).(*schema.Check)
+	check.Id = b.id("fake-check")
+	check.CustomerId = user.CustomerId
+	if check.ExecutionGroupId == "" {
+		check.ExecutionGroupId = user.CustomerId
+	}
+
+	b.mut.Lock()
+	b.fixtures.Checks = append(b.fixtures.Checks, check)
+	b.mut.Unlock()
+
+	return clone(check).(*schema.Check), nil
+}
+
+func (b *Bartnet) UpdateCheck(user *schema.User, check *schema.Check) (*schema.Check, error) {
+	if err := requireUser(user); err != nil {
+		return nil, err
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	i, _ := b.check(user.CustomerId, check.Id)
+	if i < 0 {
+		return nil, notFound("check", check.Id)
+	}
+
+	check = clone(check).(*schema.Check)
+	check.CustomerId = user.CustomerId
+	if check.ExecutionGroupId == "" {
+		check.ExecutionGroupId = user.CustomerId
+	}
+	b.fixtures.Checks[i] = check
+
+	return clone(check).(*schema.Check), nil
+}
+
+func (b *Bartnet) DeleteCheck(user *schema.User, id string) error {
+	if err := requireUser(user); err != nil {
+		return err
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	i, _ := b.check(user.CustomerId, id)
+	if i < 0 {
+		return notFound("check", id)
+	}
+
+	b.fixtures.Checks = append(b.fixtures.Checks[:i], b.fixtures.Checks[i+1:]...)
+
+	return nil
+}
+
+func (b *Bartnet) TestCheck(user *schema.User, check *schema.Check) (*opsee.TestCheckResponse, error) {
+	if err := requireUser(user); err != nil {
+		return nil, err
+	}
+
+	return testCheck(check), nil
+}
+
+// Beavis implements beavis.Client.
+type Beavis struct {
+	*Store
+}
+
+func (b *Beavis) ListResults(user *schema.User) ([]*schema.CheckResult, error) {
+	return b.results(user, func(result *schema.CheckResult) bool { return true })
+}
+
+func (b *Beavis) ListResultsCheck(user *schema.User, checkId string) ([]*schema.CheckResult, error) {
+	return b.results(user, func(result *schema.CheckResult) bool { return result.CheckId == checkId })
+}
+
+func (b *Beavis) ListResultsTarget(user *schema.User, targetId string) ([]*schema.CheckResult, error) {
+	return b.results(user, func(result *schema.CheckResult) bool {
+		return result.Target != nil && result.Target.Id == targetId
+	})
+}
+
+func (b *Beavis) results(user *schema.User, match func(*schema.CheckResult) bool) ([]*schema.CheckResult, error) {
+	if err := requireUser(user); err != nil {
+		return nil, err
+	}
+
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+
+	results := make([]*schema.CheckResult, 0)
+	for _, result := range b.fixtures.Results {
+		if result.CustomerId == user.CustomerId && match(result) {
+			results = append(results, clone(result).(*schema.CheckResult))
+		}
+	}
+
+	return results, nil
+}
+
+// Checker implements opsee.CheckerClient, standing in for a bastion's checker.
+// Test checks always pass.
+type Checker struct {
+	*Store
+}
+
+func (c *Checker) TestCheck(ctx context.Context, in *opsee.TestCheckRequest, opts ...grpc.CallOption) (*opsee.TestCheckResponse, error) {
+	if in.Check == nil {
+		return nil, fmt.Errorf("test check request is missing a check")
+	}
+
+	return testCheck(in.Check), nil
+}
+
+func (c *Checker) CreateCheck(ctx context.Context, in *opsee.CheckResourceRequest, opts ...grpc.CallOption) (*opsee.ResourceResponse, error) {
+	return resourceResponse(in), nil
+}
+
+func (c *Checker) RetrieveCheck(ctx context.Context, in *opsee.CheckResourceRequest, opts ...grpc.CallOption) (*opsee.ResourceResponse, error) {
+	return resourceResponse(in), nil
+}
+
+func (c *Checker) UpdateCheck(ctx context.Context, in *opsee.CheckResourceRequest, opts ...grpc.CallOption) (*opsee.ResourceResponse, error) {
+	return resourceResponse(in), nil
+}
+
+func (c *Checker) DeleteCheck(ctx context.Context, in *opsee.CheckResourceRequest, opts ...grpc.CallOption) (*opsee.ResourceResponse, error) {
+	return resourceResponse(in), nil
+}
+
+func testCheck(check *schema.Check) *opsee.TestCheckResponse {
+	target := check.Target
+	if target == nil {
+		target = &schema.Target{}
+	}
+
+	response := &schema.CheckResponse{
+		Target:  target,
+		Passing: true,
+	}
+
+	if _, ok := check.Spec.(*schema.Check_HttpCheck); ok {
+		response.Reply = &schema.CheckResponse_HttpResponse{HttpResponse: &schema.HttpResponse{
+			Code: 200,
+			Body: "ok",
+			Host: target.Address,
+			Metrics: []*schema.Metric{
+				{Name: "request_latency", Value: 42, Timestamp: timestamp(time.Now())},
+			},
+		}}
+	}
+
+	return &opsee.TestCheckResponse{Responses: []*schema.CheckResponse{response}}
+}
+
+func resourceResponse(in *opsee.CheckResourceRequest) *opsee.ResourceResponse {
+	responses := make([]*opsee.CheckResourceResponse, len(in.Checks))
+	for i, check := range in.Checks {
+		responses[i] = &opsee.CheckResourceResponse{Id: check.Id, Check: check}
+	}
+
+	return &opsee.ResourceResponse{Responses: responses}
+}
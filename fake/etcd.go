@@ -0,0 +1,352 @@
+package fake
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// Etcd is an in-memory etcd.KeysAPI. It supports the subset of etcd the
+// resolver relies on: plain keys with optional ttls, implicit directories,
+// recursive gets and deletes, and watches.
+type Etcd struct {
+	mut     sync.Mutex
+	index   uint64
+	entries map[string]*etcdEntry
+	events  []*etcd.Response
+	changed chan struct{}
+}
+
+type etcdEntry struct {
+	value    string
+	created  uint64
+	modified uint64
+	expires  time.Time
+}
+
+// NewEtcd returns an Etcd seeded with keys.
+func NewEtcd(keys map[string]string) *Etcd {
+	e := &Etcd{
+		entries: make(map[string]*etcdEntry),
+		changed: make(chan struct{}),
+	}
+
+	for key, value := range keys {
+		e.index++
+		e.entries[cleanKey(key)] = &etcdEntry{value: value, created: e.index, modified: e.index}
+	}
+
+	return e
+}
+
+func (e *Etcd) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	if opts == nil {
+		opts = &etcd.GetOptions{}
+	}
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	key = cleanKey(key)
+	node := e.node(key, opts.Recursive, true)
+	if node == nil {
+		return nil, e.error(etcd.ErrorCodeKeyNotFound, "Key not found", key)
+	}
+
+	return &etcd.Response{Action: "get", Node: node, Index: e.index}, nil
+}
+
+func (e *Etcd) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	if opts == nil {
+		opts = &etcd.SetOptions{}
+	}
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	key = cleanKey(key)
+	prev := e.entry(key)
+
+	switch {
+	case opts.PrevExist == etcd.PrevExist && prev == nil:
+		return nil, e.error(etcd.ErrorCodeKeyNotFound, "Key not found", key)
+	case opts.PrevExist == etcd.PrevNoExist && prev != nil:
+		return nil, e.error(etcd.ErrorCodeNodeExist, "Key already exists", key)
+	case opts.PrevValue != "" && (prev == nil || prev.value != opts.PrevValue):
+		return nil, e.error(etcd.ErrorCodeTestFailed, "Compare failed", key)
+	case opts.PrevIndex != 0 && (prev == nil || prev.modified != opts.PrevIndex):
+		return nil, e.error(etcd.ErrorCodeTestFailed, "Compare failed", key)
+	}
+
+	action := "set"
+	if opts.PrevExist == etcd.PrevExist {
+		action = "update"
+	} else if opts.PrevExist == etcd.PrevNoExist {
+		action = "create"
+	}
+
+	if opts.Refresh && prev != nil {
+		value = prev.value
+	}
+
+	return e.set(action, key, value, opts.TTL, prev), nil
+}
+
+func (e *Etcd) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	if opts == nil {
+		opts = &etcd.DeleteOptions{}
+	}
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	key = cleanKey(key)
+	prev := e.node(key, true, false)
+	if prev == nil {
+		return nil, e.error(etcd.ErrorCodeKeyNotFound, "Key not found", key)
+	}
+
+	if prev.Dir && !opts.Recursive && !opts.Dir {
+		return nil, e.error(etcd.ErrorCodeNotFile, "Not a file", key)
+	}
+
+	if prev.Dir && len(prev.Nodes) > 0 && !opts.Recursive {
+		return nil, e.error(etcd.ErrorCodeDirNotEmpty, "Directory not empty", key)
+	}
+
+	if !prev.Dir {
+		if opts.PrevValue != "" && prev.Value != opts.PrevValue {
+			return nil, e.error(etcd.ErrorCodeTestFailed, "Compare failed", key)
+		}
+
+		if opts.PrevIndex != 0 && prev.ModifiedIndex != opts.PrevIndex {
+			return nil, e.error(etcd.ErrorCodeTestFailed, "Compare failed", key)
+		}
+	}
+
+	for k := range e.entries {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(e.entries, k)
+		}
+	}
+
+	e.index++
+	resp := &etcd.Response{
+		Action:   "delete",
+		Node:     &etcd.Node{Key: key, Dir: prev.Dir, CreatedIndex: prev.CreatedIndex, ModifiedIndex: e.index},
+		PrevNode: prev,
+		Index:    e.index,
+	}
+	e.publish(resp)
+
+	return resp, nil
+}
+
+func (e *Etcd) Create(ctx context.Context, key, value string) (*etcd.Response, error) {
+	return e.Set(ctx, key, value, &etcd.SetOptions{PrevExist: etcd.PrevNoExist})
+}
+
+func (e *Etcd) CreateInOrder(ctx context.Context, dir, value string, opts *etcd.CreateInOrderOptions) (*etcd.Response, error) {
+	if opts == nil {
+		opts = &etcd.CreateInOrderOptions{}
+	}
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	key := cleanKey(path.Join(dir, fmt.Sprintf("%020d", e.index+1)))
+
+	return e.set("create", key, value, opts.TTL, nil), nil
+}
+
+func (e *Etcd) Update(ctx context.Context, key, value string) (*etcd.Response, error) {
+	return e.Set(ctx, key, value, &etcd.SetOptions{PrevExist: etcd.PrevExist})
+}
+
+func (e *Etcd) Watcher(key string, opts *etcd.WatcherOptions) etcd.Watcher {
+	if opts == nil {
+		opts = &etcd.WatcherOptions{}
+	}
+
+	e.mut.Lock()
+	after := opts.AfterIndex
+	if after == 0 {
+		after = e.index
+	}
+	e.mut.Unlock()
+
+	return &etcdWatcher{
+		etcd:      e,
+		key:       cleanKey(key),
+		recursive: opts.Recursive,
+		after:     after,
+	}
+}
+
+// set writes a key, with the lock held.
+func (e *Etcd) set(action, key, value string, ttl time.Duration, prev *etcdEntry) *etcd.Response {
+	e.index++
+
+	entry := &etcdEntry{value: value, created: e.index, modified: e.index}
+	if prev != nil {
+		entry.created = prev.created
+	}
+
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	e.entries[key] = entry
+
+	resp := &etcd.Response{
+		Action: action,
+		Node:   entry.node(key),
+		Index:  e.index,
+	}
+
+	if prev != nil {
+		resp.PrevNode = prev.node(key)
+	}
+
+	e.publish(resp)
+
+	return resp
+}
+
+// entry returns an unexpired entry for key, with the lock held.
+func (e *Etcd) entry(key string) *etcdEntry {
+	entry, ok := e.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(e.entries, key)
+		return nil
+	}
+
+	return entry
+}
+
+// node builds the node for key with the lock held, returning nil if there is
+// no such key or directory. Directories only include their children's
+// children when recursive is set.
+func (e *Etcd) node(key string, recursive, sorted bool) *etcd.Node {
+	if entry := e.entry(key); entry != nil {
+		return entry.node(key)
+	}
+
+	prefix := key + "/"
+	if key == "/" {
+		prefix = key
+	}
+
+	children := make(map[string]*etcd.Node)
+	for k := range e.entries {
+		if !strings.HasPrefix(k, prefix) || e.entry(k) == nil {
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimPrefix(k, prefix), "/", 2)[0]
+		childKey := prefix + name
+		if _, ok := children[childKey]; ok {
+			continue
+		}
+
+		if childKey == k {
+			children[childKey] = e.entries[k].node(k)
+		} else if recursive {
+			children[childKey] = e.node(childKey, true, sorted)
+		} else {
+			children[childKey] = &etcd.Node{Key: childKey, Dir: true}
+		}
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+
+	node := &etcd.Node{Key: key, Dir: true}
+	for _, child := range children {
+		node.Nodes = append(node.Nodes, child)
+	}
+
+	sort.Sort(node.Nodes)
+
+	return node
+}
+
+func (e *Etcd) error(code int, message, key string) error {
+	return etcd.Error{Code: code, Message: message, Cause: key, Index: e.index}
+}
+
+// publish records an event and wakes any watchers, with the lock held.
+func (e *Etcd) publish(resp *etcd.Response) {
+	e.events = append(e.events, resp)
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+func (entry *etcdEntry) node(key string) *etcd.Node {
+	node := &etcd.Node{
+		Key:           key,
+		Value:         entry.value,
+		CreatedIndex:  entry.created,
+		ModifiedIndex: entry.modified,
+	}
+
+	if !entry.expires.IsZero() {
+		expires := entry.expires
+		node.Expiration = &expires
+		node.TTL = int64(expires.Sub(time.Now()).Seconds()) + 1
+	}
+
+	return node
+}
+
+type etcdWatcher struct {
+	etcd      *Etcd
+	key       string
+	recursive bool
+	after     uint64
+}
+
+// Next blocks until there's a change to the watched key (or anything under it,
+// if recursive) or the context is done.
+func (w *etcdWatcher) Next(ctx context.Context) (*etcd.Response, error) {
+	for {
+		w.etcd.mut.Lock()
+		for _, event := range w.etcd.events {
+			if event.Index <= w.after {
+				continue
+			}
+
+			key := event.Node.Key
+			if key == w.key || (w.recursive && strings.HasPrefix(key, w.key+"/")) {
+				w.after = event.Index
+				w.etcd.mut.Unlock()
+				return event, nil
+			}
+		}
+
+		w.after = w.etcd.index
+		changed := w.etcd.changed
+		w.etcd.mut.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func cleanKey(key string) string {
+	return path.Clean("/" + key)
+}
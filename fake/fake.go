@@ -0,0 +1,141 @@
+// Package fake provides in-memory stand-ins for every backend the resolver
+// talks to, so compost can run offline and be tested without any of them.
+// All of the fakes share a Store seeded from Fixtures, so a check created
+// through bartnet shows up in cats, and so on.
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"github.com/opsee/compost/resolver"
+	opsee_types "github.com/opsee/protobuf/opseeproto/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	errNotFound     = errors.New("not found")
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// Store holds the state shared by the fakes. It is safe for concurrent use.
+type Store struct {
+	mut      sync.RWMutex
+	fixtures *Fixtures
+	nextId   uint64
+}
+
+// NewStore returns a Store seeded with a copy of fixtures.
+func NewStore(fixtures *Fixtures) *Store {
+	if fixtures == nil {
+		fixtures = &Fixtures{}
+	}
+
+	return &Store{
+		fixtures: fixtures.copy(),
+		nextId:   uint64(len(fixtures.Checks) + len(fixtures.Users)),
+	}
+}
+
+// NewClient returns a resolver client backed entirely by fakes seeded with fixtures.
+func NewClient(fixtures *Fixtures) *resolver.Client {
+	store := NewStore(fixtures)
+	checker := &Checker{store}
+
+	return &resolver.Client{
+		Bartnet:    &Bartnet{store},
+		Beavis:     &Beavis{store},
+		Spanx:      &Spanx{store},
+		Cats:       &Cats{store},
+		Keelhaul:   &Keelhaul{store},
+		Hugs:       &Hugs{store},
+		Bezos:      &Bezos{store},
+		Marktricks: &Marktricks{store},
+		EtcdKeys:   NewEtcd(store.routes()),
+		EC2:        &EC2{Store: store},
+		DialChecker: func(addr string) (opsee.CheckerClient, io.Closer, error) {
+			return checker, nopCloser{}, nil
+		},
+	}
+}
+
+// id returns a new unique id with the given prefix.
+func (s *Store) id(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, atomic.AddUint64(&s.nextId, 1))
+}
+
+// routes returns the etcd bastion routes for every customer's bastions, which
+// is what the resolver uses to find a checker to run test checks against.
+func (s *Store) routes() map[string]string {
+	routes := make(map[string]string)
+	for _, user := range s.fixtures.Users {
+		key := fmt.Sprintf("%s/%s/fake-bastion", resolver.RoutePath, user.CustomerId)
+		routes[key] = `{"checker": {"hostname": "fake-bastion", "port": 4001}}`
+	}
+
+	key := fmt.Sprintf("%s/%s/fake-bastion", resolver.RoutePath, resolver.MagicExecutionGroup)
+	routes[key] = `{"checker": {"hostname": "fake-bastion", "port": 4001}}`
+
+	return routes
+}
+
+func (s *Store) user(id int32) *schema.User {
+	for _, u := range s.fixtures.Users {
+		if u.Id == id {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) check(customerId, id string) (int, *schema.Check) {
+	for i, check := range s.fixtures.Checks {
+		if check.CustomerId == customerId && check.Id == id {
+			return i, check
+		}
+	}
+
+	return -1, nil
+}
+
+func requireUser(user *schema.User) error {
+	if user == nil || user.CustomerId == "" {
+		return grpc.Errorf(codes.PermissionDenied, "%s", errUnauthorized)
+	}
+
+	return nil
+}
+
+func notFound(kind, id interface{}) error {
+	return grpc.Errorf(codes.NotFound, "%s %v %s", kind, id, errNotFound)
+}
+
+// clone deep copies a proto message, so that callers can't mutate the store.
+func clone(msg proto.Message) proto.Message {
+	if msg == nil {
+		return nil
+	}
+
+	return proto.Clone(msg)
+}
+
+// millis is Timestamp.Millis, but treats a missing timestamp as zero.
+func millis(ts *opsee_types.Timestamp) int64 {
+	if ts == nil {
+		return 0
+	}
+
+	return ts.Millis()
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,121 @@
+package fake
+
+import (
+	"testing"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/opsee/basic/schema"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func testUser() *schema.User {
+	return &schema.User{Id: 1, CustomerId: CustomerId, Email: "fake@opsee.com"}
+}
+
+func TestClientChecks(t *testing.T) {
+	assert := assert.New(t)
+	client := NewClient(DefaultFixtures())
+	ctx := context.Background()
+
+	checks, err := client.ListChecks(ctx, testUser(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(checks, 2)
+	assert.Len(checks[0].Results, 1)
+
+	created, err := client.Bartnet.CreateCheck(testUser(), &schema.Check{Name: "new check"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(created.Id)
+
+	checks, err = client.ListChecks(ctx, testUser(), "", 0)
+	assert.NoError(err)
+	assert.Len(checks, 3)
+
+	_, err = client.ListChecks(ctx, &schema.User{CustomerId: "someone-else"}, "fake-check-1", 0)
+	assert.Error(err)
+
+	resp, err := client.TestCheck(ctx, testUser(), map[string]interface{}{
+		"target":     map[string]interface{}{"id": "i-fa7e0001", "type": "instance"},
+		"http_check": map[string]interface{}{"path": "/health", "port": 80},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(resp.Responses, 1)
+	assert.True(resp.Responses[0].Passing)
+}
+
+func TestClientAWS(t *testing.T) {
+	assert := assert.New(t)
+	client := NewClient(DefaultFixtures())
+	ctx := context.Background()
+
+	instances, err := client.GetInstances(ctx, testUser(), Region, VpcId, "ec2", "")
+	assert.NoError(err)
+	assert.Len(instances, 1)
+
+	instances, err = client.GetInstances(ctx, testUser(), Region, "vpc-other", "ec2", "")
+	assert.NoError(err)
+	assert.Len(instances, 0)
+
+	region, err := client.ScanRegion(ctx, testUser(), Region)
+	assert.NoError(err)
+	assert.Len(region.Vpcs, 1)
+
+	assert.NoError(client.RebootInstances(ctx, testUser(), Region, []string{"i-fa7e0001"}))
+	assert.Error(client.StopInstances(ctx, testUser(), Region, []string{"i-nope"}))
+	assert.Equal([]*InstanceAction{{Action: "reboot", CustomerId: CustomerId, Region: Region, InstanceIds: []string{"i-fa7e0001"}}}, client.EC2.(*EC2).Actions())
+}
+
+func TestFixturesCopied(t *testing.T) {
+	fixtures := DefaultFixtures()
+	client := NewClient(fixtures)
+
+	fixtures.Checks[0].Name = "changed"
+	check, err := client.Bartnet.GetCheck(testUser(), fixtures.Checks[0].Id)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "changed", check.Name)
+}
+
+func TestEtcd(t *testing.T) {
+	assert := assert.New(t)
+	keys := NewEtcd(map[string]string{"/a/b/c": "1", "/a/d": "2"})
+	ctx := context.Background()
+
+	resp, err := keys.Get(ctx, "/a", &etcd.GetOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(resp.Node.Dir)
+	assert.Len(resp.Node.Nodes, 2)
+	assert.Equal("/a/b/c", resp.Node.Nodes[0].Nodes[0].Key)
+
+	_, err = keys.Get(ctx, "/nope", nil)
+	assert.True(etcd.IsKeyNotFound(err))
+
+	_, err = keys.Create(ctx, "/a/d", "3")
+	assert.Error(err)
+
+	watcher := keys.Watcher("/a", &etcd.WatcherOptions{Recursive: true})
+	go keys.Set(ctx, "/a/e", "4", &etcd.SetOptions{TTL: time.Minute})
+
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	resp, err = watcher.Next(wctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("/a/e", resp.Node.Key)
+	assert.Equal("4", resp.Node.Value)
+
+	_, err = keys.Delete(ctx, "/a", &etcd.DeleteOptions{Recursive: true})
+	assert.NoError(err)
+	_, err = keys.Get(ctx, "/a/d", nil)
+	assert.Error(err)
+}
@@ -0,0 +1,347 @@
+package fake
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/opsee/basic/clients/hugs"
+	"github.com/opsee/basic/schema"
+	opsee_aws_autoscaling "github.com/opsee/basic/schema/aws/autoscaling"
+	opsee_aws_cloudwatch "github.com/opsee/basic/schema/aws/cloudwatch"
+	opsee_aws_ec2 "github.com/opsee/basic/schema/aws/ec2"
+	opsee_aws_elb "github.com/opsee/basic/schema/aws/elb"
+	opsee_aws_rds "github.com/opsee/basic/schema/aws/rds"
+	opsee_types "github.com/opsee/protobuf/opseeproto/types"
+)
+
+const (
+	// CustomerId is the customer that owns everything in DefaultFixtures.
+	CustomerId = "11111111-1111-1111-1111-111111111111"
+	Region     = "us-west-2"
+	VpcId      = "vpc-fa7e0001"
+)
+
+// Fixtures seed a Store. Everything owned by a customer is matched on its
+// CustomerId; aws resources are shared by all customers and matched on vpc.
+type Fixtures struct {
+	Users       []*schema.User
+	Teams       []*schema.Team
+	Checks      []*schema.Check
+	Results     []*schema.CheckResult
+	Transitions []*schema.CheckStateTransition
+
+	// Notifications are keyed by customer id. Notifications without a check id
+	// are the customer's defaults.
+	Notifications map[string][]*hugs.Notification
+
+	Regions    []*schema.Region
+	RoleStacks []*schema.RoleStack
+	Bastions   []*schema.BastionState
+
+	SecurityGroups    []*opsee_aws_ec2.SecurityGroup
+	Instances         []*opsee_aws_ec2.Instance
+	LoadBalancers     []*opsee_aws_elb.LoadBalancerDescription
+	AutoScalingGroups []*opsee_aws_autoscaling.Group
+	DBInstances       []*opsee_aws_rds.DBInstance
+
+	// Datapoints are cloudwatch statistics keyed by metric name.
+	Datapoints map[string][]*opsee_aws_cloudwatch.Datapoint
+
+	// Metrics are check metrics keyed by check id.
+	Metrics map[string][]*schema.Metric
+}
+
+// DefaultFixtures returns a small, self-consistent account for CustomerId: an
+// admin user, a team, a vpc with a few aws resources, a couple of http checks
+// against them with results and state transitions, and an hour of metrics.
+func DefaultFixtures() *Fixtures {
+	now := time.Now()
+
+	user := &schema.User{
+		Id:         1,
+		CustomerId: CustomerId,
+		Email:      "fake@opsee.com",
+		Name:       "Fake User",
+		Verified:   true,
+		Admin:      true,
+		Active:     true,
+		Status:     "active",
+		Perms:      &schema.UserFlags{Admin: true, Edit: true, Billing: true},
+	}
+
+	checks := []*schema.Check{
+		httpCheck("fake-check-1", "elb health", &schema.Target{Id: "fake-elb", Name: "fake-elb", Type: "elb"}, "passing"),
+		httpCheck("fake-check-2", "api instance", &schema.Target{Id: "i-fa7e0001", Name: "fake-api", Type: "instance"}, "failing"),
+	}
+
+	var (
+		results     []*schema.CheckResult
+		transitions []*schema.CheckStateTransition
+		metrics     = make(map[string][]*schema.Metric)
+	)
+
+	for i, check := range checks {
+		passing := check.State == "passing"
+
+		results = append(results, &schema.CheckResult{
+			CheckId:    check.Id,
+			CustomerId: CustomerId,
+			Timestamp:  timestamp(now.Add(-30 * time.Second)),
+			Passing:    passing,
+			Target:     check.Target,
+			CheckName:  check.Name,
+			BastionId:  "fake-bastion",
+			Region:     Region,
+			Responses: []*schema.CheckResponse{
+				{
+					Target:  check.Target,
+					Passing: passing,
+					Reply: &schema.CheckResponse_HttpResponse{HttpResponse: &schema.HttpResponse{
+						Code: map[bool]int32{true: 200, false: 500}[passing],
+						Body: "ok",
+						Host: check.Target.Id,
+					}},
+				},
+			},
+		})
+
+		transitions = append(transitions, &schema.CheckStateTransition{
+			Id:         int64(i + 1),
+			CheckId:    check.Id,
+			CustomerId: CustomerId,
+			From:       "warning",
+			To:         check.State,
+			OccurredAt: timestamp(now.Add(-10 * time.Minute)),
+		})
+
+		for m := 60; m > 0; m-- {
+			metrics[check.Id] = append(metrics[check.Id], &schema.Metric{
+				Name:      "request_latency",
+				Value:     float64(100 + (m*37)%50),
+				Timestamp: timestamp(now.Add(-time.Duration(m) * time.Minute)),
+				Tags:      []*schema.Tag{{Name: "region", Value: Region}},
+			})
+		}
+	}
+
+	var datapoints []*opsee_aws_cloudwatch.Datapoint
+	for m := 60; m > 0; m -= 5 {
+		datapoints = append(datapoints, &opsee_aws_cloudwatch.Datapoint{
+			Average:   aws.Float64(float64(20 + (m*13)%30)),
+			Timestamp: timestamp(now.Add(-time.Duration(m) * time.Minute)),
+			Unit:      aws.String("Percent"),
+		})
+	}
+
+	return &Fixtures{
+		Users: []*schema.User{user},
+		Teams: []*schema.Team{
+			{
+				Id:                 CustomerId,
+				Name:               "Fake Team",
+				SubscriptionPlan:   "team_beta",
+				SubscriptionStatus: "active",
+			},
+		},
+		Checks:      checks,
+		Results:     results,
+		Transitions: transitions,
+		Notifications: map[string][]*hugs.Notification{
+			CustomerId: {
+				{Type: "email", Value: user.Email},
+				{CheckId: "fake-check-2", Type: "slack_bot", Value: "#alerts"},
+			},
+		},
+		Regions: []*schema.Region{
+			{
+				Region:             Region,
+				CustomerId:         CustomerId,
+				SupportedPlatforms: []string{"EC2-VPC"},
+				Vpcs: []*schema.Vpc{
+					{VpcId: VpcId, State: "available", InstanceCount: 1, IsDefault: true, CidrBlock: "10.0.0.0/16"},
+				},
+				Subnets: []*schema.Subnet{
+					{SubnetId: "subnet-fa7e0001", VpcId: VpcId, AvailabilityZone: "us-west-2a", CidrBlock: "10.0.0.0/24", State: "available", Routing: "public", InstanceCount: 1},
+				},
+			},
+		},
+		RoleStacks: []*schema.RoleStack{
+			{
+				ExternalId: "fake-external-id",
+				CustomerId: CustomerId,
+				StackId:    "fake-role-stack",
+				StackName:  "opsee-role-stack",
+				Region:     Region,
+				Active:     true,
+				CreatedAt:  timestamp(now.Add(-24 * time.Hour)),
+				UpdatedAt:  timestamp(now.Add(-24 * time.Hour)),
+			},
+		},
+		Bastions: []*schema.BastionState{
+			{
+				Id:         "fake-bastion",
+				CustomerId: CustomerId,
+				Status:     "active",
+				LastSeen:   timestamp(now),
+				Region:     Region,
+				VpcId:      VpcId,
+			},
+		},
+		SecurityGroups: []*opsee_aws_ec2.SecurityGroup{
+			{
+				GroupId:     aws.String("sg-fa7e0001"),
+				GroupName:   aws.String("fake-web"),
+				Description: aws.String("fake web servers"),
+				VpcId:       aws.String(VpcId),
+			},
+		},
+		Instances: []*opsee_aws_ec2.Instance{
+			{
+				InstanceId:       aws.String("i-fa7e0001"),
+				InstanceType:     aws.String("t2.micro"),
+				ImageId:          aws.String("ami-fa7e0001"),
+				LaunchTime:       timestamp(now.Add(-72 * time.Hour)),
+				PrivateIpAddress: aws.String("10.0.0.10"),
+				SubnetId:         aws.String("subnet-fa7e0001"),
+				VpcId:            aws.String(VpcId),
+				State:            &opsee_aws_ec2.InstanceState{Code: aws.Int64(16), Name: aws.String("running")},
+				Placement:        &opsee_aws_ec2.Placement{AvailabilityZone: aws.String("us-west-2a")},
+				SecurityGroups: []*opsee_aws_ec2.GroupIdentifier{
+					{GroupId: aws.String("sg-fa7e0001"), GroupName: aws.String("fake-web")},
+				},
+				Tags: []*opsee_aws_ec2.Tag{
+					{Key: aws.String("Name"), Value: aws.String("fake-api")},
+				},
+			},
+		},
+		LoadBalancers: []*opsee_aws_elb.LoadBalancerDescription{
+			{
+				LoadBalancerName:  aws.String("fake-elb"),
+				DNSName:           aws.String("fake-elb.us-west-2.elb.amazonaws.com"),
+				AvailabilityZones: []string{"us-west-2a"},
+				CreatedTime:       timestamp(now.Add(-72 * time.Hour)),
+				Instances:         []*opsee_aws_elb.Instance{{InstanceId: aws.String("i-fa7e0001")}},
+				VPCId:             aws.String(VpcId),
+			},
+		},
+		AutoScalingGroups: []*opsee_aws_autoscaling.Group{
+			{
+				AutoScalingGroupName: aws.String("fake-asg"),
+				AvailabilityZones:    []string{"us-west-2a"},
+				CreatedTime:          timestamp(now.Add(-72 * time.Hour)),
+				DesiredCapacity:      aws.Int64(1),
+				VPCZoneIdentifier:    aws.String("subnet-fa7e0001"),
+			},
+		},
+		DBInstances: []*opsee_aws_rds.DBInstance{
+			{
+				DBInstanceIdentifier: aws.String("fake-db"),
+				DBInstanceClass:      aws.String("db.t2.micro"),
+				DBInstanceStatus:     aws.String("available"),
+				Engine:               aws.String("postgres"),
+				AvailabilityZone:     aws.String("us-west-2a"),
+			},
+		},
+		Datapoints: map[string][]*opsee_aws_cloudwatch.Datapoint{
+			"CPUUtilization": datapoints,
+		},
+		Metrics: metrics,
+	}
+}
+
+func httpCheck(id, name string, target *schema.Target, state string) *schema.Check {
+	return &schema.Check{
+		Id:               id,
+		Name:             name,
+		CustomerId:       CustomerId,
+		ExecutionGroupId: CustomerId,
+		Interval:         30,
+		Target:           target,
+		State:            state,
+		MinFailingCount:  1,
+		Spec: &schema.Check_HttpCheck{HttpCheck: &schema.HttpCheck{
+			Name:     name,
+			Path:     "/health",
+			Protocol: "http",
+			Port:     80,
+			Verb:     "GET",
+		}},
+		Assertions: []*schema.Assertion{
+			{Key: "code", Relationship: "equal", Operand: "200"},
+		},
+	}
+}
+
+func timestamp(t time.Time) *opsee_types.Timestamp {
+	ts := &opsee_types.Timestamp{}
+	ts.Scan(t)
+	return ts
+}
+
+// copy deep copies the fixtures, so that a Store never shares state with
+// whoever seeded it.
+func (f *Fixtures) copy() *Fixtures {
+	c := &Fixtures{
+		Notifications: make(map[string][]*hugs.Notification),
+		Datapoints:    make(map[string][]*opsee_aws_cloudwatch.Datapoint),
+		Metrics:       make(map[string][]*schema.Metric),
+	}
+
+	for _, v := range f.Users {
+		c.Users = append(c.Users, clone(v).(*schema.User))
+	}
+	for _, v := range f.Teams {
+		c.Teams = append(c.Teams, clone(v).(*schema.Team))
+	}
+	for _, v := range f.Checks {
+		c.Checks = append(c.Checks, clone(v).(*schema.Check))
+	}
+	for _, v := range f.Results {
+		c.Results = append(c.Results, clone(v).(*schema.CheckResult))
+	}
+	for _, v := range f.Transitions {
+		c.Transitions = append(c.Transitions, clone(v).(*schema.CheckStateTransition))
+	}
+	for k, v := range f.Notifications {
+		for _, n := range v {
+			notif := *n
+			c.Notifications[k] = append(c.Notifications[k], &notif)
+		}
+	}
+	for _, v := range f.Regions {
+		c.Regions = append(c.Regions, clone(v).(*schema.Region))
+	}
+	for _, v := range f.RoleStacks {
+		c.RoleStacks = append(c.RoleStacks, clone(v).(*schema.RoleStack))
+	}
+	for _, v := range f.Bastions {
+		c.Bastions = append(c.Bastions, clone(v).(*schema.BastionState))
+	}
+	for _, v := range f.SecurityGroups {
+		c.SecurityGroups = append(c.SecurityGroups, clone(v).(*opsee_aws_ec2.SecurityGroup))
+	}
+	for _, v := range f.Instances {
+		c.Instances = append(c.Instances, clone(v).(*opsee_aws_ec2.Instance))
+	}
+	for _, v := range f.LoadBalancers {
+		c.LoadBalancers = append(c.LoadBalancers, clone(v).(*opsee_aws_elb.LoadBalancerDescription))
+	}
+	for _, v := range f.AutoScalingGroups {
+		c.AutoScalingGroups = append(c.AutoScalingGroups, clone(v).(*opsee_aws_autoscaling.Group))
+	}
+	for _, v := range f.DBInstances {
+		c.DBInstances = append(c.DBInstances, clone(v).(*opsee_aws_rds.DBInstance))
+	}
+	for k, v := range f.Datapoints {
+		for _, d := range v {
+			c.Datapoints[k] = append(c.Datapoints[k], clone(d).(*opsee_aws_cloudwatch.Datapoint))
+		}
+	}
+	for k, v := range f.Metrics {
+		for _, m := range v {
+			c.Metrics[k] = append(c.Metrics[k], clone(m).(*schema.Metric))
+		}
+	}
+
+	return c
+}
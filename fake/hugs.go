@@ -0,0 +1,78 @@
+package fake
+
+import (
+	"github.com/opsee/basic/clients/hugs"
+	"github.com/opsee/basic/schema"
+)
+
+// Hugs implements hugs.Client.
+type Hugs struct {
+	*Store
+}
+
+func (h *Hugs) ListNotifications(user *schema.User) ([]*hugs.Notification, error) {
+	return h.notifications(user, func(n *hugs.Notification) bool { return true })
+}
+
+func (h *Hugs) ListNotificationsDefault(user *schema.User) ([]*hugs.Notification, error) {
+	return h.notifications(user, func(n *hugs.Notification) bool { return n.CheckId == "" })
+}
+
+func (h *Hugs) ListNotificationsCheck(user *schema.User, checkId string) ([]*hugs.Notification, error) {
+	return h.notifications(user, func(n *hugs.Notification) bool { return n.CheckId == checkId })
+}
+
+func (h *Hugs) CreateNotifications(user *schema.User, noteReq *hugs.NotificationRequest) error {
+	return h.CreateNotificationsMulti(user, []*hugs.NotificationRequest{noteReq})
+}
+
+func (h *Hugs) CreateNotificationsDefault(user *schema.User, noteReq *hugs.NotificationRequest) error {
+	return h.CreateNotificationsMulti(user, []*hugs.NotificationRequest{{Notifications: noteReq.Notifications}})
+}
+
+// CreateNotificationsMulti replaces the notifications for each check in
+// noteReqs, like hugs does.
+func (h *Hugs) CreateNotificationsMulti(user *schema.User, noteReqs []*hugs.NotificationRequest) error {
+	if err := requireUser(user); err != nil {
+		return err
+	}
+
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	for _, req := range noteReqs {
+		notifs := make([]*hugs.Notification, 0)
+		for _, n := range h.fixtures.Notifications[user.CustomerId] {
+			if n.CheckId != req.CheckId {
+				notifs = append(notifs, n)
+			}
+		}
+
+		for _, n := range req.Notifications {
+			notifs = append(notifs, &hugs.Notification{CheckId: req.CheckId, Type: n.Type, Value: n.Value})
+		}
+
+		h.fixtures.Notifications[user.CustomerId] = notifs
+	}
+
+	return nil
+}
+
+func (h *Hugs) notifications(user *schema.User, match func(*hugs.Notification) bool) ([]*hugs.Notification, error) {
+	if err := requireUser(user); err != nil {
+		return nil, err
+	}
+
+	h.mut.RLock()
+	defer h.mut.RUnlock()
+
+	notifs := make([]*hugs.Notification, 0)
+	for _, n := range h.fixtures.Notifications[user.CustomerId] {
+		if match(n) {
+			notif := *n
+			notifs = append(notifs, &notif)
+		}
+	}
+
+	return notifs, nil
+}
@@ -0,0 +1,121 @@
+package fake
+
+import (
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	opsee_types "github.com/opsee/protobuf/opseeproto/types"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Marktricks implements opsee.MarktricksClient over the fixture check metrics.
+// Aggregators are ignored, so raw datapoints are always returned.
+type Marktricks struct {
+	*Store
+}
+
+func (m *Marktricks) GetMetrics(ctx context.Context, in *opsee.GetMetricsRequest, opts ...grpc.CallOption) (*opsee.GetMetricsResponse, error) {
+	if err := requireUser(in.Requestor); err != nil {
+		return nil, err
+	}
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	results := make([]*opsee.QueryResult, len(in.Metrics))
+	for i, requested := range in.Metrics {
+		result := &opsee.QueryResult{}
+
+		for _, check := range m.fixtures.Checks {
+			if check.CustomerId != in.Requestor.CustomerId {
+				continue
+			}
+
+			for _, metric := range m.fixtures.Metrics[check.Id] {
+				if metric.Name == requested.Name && inRange(metric.Timestamp, in.AbsoluteStartTime, in.AbsoluteEndTime) {
+					result.Metrics = append(result.Metrics, clone(metric).(*schema.Metric))
+				}
+			}
+		}
+
+		results[i] = result
+	}
+
+	return &opsee.GetMetricsResponse{Results: results}, nil
+}
+
+// QueryMetrics answers queries tagged by check, grouping datapoints by the
+// metric's region tag like the resolver asks kairosdb to.
+func (m *Marktricks) QueryMetrics(ctx context.Context, in *opsee.QueryMetricsRequest, opts ...grpc.CallOption) (*opsee.QueryMetricsResponse, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	queries := make([]*opsee.Query, len(in.Metrics))
+	for i, query := range in.Metrics {
+		var (
+			results  []*opsee.Result
+			byRegion = make(map[string]*opsee.Result)
+			checkIds []string
+		)
+
+		if checks, ok := query.Tags["check"]; ok && checks != nil {
+			checkIds = checks.Values
+		}
+
+		for _, checkId := range checkIds {
+			for _, metric := range m.fixtures.Metrics[checkId] {
+				if metric.Name != query.Name || !inRange(metric.Timestamp, in.StartAbsolute, in.EndAbsolute) {
+					continue
+				}
+
+				region := metricTag(metric, "region")
+				result, ok := byRegion[region]
+				if !ok {
+					result = &opsee.Result{
+						Name:    metric.Name,
+						GroupBy: query.GroupBy,
+						Tags: map[string]*opsee.StringList{
+							"region": &opsee.StringList{Values: []string{region}},
+							"check":  &opsee.StringList{Values: []string{checkId}},
+						},
+					}
+					byRegion[region] = result
+					results = append(results, result)
+				}
+
+				result.Values = append(result.Values, &opsee.Datapoint{
+					Timestamp: metric.Timestamp,
+					Value:     metric.Value,
+				})
+			}
+		}
+
+		queries[i] = &opsee.Query{Results: results}
+	}
+
+	return &opsee.QueryMetricsResponse{Queries: queries}, nil
+}
+
+func metricTag(metric *schema.Metric, name string) string {
+	for _, tag := range metric.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+
+	return ""
+}
+
+// inRange reports whether ts is between start and end, either of which may be
+// nil to leave that end open.
+func inRange(ts, start, end *opsee_types.Timestamp) bool {
+	if start != nil && millis(ts) < millis(start) {
+		return false
+	}
+
+	if end != nil && millis(ts) > millis(end) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "Requests.", "path", "status")
+	c.Inc("/b", "ok")
+	c.Add(2, "/a", "ok")
+	c.Inc("/a\n\"", "error")
+
+	buf := &bytes.Buffer{}
+	r.WriteText(buf)
+	assert.Equal(`# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{path="/a\n\"",status="error"} 1
+requests_total{path="/a",status="ok"} 2
+requests_total{path="/b",status="ok"} 1
+`, buf.String())
+
+	assert.Panics(func() { c.Inc("/a") })
+}
+
+func TestHistogram(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRegistry()
+	h := r.NewHistogram("duration_seconds", "Durations.", []float64{.1, 1}, "call")
+	h.Observe(.05, "get")
+	h.Observe(.5, "get")
+	h.Observe(5, "get")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nil)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("text/plain; version=0.0.4", w.Header().Get("Content-Type"))
+	assert.Equal(`# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{call="get",le="0.1"} 1
+duration_seconds_bucket{call="get",le="1"} 2
+duration_seconds_bucket{call="get",le="+Inf"} 3
+duration_seconds_sum{call="get"} 5.55
+duration_seconds_count{call="get"} 3
+`, w.Body.String())
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
 	"github.com/opsee/spanx/spanxcreds"
 	"golang.org/x/net/context"
 )
@@ -21,3 +22,16 @@ func (c *Client) awsSession(ctx context.Context, user *schema.User, region strin
 
 	return sess, nil
 }
+
+// bezosGet deduplicates identical bezos requests made within a single graphql
+// request, since nested groups and instances fields tend to describe the same things.
+func (c *Client) bezosGet(ctx context.Context, req *opsee.BezosRequest) (*opsee.BezosResponse, error) {
+	resp, err := LoaderFromContext(ctx).Load("bezos:"+req.String(), func() (interface{}, error) {
+		return c.Bezos.Get(ctx, req)
+	})
+	if err != nil {
+		return nil, backendError(BackendBezos, err)
+	}
+
+	return resp.(*opsee.BezosResponse), nil
+}
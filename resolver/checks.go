@@ -16,7 +16,6 @@ import (
 	log "github.com/opsee/logrus"
 	opsee_types "github.com/opsee/protobuf/opseeproto/types"
 	"golang.org/x/net/context"
-	"google.golang.org/grpc"
 )
 
 type checkCompostResponse struct {
@@ -46,13 +45,13 @@ func (c *Client) ListChecks(ctx context.Context, user *schema.User, checkId stri
 		)
 
 		if checkId != "" {
-			notifs, err = c.Hugs.ListNotificationsCheck(user, checkId)
+			notifs, err = c.hugs(ctx).ListNotificationsCheck(user, checkId)
 		} else {
-			notifs, err = c.Hugs.ListNotifications(user)
+			notifs, err = c.hugs(ctx).ListNotifications(user)
 		}
 
 		if err != nil {
-			responseChan <- &checkCompostResponse{err}
+			responseChan <- &checkCompostResponse{backendError(BackendHugs, err)}
 		} else {
 			responseChan <- &checkCompostResponse{notifs}
 		}
@@ -74,14 +73,14 @@ func (c *Client) ListChecks(ctx context.Context, user *schema.User, checkId stri
 		resp, err := c.Cats.GetCheckSnapshot(ctx, req)
 		if err != nil {
 			log.WithError(err).Error("Error getting check snapshot from cats.")
-			return nil, err
+			return nil, backendError(BackendCats, err)
 		}
 
 		check := resp.Check
 		checks = append(checks, check)
 	} else {
 		if checkId != "" {
-			check, err := c.Bartnet.GetCheck(user, checkId)
+			check, err := c.bartnetGetCheck(ctx, user, checkId)
 			if err != nil {
 				log.WithError(err).Error("couldn't list checks from bartnet")
 				return nil, err
@@ -89,7 +88,7 @@ func (c *Client) ListChecks(ctx context.Context, user *schema.User, checkId stri
 
 			checks = append(checks, check)
 		} else {
-			checks, err = c.Bartnet.ListChecks(user)
+			checks, err = c.bartnetListChecks(ctx, user)
 			if err != nil {
 				log.WithError(err).Error("couldn't list checks from bartnet")
 				return nil, err
@@ -112,15 +111,23 @@ func (c *Client) ListChecks(ctx context.Context, user *schema.User, checkId stri
 		}
 	}
 
+	var results map[string][]*schema.CheckResult
+	if transitionId == 0 {
+		checkIds := make([]string, len(checks))
+		for i, check := range checks {
+			checkIds[i] = check.Id
+		}
+
+		results, err = c.checkResultsMulti(ctx, user, checkIds)
+		if err != nil {
+			log.WithError(err).Error("Error getting check results.")
+			return nil, err
+		}
+	}
+
 	for _, check := range checks {
 		if transitionId == 0 {
-			results, err := c.CheckResults(ctx, user, check.Id)
-			if err != nil {
-				log.WithError(err).Error("Error getting check results.")
-				return nil, err
-			}
-
-			check.Results = results
+			check.Results = results[check.Id]
 
 			if check.Spec == nil {
 				if check.CheckSpec == nil {
@@ -147,110 +154,203 @@ func (c *Client) ListChecks(ctx context.Context, user *schema.User, checkId stri
 	return checks, nil
 }
 
-func (c *Client) UpsertChecks(ctx context.Context, user *schema.User, checksInput []interface{}) ([]*schema.Check, error) {
-	notifs := make([]*hugs.NotificationRequest, 0, len(checksInput))
-	checksResponse := make([]*schema.Check, len(checksInput))
+// CheckResult is the outcome of upserting one check of a batch: the check
+// if it landed, or the error that stopped it.
+type CheckResult struct {
+	Check *schema.Check
+	Error error
+}
+
+// DeleteCheckResult is the outcome of deleting one check of a batch.
+type DeleteCheckResult struct {
+	Id      string
+	Deleted bool
+	Error   error
+}
+
+// UpsertChecks creates checks without ids and updates the rest, returning a
+// result for each input. Failures don't stop the other checks unless atomic
+// is set, in which case the first failure stops the batch and deletes the
+// checks it already created. Updates can't be rolled back.
+func (c *Client) UpsertChecks(ctx context.Context, user *schema.User, checksInput []interface{}, atomic bool) ([]*CheckResult, error) {
+	var (
+		results = make([]*CheckResult, len(checksInput))
+		created []int
+	)
 
 	for i, checkInput := range checksInput {
-		check, ok := checkInput.(map[string]interface{})
-		if !ok {
-			err := fmt.Errorf("error decoding check input")
-			log.WithError(err).Error("Error in UpsertChecks request")
-			return nil, err
+		check, err := c.upsertCheck(ctx, user, checkInput)
+		results[i] = &CheckResult{Check: check, Error: err}
+
+		if check != nil && !hasCheckId(checkInput) {
+			created = append(created, i)
 		}
 
-		notifList, _ := check["notifications"].([]interface{})
-		delete(check, "notifications")
+		if err == nil {
+			continue
+		}
 
-		checkJson, err := json.Marshal(check)
-		if err != nil {
-			log.WithError(err).Error("Error marshalling check from request.")
-			return nil, err
+		log.WithError(err).Errorf("Error upserting check %d.", i)
+		if !atomic {
+			continue
 		}
 
-		checkProto := &schema.Check{}
-		err = jsonpb.Unmarshal(bytes.NewBuffer(checkJson), checkProto)
-		if err != nil {
-			log.WithError(err).Error("Error unmarshalling check protobuf.")
-			return nil, err
+		for j := i + 1; j < len(results); j++ {
+			results[j] = &CheckResult{Error: ErrCheckAborted}
 		}
 
-		var checkResponse *schema.Check
+		c.rollbackChecks(ctx, user, results, created)
+		break
+	}
 
-		if checkProto.Id == "" {
-			checkResponse, err = c.Bartnet.CreateCheck(user, checkProto)
-			if err != nil {
-				log.WithError(err).Error("Error creating check.")
-				return nil, err
-			}
-		} else {
-			checkResponse, err = c.Bartnet.UpdateCheck(user, checkProto)
-			if err != nil {
-				log.WithError(err).Error("Error updating check.")
-				return nil, err
-			}
+	var ids []string
+	for _, result := range results {
+		if result.Check != nil {
+			ids = append(ids, result.Check.Id)
 		}
+	}
+	clearChecks(ctx, user, ids...)
 
-		if notifList != nil {
-			notif := &hugs.NotificationRequest{
-				CheckId: checkResponse.Id,
-			}
+	return results, nil
+}
 
-			for _, n := range notifList {
-				nl, _ := n.(map[string]interface{})
-				t, _ := nl["type"].(string)
-				v, _ := nl["value"].(string)
-
-				if t != "" && v != "" {
-					// due to our crappy backend, we send a bulk request to hugs of all notifications...
-					notif.Notifications = append(notif.Notifications, &hugs.Notification{
-						Type:  t,
-						Value: v,
-					})
-
-					// ... then we add each notification to the check object
-					checkResponse.Notifications = append(checkResponse.Notifications, &schema.Notification{
-						Type:  t,
-						Value: v,
-					})
-				}
+// rollbackChecks deletes the created checks of an atomic upsert. Checks that
+// can't be deleted stay in the results, with the reason they're still around.
+func (c *Client) rollbackChecks(ctx context.Context, user *schema.User, results []*CheckResult, created []int) {
+	for _, i := range created {
+		result := results[i]
+
+		if err := c.bartnet(ctx).DeleteCheck(user, result.Check.Id); err != nil {
+			log.WithError(err).Errorf("Error rolling back check: %s", result.Check.Id)
+			if result.Error == nil {
+				result.Error = backendError(BackendBartnet, err)
 			}
+			continue
+		}
 
-			notifs = append(notifs, notif)
+		result.Check = nil
+		if result.Error == nil {
+			result.Error = ErrCheckAborted
 		}
+	}
+}
+
+func (c *Client) upsertCheck(ctx context.Context, user *schema.User, checkInput interface{}) (*schema.Check, error) {
+	check, ok := checkInput.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidCheckInput
+	}
 
-		err = c.Hugs.CreateNotificationsMulti(user, notifs)
+	notifList, _ := check["notifications"].([]interface{})
+	delete(check, "notifications")
+
+	checkJson, err := json.Marshal(check)
+	if err != nil {
+		log.WithError(err).Error("Error marshalling check from request.")
+		return nil, err
+	}
+
+	checkProto := &schema.Check{}
+	err = jsonpb.Unmarshal(bytes.NewBuffer(checkJson), checkProto)
+	if err != nil {
+		log.WithError(err).Error("Error unmarshalling check protobuf.")
+		return nil, ErrInvalidCheckInput
+	}
+
+	var checkResponse *schema.Check
+
+	if checkProto.Id == "" {
+		checkResponse, err = c.bartnet(ctx).CreateCheck(user, checkProto)
 		if err != nil {
-			log.WithError(err).Error("Error creating notification")
-			return nil, err
+			log.WithError(err).Error("Error creating check.")
+			return nil, backendError(BackendBartnet, err)
 		}
+	} else {
+		checkResponse, err = c.bartnet(ctx).UpdateCheck(user, checkProto)
+		if err != nil {
+			log.WithError(err).Error("Error updating check.")
+			return nil, backendError(BackendBartnet, err)
+		}
+	}
+
+	if notifList == nil {
+		return checkResponse, nil
+	}
+
+	notif := &hugs.NotificationRequest{
+		CheckId: checkResponse.Id,
+	}
+
+	for _, n := range notifList {
+		nl, _ := n.(map[string]interface{})
+		t, _ := nl["type"].(string)
+		v, _ := nl["value"].(string)
+
+		if t != "" && v != "" {
+			// due to our crappy backend, we send a bulk request to hugs of all notifications...
+			notif.Notifications = append(notif.Notifications, &hugs.Notification{
+				Type:  t,
+				Value: v,
+			})
+
+			// ... then we add each notification to the check object
+			checkResponse.Notifications = append(checkResponse.Notifications, &schema.Notification{
+				Type:  t,
+				Value: v,
+			})
+		}
+	}
 
-		checksResponse[i] = checkResponse
+	err = c.hugs(ctx).CreateNotificationsMulti(user, []*hugs.NotificationRequest{notif})
+	if err != nil {
+		log.WithError(err).Error("Error creating notification")
+		return checkResponse, backendError(BackendHugs, err)
 	}
 
-	return checksResponse, nil
+	return checkResponse, nil
+}
+
+func hasCheckId(checkInput interface{}) bool {
+	check, _ := checkInput.(map[string]interface{})
+	id, _ := check["id"].(string)
+	return id != ""
 }
 
-func (c *Client) DeleteChecks(ctx context.Context, user *schema.User, checksInput []interface{}) ([]string, error) {
-	deleted := make([]string, 0, len(checksInput))
-	for _, ci := range checksInput {
+// DeleteChecks deletes each check, returning a result for each id.
+func (c *Client) DeleteChecks(ctx context.Context, user *schema.User, checksInput []interface{}) ([]*DeleteCheckResult, error) {
+	results := make([]*DeleteCheckResult, len(checksInput))
+
+	for i, ci := range checksInput {
 		id, ok := ci.(string)
 		if !ok {
-			err := fmt.Errorf("unable to decode check id")
-			log.WithError(err).Error("Error in delete check request.")
-			return nil, err
+			results[i] = &DeleteCheckResult{Error: ErrInvalidCheckInput}
+			continue
 		}
 
-		err := c.Bartnet.DeleteCheck(user, id)
+		err := c.bartnet(ctx).DeleteCheck(user, id)
 		if err != nil {
-			log.WithError(err).Error("Error deleting check: %d", id)
+			log.WithError(err).Errorf("Error deleting check: %s", id)
+			results[i] = &DeleteCheckResult{Id: id, Error: backendError(BackendBartnet, err)}
 			continue
 		}
 
-		deleted = append(deleted, id)
+		results[i] = &DeleteCheckResult{Id: id, Deleted: true}
+		clearChecks(ctx, user, id)
 	}
 
-	return deleted, nil
+	return results, nil
+}
+
+// clearChecks forgets the loaded checks of the customer, and the results of
+// any checks by id, after they've changed.
+func clearChecks(ctx context.Context, user *schema.User, ids ...string) {
+	loader := LoaderFromContext(ctx)
+	loader.Clear(listChecksKey(user))
+
+	for _, id := range ids {
+		loader.Clear(getCheckKey(user, id))
+		loader.Clear(checkResultsKey(user, id))
+	}
 }
 
 func (c *Client) TestCheck(ctx context.Context, user *schema.User, checkInput map[string]interface{}) (*opsee.TestCheckResponse, error) {
@@ -302,6 +402,10 @@ func (c *Client) TestCheck(ctx context.Context, user *schema.User, checkInput ma
 		Recursive: true,
 		Quorum:    true,
 	})
+	if err != nil {
+		log.WithError(err).Error("Error getting bastion routes from etcd.")
+		return nil, backendError(BackendEtcd, err)
+	}
 
 	if len(response.Node.Nodes) == 0 {
 		return nil, fmt.Errorf("no bastions found")
@@ -335,12 +439,7 @@ func (c *Client) TestCheck(ctx context.Context, user *schema.User, checkInput ma
 			checkerPort, _ := checker["port"].(float64)
 			addr := fmt.Sprintf("%s:%d", checkerHost, int(checkerPort))
 
-			conn, err := grpc.Dial(
-				addr,
-				grpc.WithInsecure(),
-				grpc.WithBlock(),
-				grpc.WithTimeout(3*time.Second),
-			)
+			checker, conn, err := c.dialChecker(addr)
 			if err != nil {
 				log.WithError(err).Errorf("coudln't contact bastion at: %s ... ignoring", addr)
 				errChan <- err
@@ -349,7 +448,7 @@ func (c *Client) TestCheck(ctx context.Context, user *schema.User, checkInput ma
 			log.Info("established grpc connection to bastion at: %s", addr)
 			defer conn.Close()
 
-			resp, err := opsee.NewCheckerClient(conn).TestCheck(ctx, &opsee.TestCheckRequest{Deadline: deadline, Check: checkProto})
+			resp, err := checker.TestCheck(ctx, &opsee.TestCheckRequest{Deadline: deadline, Check: checkProto})
 			if err != nil {
 				log.WithError(err).Errorf("got error from bastion at: %s ... ignoring", addr)
 				errChan <- err
@@ -373,15 +472,98 @@ func (c *Client) TestCheck(ctx context.Context, user *schema.User, checkInput ma
 }
 
 func (c *Client) CheckResults(ctx context.Context, user *schema.User, checkId string) (results []*schema.CheckResult, err error) {
-	resp, err := c.Cats.GetCheckResults(ctx, &opsee.GetCheckResultsRequest{
-		CustomerId: user.CustomerId,
-		CheckId:    checkId,
+	resp, err := LoaderFromContext(ctx).Load(checkResultsKey(user, checkId), func() (interface{}, error) {
+		return c.Cats.GetCheckResults(ctx, &opsee.GetCheckResultsRequest{
+			CustomerId: user.CustomerId,
+			CheckId:    checkId,
+		})
 	})
 	if err != nil {
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
-	return resp.Results, nil
+	return resp.(*opsee.GetCheckResultsResponse).Results, nil
+}
+
+// checkResultsMulti fans out to cats for the results of every check at once,
+// rather than one request at a time. Results are keyed by check id.
+func (c *Client) checkResultsMulti(ctx context.Context, user *schema.User, checkIds []string) (map[string][]*schema.CheckResult, error) {
+	var (
+		loader  = LoaderFromContext(ctx)
+		keys    = make([]string, len(checkIds))
+		results = make(map[string][]*schema.CheckResult, len(checkIds))
+	)
+
+	if loader == nil {
+		loader = NewLoader()
+	}
+
+	keyIds := make(map[string]string, len(checkIds))
+	for i, checkId := range checkIds {
+		keys[i] = checkResultsKey(user, checkId)
+		keyIds[keys[i]] = checkId
+	}
+
+	responses, errs := loader.LoadMany(keys, func(key string) (interface{}, error) {
+		return c.Cats.GetCheckResults(ctx, &opsee.GetCheckResultsRequest{
+			CustomerId: user.CustomerId,
+			CheckId:    keyIds[key],
+		})
+	})
+
+	for i, resp := range responses {
+		if errs[i] != nil {
+			return nil, backendError(BackendCats, errs[i])
+		}
+
+		results[checkIds[i]] = resp.(*opsee.GetCheckResultsResponse).Results
+	}
+
+	return results, nil
+}
+
+func checkResultsKey(user *schema.User, checkId string) string {
+	return fmt.Sprintf("cats:GetCheckResults:%s:%s", user.CustomerId, checkId)
+}
+
+func getCheckKey(user *schema.User, checkId string) string {
+	return fmt.Sprintf("bartnet:GetCheck:%s:%s", user.CustomerId, checkId)
+}
+
+func listChecksKey(user *schema.User) string {
+	return fmt.Sprintf("bartnet:ListChecks:%s", user.CustomerId)
+}
+
+// bartnetGetCheck returns a copy of the loaded check, since ListChecks fills
+// in its results and notifications, and other callers share what's loaded.
+func (c *Client) bartnetGetCheck(ctx context.Context, user *schema.User, checkId string) (*schema.Check, error) {
+	check, err := LoaderFromContext(ctx).Load(getCheckKey(user, checkId), func() (interface{}, error) {
+		return c.bartnet(ctx).GetCheck(user, checkId)
+	})
+	if err != nil {
+		return nil, backendError(BackendBartnet, err)
+	}
+
+	copied := *check.(*schema.Check)
+	return &copied, nil
+}
+
+// bartnetListChecks returns copies of the loaded checks, like bartnetGetCheck.
+func (c *Client) bartnetListChecks(ctx context.Context, user *schema.User) ([]*schema.Check, error) {
+	loaded, err := LoaderFromContext(ctx).Load(listChecksKey(user), func() (interface{}, error) {
+		return c.bartnet(ctx).ListChecks(user)
+	})
+	if err != nil {
+		return nil, backendError(BackendBartnet, err)
+	}
+
+	checks := make([]*schema.Check, len(loaded.([]*schema.Check)))
+	for i, check := range loaded.([]*schema.Check) {
+		copied := *check
+		checks[i] = &copied
+	}
+
+	return checks, nil
 }
 
 // Get check state transitions from cats
@@ -395,7 +577,7 @@ func (c *Client) GetCheckStateTransitions(ctx context.Context, user *schema.User
 
 	resp, err := c.Cats.GetCheckStateTransitions(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
 	return resp.Transitions, nil
@@ -411,7 +593,7 @@ func (c *Client) GetCheckStateTransition(ctx context.Context, user *schema.User,
 
 	resp, err := c.Cats.GetCheckStateTransitions(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
 	if len(resp.Transitions) == 1 {
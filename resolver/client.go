@@ -3,6 +3,12 @@ package resolver
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -13,21 +19,138 @@ import (
 	"github.com/opsee/basic/clients/beavis"
 	"github.com/opsee/basic/clients/hugs"
 	opsee "github.com/opsee/basic/service"
+	"github.com/opsee/compost/tracing"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
+const (
+	BackendBartnet    = "bartnet"
+	BackendBeavis     = "beavis"
+	BackendSpanx      = "spanx"
+	BackendCats       = "cats"
+	BackendKeelhaul   = "keelhaul"
+	BackendBezos      = "bezos"
+	BackendHugs       = "hugs"
+	BackendMarktricks = "marktricks"
+	BackendEtcd       = "etcd"
+	BackendAWS        = "aws"
+
+	defaultDynamoRegion = "us-west-2"
+)
+
+var (
+	errMissingBackend       = errors.New("missing backend address")
+	errUnknownBackend       = errors.New("tls settings for unknown backend")
+	errIncompleteKeyPair    = errors.New("tls client cert and key must be set together")
+	errNoCACertificates     = errors.New("no certificates found in ca file")
+	tlsConfigurableBackends = []string{BackendBartnet, BackendBeavis, BackendSpanx, BackendCats, BackendKeelhaul, BackendBezos, BackendHugs, BackendMarktricks, BackendEtcd}
+)
+
 type ClientConfig struct {
-	SkipVerify bool
-	Bartnet    string
-	Beavis     string
-	Spanx      string
-	Cats       string
-	Keelhaul   string
-	Bezos      string
-	Hugs       string
-	Marktricks string
-	Etcd       string
+	SkipVerify   bool                  `json:"skip_verify"`
+	Bartnet      string                `json:"bartnet"`
+	Beavis       string                `json:"beavis"`
+	Spanx        string                `json:"spanx"`
+	Cats         string                `json:"cats"`
+	Keelhaul     string                `json:"keelhaul"`
+	Bezos        string                `json:"bezos"`
+	Hugs         string                `json:"hugs"`
+	Marktricks   string                `json:"marktricks"`
+	Etcd         string                `json:"etcd"`
+	DynamoRegion string                `json:"dynamo_region"`
+	TLS          map[string]*TLSConfig `json:"tls,omitempty"`
+}
+
+// TLSConfig overrides transport security for a single backend, keyed by backend
+// name in ClientConfig.TLS. Backends without an entry verify against the system
+// roots, unless the global SkipVerify is set, which only covers the grpc
+// backends.
+type TLSConfig struct {
+	SkipVerify bool   `json:"skip_verify"`
+	CAFile     string `json:"ca_file,omitempty"`
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+
+	// Plaintext disables tls entirely, for local stand-ins
+	Plaintext bool `json:"plaintext"`
+}
+
+// Addresses returns every backend address keyed by backend name.
+func (config ClientConfig) Addresses() map[string]string {
+	return map[string]string{
+		BackendBartnet:    config.Bartnet,
+		BackendBeavis:     config.Beavis,
+		BackendSpanx:      config.Spanx,
+		BackendCats:       config.Cats,
+		BackendKeelhaul:   config.Keelhaul,
+		BackendBezos:      config.Bezos,
+		BackendHugs:       config.Hugs,
+		BackendMarktricks: config.Marktricks,
+		BackendEtcd:       config.Etcd,
+	}
+}
+
+func (config ClientConfig) Validate() error {
+	for name, addr := range config.Addresses() {
+		if addr == "" {
+			return fmt.Errorf("%s: %s", errMissingBackend, name)
+		}
+	}
+
+	for name, tlsConfig := range config.TLS {
+		if !stringIn(name, tlsConfigurableBackends) {
+			return fmt.Errorf("%s: %s", errUnknownBackend, name)
+		}
+
+		if tlsConfig != nil && (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+			return fmt.Errorf("%s: %s", errIncompleteKeyPair, name)
+		}
+	}
+
+	return nil
+}
+
+// tlsConfig builds the tls config for a backend, returning nil if the backend
+// is configured for plaintext.
+func (config ClientConfig) tlsConfig(name string) (*tls.Config, error) {
+	backendConfig, ok := config.TLS[name]
+	if !ok || backendConfig == nil {
+		return &tls.Config{InsecureSkipVerify: config.SkipVerify}, nil
+	}
+
+	if backendConfig.Plaintext {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: backendConfig.SkipVerify,
+	}
+
+	if backendConfig.CAFile != "" {
+		pem, err := ioutil.ReadFile(backendConfig.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: %s", errNoCACertificates, backendConfig.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if backendConfig.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(backendConfig.CertFile, backendConfig.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 type Client struct {
@@ -41,64 +164,195 @@ type Client struct {
 	Marktricks opsee.MarktricksClient
 	Dynamo     *dynamodb.DynamoDB
 	EtcdKeys   etcd.KeysAPI
+
+	// EC2 reboots, starts and stops instances. If nil, ec2 is called with the
+	// customer's credentials.
+	EC2 EC2
+
+	// DialChecker connects to a bastion's checker service. If nil, the bastion
+	// is dialed over grpc.
+	DialChecker func(addr string) (opsee.CheckerClient, io.Closer, error)
+
+	// HealthChecks check that each backend is reachable, keyed by backend name.
+	HealthChecks map[string]HealthCheck
 }
 
 func NewClient(config ClientConfig) (*Client, error) {
-	spanxConn, err := grpcConn(config.Spanx, config.SkipVerify)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	spanxConn, err := config.grpcConn(BackendSpanx, config.Spanx)
 	if err != nil {
 		return nil, err
 	}
 
-	catsConn, err := grpcConn(config.Cats, config.SkipVerify)
+	catsConn, err := config.grpcConn(BackendCats, config.Cats)
 	if err != nil {
 		return nil, err
 	}
 
-	keelhaulConn, err := grpcConn(config.Keelhaul, config.SkipVerify)
+	keelhaulConn, err := config.grpcConn(BackendKeelhaul, config.Keelhaul)
 	if err != nil {
 		return nil, err
 	}
 
-	bezosConn, err := grpcConn(config.Bezos, config.SkipVerify)
+	bezosConn, err := config.grpcConn(BackendBezos, config.Bezos)
 	if err != nil {
 		return nil, err
 	}
 
-	marktricksConn, err := grpcConn(config.Marktricks, config.SkipVerify)
+	marktricksConn, err := config.grpcConn(BackendMarktricks, config.Marktricks)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdTransport, err := config.etcdTransport()
 	if err != nil {
 		return nil, err
 	}
 
 	etcdClient, err := etcd.New(etcd.Config{
 		Endpoints:               []string{config.Etcd},
-		Transport:               etcd.DefaultTransport,
+		Transport:               etcdTransport,
 		HeaderTimeoutPerRequest: time.Second,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		Bartnet:    bartnet.New(config.Bartnet),
-		Beavis:     beavis.New(config.Beavis),
+	dynamoRegion := config.DynamoRegion
+	if dynamoRegion == "" {
+		dynamoRegion = defaultDynamoRegion
+	}
+
+	etcdKeys := etcd.NewKeysAPI(etcdClient)
+
+	bartnetClient, err := config.httpClient(BackendBartnet)
+	if err != nil {
+		return nil, err
+	}
+
+	beavisClient, err := config.httpClient(BackendBeavis)
+	if err != nil {
+		return nil, err
+	}
+
+	hugsClient, err := config.httpClient(BackendHugs)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		Bartnet:    newBartnetClient(config.Bartnet, bartnetClient),
+		Beavis:     newBeavisClient(config.Beavis, beavisClient),
 		Spanx:      opsee.NewSpanxClient(spanxConn),
 		Cats:       opsee.NewCatsClient(catsConn),
 		Keelhaul:   opsee.NewKeelhaulClient(keelhaulConn),
-		Hugs:       hugs.New(config.Hugs),
+		Hugs:       newHugsClient(config.Hugs, hugsClient),
 		Bezos:      opsee.NewBezosClient(bezosConn),
 		Marktricks: opsee.NewMarktricksClient(marktricksConn),
-		Dynamo:     dynamodb.New(session.New(aws.NewConfig().WithRegion("us-west-2"))),
-		EtcdKeys:   etcd.NewKeysAPI(etcdClient),
-	}, nil
+		Dynamo:     dynamodb.New(session.New(aws.NewConfig().WithRegion(dynamoRegion))),
+		EtcdKeys:   etcdKeys,
+		HealthChecks: map[string]HealthCheck{
+			BackendBartnet:    httpHealthCheck(config.Bartnet, bartnetClient),
+			BackendBeavis:     httpHealthCheck(config.Beavis, beavisClient),
+			BackendHugs:       httpHealthCheck(config.Hugs, hugsClient),
+			BackendSpanx:      grpcHealthCheck(spanxConn),
+			BackendCats:       grpcHealthCheck(catsConn),
+			BackendKeelhaul:   grpcHealthCheck(keelhaulConn),
+			BackendBezos:      grpcHealthCheck(bezosConn),
+			BackendMarktricks: grpcHealthCheck(marktricksConn),
+			BackendEtcd:       etcdHealthCheck(etcdKeys),
+		},
+	}
+	client.Instrument()
+
+	return client, nil
 }
 
-func grpcConn(addr string, skipVerify bool) (*grpc.ClientConn, error) {
+func (config ClientConfig) grpcConn(name, addr string) (*grpc.ClientConn, error) {
+	tlsConfig, err := config.tlsConfig(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig == nil {
+		return grpc.Dial(addr, grpc.WithInsecure())
+	}
+
 	return grpc.Dial(
 		addr,
 		grpc.WithTransportCredentials(
-			credentials.NewTLS(&tls.Config{
-				InsecureSkipVerify: skipVerify,
-			}),
+			credentials.NewTLS(tlsConfig),
 		),
 	)
 }
+
+// httpClient builds the client for an http backend, which passes on the trace
+// of each request. The global SkipVerify only applies to grpc backends, so
+// http backends without tls settings of their own always verify.
+func (config ClientConfig) httpClient(name string) (*http.Client, error) {
+	var tlsConfig *tls.Config
+	if _, ok := config.TLS[name]; ok {
+		var err error
+		if tlsConfig, err = config.tlsConfig(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return &http.Client{
+		Transport: &tracing.Transport{
+			Base: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSClientConfig:     tlsConfig,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		},
+	}, nil
+}
+
+func (config ClientConfig) etcdTransport() (etcd.CancelableTransport, error) {
+	if _, ok := config.TLS[BackendEtcd]; !ok {
+		return etcd.DefaultTransport, nil
+	}
+
+	tlsConfig, err := config.tlsConfig(BackendEtcd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}, nil
+}
+
+func (c *Client) dialChecker(addr string) (opsee.CheckerClient, io.Closer, error) {
+	if c.DialChecker != nil {
+		return c.DialChecker(addr)
+	}
+
+	conn, err := grpc.Dial(
+		addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithTimeout(3*time.Second),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return opsee.NewCheckerClient(conn), conn, nil
+}
+
+func stringIn(s string, list []string) bool {
+	for _, l := range list {
+		if s == l {
+			return true
+		}
+	}
+
+	return false
+}
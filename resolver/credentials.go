@@ -14,13 +14,13 @@ func (c *Client) GetCredentials(ctx context.Context, customerId string) (*opsee.
 	userResp, err := c.Cats.GetUser(ctx, &opsee.GetUserRequest{CustomerId: customerId})
 	if err != nil {
 		log.WithError(err).Error("error getting user from cats")
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
 	resp, err := c.Spanx.GetCredentials(ctx, &opsee.GetCredentialsRequest{userResp.User})
 	if err != nil {
 		log.WithError(err).Error("error getting credentials from spanx")
-		return nil, err
+		return nil, backendError(BackendSpanx, err)
 	}
 
 	return resp, nil
@@ -0,0 +1,60 @@
+package resolver
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+var (
+	ErrInvalidCheckInput = errors.New("error decoding check input")
+
+	// ErrCheckAborted is the error of checks in an atomic upsert that were
+	// rolled back or never tried because another check failed.
+	ErrCheckAborted = errors.New("aborted because another check failed")
+)
+
+// the http clients (bartnet, beavis, hugs) only report error statuses in
+// their messages
+var httpStatusPattern = regexp.MustCompile(`responded with error status: (\d{3})`)
+
+// BackendError is an error returned by a backend, along with the backend's
+// name. Its message is the backend's.
+type BackendError struct {
+	Backend string
+	Err     error
+}
+
+func (e *BackendError) Error() string {
+	return e.Err.Error()
+}
+
+// HTTPStatus is the status an http backend (or aws) responded with, or 0 if
+// the error didn't come from an http response.
+func (e *BackendError) HTTPStatus() int {
+	if failure, ok := e.Err.(awserr.RequestFailure); ok {
+		return failure.StatusCode()
+	}
+
+	match := httpStatusPattern.FindStringSubmatch(e.Err.Error())
+	if match == nil {
+		return 0
+	}
+
+	status, _ := strconv.Atoi(match[1])
+	return status
+}
+
+func backendError(backend string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*BackendError); ok {
+		return err
+	}
+
+	return &BackendError{Backend: backend, Err: err}
+}
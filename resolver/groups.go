@@ -21,7 +21,7 @@ func (c *Client) GetTaskDefinition(ctx context.Context, user *schema.User, regio
 		"customer_id": user.CustomerId,
 	}).Info("get task definition request")
 
-	resp, err := c.Bezos.Get(
+	resp, err := c.bezosGet(
 		ctx,
 		&opsee.BezosRequest{
 			User:   user,
@@ -126,7 +126,7 @@ func (c *Client) getGroupsEcsService(ctx context.Context, user *schema.User, reg
 			Cluster:  aws.String(cluster_id),
 		}
 
-		resp, err := c.Bezos.Get(
+		resp, err := c.bezosGet(
 			ctx,
 			&opsee.BezosRequest{
 				User:   user,
@@ -152,7 +152,7 @@ func (c *Client) getGroupsEcsService(ctx context.Context, user *schema.User, reg
 	}
 
 	lcInput := &opsee_aws_ecs.ListClustersInput{}
-	resp, err := c.Bezos.Get(
+	resp, err := c.bezosGet(
 		ctx,
 		&opsee.BezosRequest{
 			User:   user,
@@ -181,7 +181,7 @@ func (c *Client) getGroupsEcsService(ctx context.Context, user *schema.User, reg
 		lciInput := &opsee_aws_ecs.ListContainerInstancesInput{
 			Cluster: aws.String(cArn),
 		}
-		resp, err := c.Bezos.Get(
+		resp, err := c.bezosGet(
 			ctx,
 			&opsee.BezosRequest{
 				User:   user,
@@ -209,7 +209,7 @@ func (c *Client) getGroupsEcsService(ctx context.Context, user *schema.User, reg
 			Cluster:            aws.String(cArn),
 			ContainerInstances: lciOutput.ContainerInstanceArns,
 		}
-		resp, err = c.Bezos.Get(
+		resp, err = c.bezosGet(
 			ctx,
 			&opsee.BezosRequest{
 				User:   user,
@@ -238,7 +238,7 @@ func (c *Client) getGroupsEcsService(ctx context.Context, user *schema.User, reg
 				InstanceIds: []string{aws.StringValue(instanceId)},
 			}
 
-			resp, err := c.Bezos.Get(
+			resp, err := c.bezosGet(
 				ctx,
 				&opsee.BezosRequest{
 					User:   user,
@@ -262,7 +262,7 @@ func (c *Client) getGroupsEcsService(ctx context.Context, user *schema.User, reg
 						NextToken: nextToken,
 					}
 
-					resp, err := c.Bezos.Get(
+					resp, err := c.bezosGet(
 						ctx,
 						&opsee.BezosRequest{
 							User:   user,
@@ -287,7 +287,7 @@ func (c *Client) getGroupsEcsService(ctx context.Context, user *schema.User, reg
 						Services: lsOutput.ServiceArns,
 					}
 
-					resp, err = c.Bezos.Get(
+					resp, err = c.bezosGet(
 						ctx,
 						&opsee.BezosRequest{
 							User:   user,
@@ -336,7 +336,7 @@ func (c *Client) getGroupsSecurity(ctx context.Context, user *schema.User, regio
 		input.GroupIds = []string{groupId}
 	}
 
-	resp, err := c.Bezos.Get(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Ec2_DescribeSecurityGroupsInput{input}})
+	resp, err := c.bezosGet(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Ec2_DescribeSecurityGroupsInput{input}})
 	if err != nil {
 		return nil, err
 	}
@@ -357,7 +357,7 @@ func (c *Client) getGroupsElb(ctx context.Context, user *schema.User, region, vp
 		input.LoadBalancerNames = []string{groupId}
 	}
 
-	resp, err := c.Bezos.Get(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Elb_DescribeLoadBalancersInput{input}})
+	resp, err := c.bezosGet(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Elb_DescribeLoadBalancersInput{input}})
 	if err != nil {
 		return nil, err
 	}
@@ -378,7 +378,7 @@ func (c *Client) getGroupsAutoscaling(ctx context.Context, user *schema.User, re
 		input.AutoScalingGroupNames = []string{groupId}
 	}
 
-	resp, err := c.Bezos.Get(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Autoscaling_DescribeAutoScalingGroupsInput{input}})
+	resp, err := c.bezosGet(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Autoscaling_DescribeAutoScalingGroupsInput{input}})
 	if err != nil {
 		return nil, err
 	}
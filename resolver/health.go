@@ -0,0 +1,116 @@
+package resolver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// healthCheckTimeout bounds each backend's health check, so a hung backend
+// doesn't hang readiness.
+const healthCheckTimeout = 2 * time.Second
+
+// grpcHealthMethod is the standard grpc health check. Our services don't all
+// implement it, but any answer at all means the connection is up.
+const grpcHealthMethod = "/grpc.health.v1.Health/Check"
+
+// HealthCheck returns an error if a backend can't be reached.
+type HealthCheck func(ctx context.Context) error
+
+// Ready checks every backend concurrently, returning each one's error (nil if
+// it's reachable) keyed by backend name.
+func (c *Client) Ready(ctx context.Context) map[string]error {
+	var (
+		results = make(map[string]error, len(c.HealthChecks))
+		mut     sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	for name, check := range c.HealthChecks {
+		wg.Add(1)
+
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			err := check(ctx)
+
+			mut.Lock()
+			results[name] = err
+			mut.Unlock()
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// healthMessage is empty, which encodes the same as a health check request
+// for the whole server, and decodes any response.
+type healthMessage struct{}
+
+func (*healthMessage) Reset()         {}
+func (*healthMessage) String() string { return "" }
+func (*healthMessage) ProtoMessage()  {}
+
+func grpcHealthCheck(conn *grpc.ClientConn) HealthCheck {
+	return func(ctx context.Context) error {
+		err := grpc.Invoke(ctx, grpcHealthMethod, &healthMessage{}, &healthMessage{}, conn)
+
+		switch grpc.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+			return err
+		}
+
+		return nil
+	}
+}
+
+// httpHealthCheck requests the backend's root with the backend's own client,
+// so it's checked with the same tls settings. Anything but a server error means
+// it's up.
+func httpHealthCheck(addr string, backendClient *http.Client) HealthCheck {
+	client := &http.Client{
+		Timeout:   healthCheckTimeout,
+		Transport: backendClient.Transport,
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", addr, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("responded with error status: %s", resp.Status)
+		}
+
+		return nil
+	}
+}
+
+func etcdHealthCheck(keys etcd.KeysAPI) HealthCheck {
+	return func(ctx context.Context) error {
+		_, err := keys.Get(ctx, RoutePath, nil)
+		if err != nil && !etcd.IsKeyNotFound(err) {
+			return err
+		}
+
+		return nil
+	}
+}
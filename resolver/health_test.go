@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestHTTPHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	check := httpHealthCheck(server.URL, &http.Client{})
+	assert.NoError(check(context.Background()))
+
+	status = http.StatusBadGateway
+	assert.Error(check(context.Background()))
+
+	server.Close()
+	assert.Error(check(context.Background()))
+}
+
+func TestHTTPHealthCheckCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.Error(t, httpHealthCheck(server.URL, &http.Client{})(ctx))
+	assert.True(t, time.Since(start) < healthCheckTimeout)
+}
+
+func TestReady(t *testing.T) {
+	assert := assert.New(t)
+
+	errDown := errors.New("down")
+	client := &Client{
+		HealthChecks: map[string]HealthCheck{
+			BackendHugs: func(ctx context.Context) error { return nil },
+			BackendEtcd: func(ctx context.Context) error { return errDown },
+		},
+	}
+
+	assert.Equal(map[string]error{BackendHugs: nil, BackendEtcd: errDown}, client.Ready(context.Background()))
+}
+
+func TestHTTPBackendTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the global skip verify is only for grpc
+	config := ClientConfig{SkipVerify: true}
+	client, err := config.httpClient(BackendBartnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(httpHealthCheck(server.URL, client)(context.Background()))
+
+	config.TLS = map[string]*TLSConfig{BackendBartnet: &TLSConfig{SkipVerify: true}}
+	client, err = config.httpClient(BackendBartnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(httpHealthCheck(server.URL, client)(context.Background()))
+}
@@ -0,0 +1,305 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/opsee/basic/clients/bartnet"
+	"github.com/opsee/basic/clients/beavis"
+	"github.com/opsee/basic/clients/hugs"
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"golang.org/x/net/context"
+)
+
+// httpBackend makes requests to bartnet, beavis or hugs as a user, like their
+// opsee/basic clients, but with a context and an http client of our own, so
+// requests carry the trace and use the backend's tls settings.
+type httpBackend struct {
+	name     string
+	endpoint string
+	client   *http.Client
+
+	// maxStatus is the highest status that isn't an error
+	maxStatus int
+}
+
+func (b *httpBackend) do(ctx context.Context, user *schema.User, method, path string, header http.Header, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, b.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	toke, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString(toke)))
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode > b.maxStatus {
+		return nil, fmt.Errorf("%s responded with error status: %s", b.name, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// bartnetClient implements bartnet.Client.
+type bartnetClient struct {
+	backend *httpBackend
+	ctx     context.Context
+}
+
+func newBartnetClient(endpoint string, client *http.Client) *bartnetClient {
+	return &bartnetClient{backend: &httpBackend{name: BackendBartnet, endpoint: endpoint, client: client, maxStatus: 399}}
+}
+
+// withContext returns a client whose requests are made with ctx.
+func (c *bartnetClient) withContext(ctx context.Context) bartnet.Client {
+	return &bartnetClient{backend: c.backend, ctx: ctx}
+}
+
+func (c *bartnetClient) do(user *schema.User, method, accept, path string, body io.Reader) ([]byte, error) {
+	return c.backend.do(c.ctx, user, method, path, http.Header{
+		"Content-Type": {"application/json"},
+		"Accept":       {accept},
+	}, body)
+}
+
+func (c *bartnetClient) GetCheck(user *schema.User, id string) (*schema.Check, error) {
+	if id == "" {
+		return nil, fmt.Errorf("can't get check without an id")
+	}
+
+	body, err := c.do(user, "GET", "application/x-protobuf", fmt.Sprintf("/gql/checks/%s", id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &schema.Check{}
+	if err := proto.Unmarshal(body, check); err != nil {
+		return nil, err
+	}
+
+	return check, nil
+}
+
+func (c *bartnetClient) ListChecks(user *schema.User) ([]*schema.Check, error) {
+	body, err := c.do(user, "GET", "application/x-protobuf", "/gql/checks", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := &opsee.CheckResourceRequest{}
+	if err := proto.Unmarshal(body, checks); err != nil {
+		return nil, err
+	}
+
+	return checks.Checks, nil
+}
+
+func (c *bartnetClient) CreateCheck(user *schema.User, check *schema.Check) (*schema.Check, error) {
+	data, err := check.MarshalCrappyJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.do(user, "POST", "application/x-protobuf", "/checks", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+
+	checks := &opsee.CheckResourceRequest{}
+	if err := proto.Unmarshal(body, checks); err != nil {
+		return nil, err
+	}
+
+	if len(checks.Checks) < 1 {
+		return nil, fmt.Errorf("no checks returned")
+	}
+
+	return checks.Checks[0], nil
+}
+
+func (c *bartnetClient) UpdateCheck(user *schema.User, check *schema.Check) (*schema.Check, error) {
+	if check.Id == "" {
+		return nil, fmt.Errorf("can't update check without an id")
+	}
+
+	data, err := check.MarshalCrappyJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.do(user, "PUT", "application/x-protobuf", fmt.Sprintf("/checks/%s", check.Id), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+
+	updated := &schema.Check{}
+	if err := proto.Unmarshal(body, updated); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (c *bartnetClient) DeleteCheck(user *schema.User, id string) error {
+	if id == "" {
+		return fmt.Errorf("can't delete a check without id")
+	}
+
+	_, err := c.do(user, "DELETE", "application/json", fmt.Sprintf("/checks/%s", id), nil)
+	return err
+}
+
+func (c *bartnetClient) TestCheck(user *schema.User, check *schema.Check) (*opsee.TestCheckResponse, error) {
+	data, err := check.MarshalCrappyJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	testCheck := fmt.Sprintf(`{"max_hosts": 3, "deadline": "30s", "check": %s}`, string(data))
+
+	body, err := c.do(user, "POST", "application/x-protobuf", "/bastions/test-check", bytes.NewBufferString(testCheck))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &opsee.TestCheckResponse{}
+	if err := proto.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// beavisClient implements beavis.Client.
+type beavisClient struct {
+	backend *httpBackend
+	ctx     context.Context
+}
+
+func newBeavisClient(endpoint string, client *http.Client) *beavisClient {
+	return &beavisClient{backend: &httpBackend{name: BackendBeavis, endpoint: endpoint, client: client, maxStatus: 399}}
+}
+
+// withContext returns a client whose requests are made with ctx.
+func (c *beavisClient) withContext(ctx context.Context) beavis.Client {
+	return &beavisClient{backend: c.backend, ctx: ctx}
+}
+
+func (c *beavisClient) ListResults(user *schema.User) ([]*schema.CheckResult, error) {
+	return c.listResults(user, fmt.Sprintf("customer_id = \"%s\" and type = \"result\"", user.CustomerId))
+}
+
+func (c *beavisClient) ListResultsCheck(user *schema.User, checkId string) ([]*schema.CheckResult, error) {
+	return c.listResults(user, fmt.Sprintf("customer_id = \"%s\" and type = \"result\" and service = \"%s\"", user.CustomerId, checkId))
+}
+
+func (c *beavisClient) ListResultsTarget(user *schema.User, targetId string) ([]*schema.CheckResult, error) {
+	return c.listResults(user, fmt.Sprintf("customer_id = \"%s\" and type = \"result\" and host = \"%s\"", user.CustomerId, targetId))
+}
+
+func (c *beavisClient) listResults(user *schema.User, query string) ([]*schema.CheckResult, error) {
+	body, err := c.backend.do(c.ctx, user, "GET", "/gql/results?q="+url.QueryEscape(query), http.Header{
+		"Accept": {"application/x-protobuf"},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &opsee.ResultsResource{}
+	if err := proto.Unmarshal(body, results); err != nil {
+		return nil, err
+	}
+
+	return results.Results, nil
+}
+
+// hugsClient implements hugs.Client.
+type hugsClient struct {
+	backend *httpBackend
+	ctx     context.Context
+}
+
+func newHugsClient(endpoint string, client *http.Client) *hugsClient {
+	return &hugsClient{backend: &httpBackend{name: BackendHugs, endpoint: endpoint, client: client, maxStatus: 299}}
+}
+
+// withContext returns a client whose requests are made with ctx.
+func (c *hugsClient) withContext(ctx context.Context) hugs.Client {
+	return &hugsClient{backend: c.backend, ctx: ctx}
+}
+
+func (c *hugsClient) ListNotifications(user *schema.User) ([]*hugs.Notification, error) {
+	return c.listNotifications(user, "/notifications")
+}
+
+func (c *hugsClient) ListNotificationsDefault(user *schema.User) ([]*hugs.Notification, error) {
+	return c.listNotifications(user, "/notifications-default")
+}
+
+func (c *hugsClient) ListNotificationsCheck(user *schema.User, checkId string) ([]*hugs.Notification, error) {
+	return c.listNotifications(user, fmt.Sprintf("/notifications/%s", checkId))
+}
+
+func (c *hugsClient) listNotifications(user *schema.User, path string) ([]*hugs.Notification, error) {
+	body, err := c.backend.do(c.ctx, user, "GET", path, http.Header{"Accept": {"application/json"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications *hugs.NotificationResponse
+	if err := json.Unmarshal(body, &notifications); err != nil {
+		return nil, err
+	}
+
+	if notifications == nil {
+		return nil, nil
+	}
+
+	return notifications.Notifications, nil
+}
+
+func (c *hugsClient) CreateNotifications(user *schema.User, noteReq *hugs.NotificationRequest) error {
+	return c.createNotifications(user, "/notifications", noteReq)
+}
+
+func (c *hugsClient) CreateNotificationsDefault(user *schema.User, noteReq *hugs.NotificationRequest) error {
+	return c.createNotifications(user, "/notifications-default", noteReq)
+}
+
+func (c *hugsClient) CreateNotificationsMulti(user *schema.User, noteReq []*hugs.NotificationRequest) error {
+	return c.createNotifications(user, "/notifications-multicheck", noteReq)
+}
+
+func (c *hugsClient) createNotifications(user *schema.User, path string, noteReq interface{}) error {
+	data, err := json.Marshal(noteReq)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.backend.do(c.ctx, user, "POST", path, http.Header{"Accept": {"application/json"}}, bytes.NewBuffer(data))
+	return err
+}
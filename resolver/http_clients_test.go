@@ -0,0 +1,62 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/opsee/basic/clients/hugs"
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClients(t *testing.T) {
+	assert := assert.New(t)
+	user := &schema.User{Id: 1, CustomerId: "customer"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var decoded schema.User
+		data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(r.Header.Get("Authorization"), "Basic "))
+		if json.Unmarshal(data, &decoded) != nil || decoded.CustomerId != user.CustomerId {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/gql/checks":
+			data, _ := proto.Marshal(&opsee.CheckResourceRequest{Checks: []*schema.Check{{Id: "check-1"}}})
+			rw.Write(data)
+		case "/gql/results":
+			data, _ := proto.Marshal(&opsee.ResultsResource{Results: []*schema.CheckResult{{CheckId: "check-1"}}})
+			rw.Write(data)
+		case "/notifications":
+			json.NewEncoder(rw).Encode(&hugs.NotificationResponse{Notifications: []*hugs.Notification{{CheckId: "check-1", Type: "email"}}})
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	checks, err := newBartnetClient(server.URL, &http.Client{}).ListChecks(user)
+	if assert.NoError(err) && assert.Len(checks, 1) {
+		assert.Equal("check-1", checks[0].Id)
+	}
+
+	results, err := newBeavisClient(server.URL, &http.Client{}).ListResults(user)
+	if assert.NoError(err) && assert.Len(results, 1) {
+		assert.Equal("check-1", results[0].CheckId)
+	}
+
+	notifications, err := newHugsClient(server.URL, &http.Client{}).ListNotifications(user)
+	if assert.NoError(err) && assert.Len(notifications, 1) {
+		assert.Equal("email", notifications[0].Type)
+	}
+
+	_, err = newBartnetClient(server.URL, &http.Client{}).GetCheck(user, "check-1")
+	assert.EqualError(err, "bartnet responded with error status: 404 Not Found")
+}
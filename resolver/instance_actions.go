@@ -8,49 +8,94 @@ import (
 	"golang.org/x/net/context"
 )
 
-func (c *Client) RebootInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error {
-	logger := log.WithFields(log.Fields{
-		"customer_id": user.CustomerId,
-	})
-	logger.Info("reboot instances request")
+// EC2 changes the state of a customer's instances in a region.
+type EC2 interface {
+	RebootInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error
+	StartInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error
+	StopInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error
+}
+
+// awsEC2 calls ec2 with the customer's spanx credentials.
+type awsEC2 struct {
+	client *Client
+}
 
-	session, err := c.awsSession(ctx, user, region)
+func (a *awsEC2) RebootInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error {
+	session, err := a.client.awsSession(ctx, user, region)
 	if err != nil {
-		logger.WithError(err).Error("error acquiring aws session")
 		return err
 	}
 
 	_, err = ec2.New(session).RebootInstances(&ec2.RebootInstancesInput{
 		InstanceIds: aws.StringSlice(instanceIds),
 	})
+	return err
+}
 
+func (a *awsEC2) StartInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error {
+	session, err := a.client.awsSession(ctx, user, region)
 	if err != nil {
-		logger.WithError(err).Error("error rebooting instances")
 		return err
 	}
 
-	return nil
+	_, err = ec2.New(session).StartInstances(&ec2.StartInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIds),
+	})
+	return err
 }
 
-func (c *Client) StartInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error {
+func (a *awsEC2) StopInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error {
+	session, err := a.client.awsSession(ctx, user, region)
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2.New(session).StopInstances(&ec2.StopInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIds),
+	})
+	return err
+}
+
+// ec2 returns the client's EC2, or aws if it has none.
+func (c *Client) ec2() EC2 {
+	if c.EC2 != nil {
+		return c.EC2
+	}
+
+	return &awsEC2{client: c}
+}
+
+func (c *Client) RebootInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error {
 	logger := log.WithFields(log.Fields{
 		"customer_id": user.CustomerId,
 	})
-	logger.Info("start instances request")
+	logger.Info("reboot instances request")
+
+	ctx, done := startBackendCall(ctx, BackendAWS, "RebootInstances")
+	err := c.ec2().RebootInstances(ctx, user, region, instanceIds)
+	done(err)
 
-	session, err := c.awsSession(ctx, user, region)
 	if err != nil {
-		logger.WithError(err).Error("error acquiring aws session")
-		return err
+		logger.WithError(err).Error("error rebooting instances")
+		return backendError(BackendAWS, err)
 	}
 
-	_, err = ec2.New(session).StartInstances(&ec2.StartInstancesInput{
-		InstanceIds: aws.StringSlice(instanceIds),
+	return nil
+}
+
+func (c *Client) StartInstances(ctx context.Context, user *schema.User, region string, instanceIds []string) error {
+	logger := log.WithFields(log.Fields{
+		"customer_id": user.CustomerId,
 	})
+	logger.Info("start instances request")
+
+	ctx, done := startBackendCall(ctx, BackendAWS, "StartInstances")
+	err := c.ec2().StartInstances(ctx, user, region, instanceIds)
+	done(err)
 
 	if err != nil {
 		logger.WithError(err).Error("error starting instances")
-		return err
+		return backendError(BackendAWS, err)
 	}
 
 	return nil
@@ -62,19 +107,13 @@ func (c *Client) StopInstances(ctx context.Context, user *schema.User, region st
 	})
 	logger.Info("stop instances request")
 
-	session, err := c.awsSession(ctx, user, region)
-	if err != nil {
-		logger.WithError(err).Error("error acquiring aws session")
-		return err
-	}
-
-	_, err = ec2.New(session).StopInstances(&ec2.StopInstancesInput{
-		InstanceIds: aws.StringSlice(instanceIds),
-	})
+	ctx, done := startBackendCall(ctx, BackendAWS, "StopInstances")
+	err := c.ec2().StopInstances(ctx, user, region, instanceIds)
+	done(err)
 
 	if err != nil {
 		logger.WithError(err).Error("error stopping instances")
-		return err
+		return backendError(BackendAWS, err)
 	}
 
 	return nil
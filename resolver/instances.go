@@ -41,7 +41,7 @@ func (c *Client) getInstancesEc2(ctx context.Context, user *schema.User, region,
 		input.InstanceIds = []string{instanceId}
 	}
 
-	resp, err := c.Bezos.Get(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Ec2_DescribeInstancesInput{input}})
+	resp, err := c.bezosGet(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Ec2_DescribeInstancesInput{input}})
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +73,7 @@ func (c *Client) getInstancesRds(ctx context.Context, user *schema.User, region,
 		input.DBInstanceIdentifier = aws.String(instanceId)
 	}
 
-	resp, err := c.Bezos.Get(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Rds_DescribeDBInstancesInput{input}})
+	resp, err := c.bezosGet(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: vpc, Input: &opsee.BezosRequest_Rds_DescribeDBInstancesInput{input}})
 	if err != nil {
 		return nil, err
 	}
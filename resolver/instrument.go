@@ -0,0 +1,474 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/opsee/basic/clients/bartnet"
+	"github.com/opsee/basic/clients/beavis"
+	"github.com/opsee/basic/clients/hugs"
+	"github.com/opsee/basic/schema"
+	opsee "github.com/opsee/basic/service"
+	"github.com/opsee/compost/metrics"
+	"github.com/opsee/compost/tracing"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var (
+	backendRequests = metrics.NewCounter(
+		"compost_backend_requests_total",
+		"Backend calls by backend, call and whether they failed.",
+		"backend", "call", "status",
+	)
+	backendDuration = metrics.NewHistogram(
+		"compost_backend_request_duration_seconds",
+		"Backend call latency by backend and call.",
+		metrics.DefaultBuckets,
+		"backend", "call",
+	)
+)
+
+// startBackendCall starts timing and tracing a backend call, and adds the
+// trace to ctx's grpc metadata. The returned func finishes the call.
+func startBackendCall(ctx context.Context, backend, call string) (context.Context, func(error)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	start := time.Now()
+	span, ctx := tracing.StartSpan(ctx, backend+" "+call)
+	span.SetTag("backend", backend)
+
+	return tracing.WithGRPCMetadata(ctx), func(err error) {
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+
+		backendRequests.Inc(backend, call, status)
+		backendDuration.Since(start, backend, call)
+		span.Finish(err)
+	}
+}
+
+// Instrument wraps every backend so calls made through the client are counted,
+// timed and traced. Calls are labeled with their grpc method, bezos input type,
+// or http route.
+func (c *Client) Instrument() {
+	c.Bartnet = &instrumentedBartnet{client: c.Bartnet}
+	c.Beavis = &instrumentedBeavis{client: c.Beavis}
+	c.Spanx = &instrumentedSpanx{c.Spanx}
+	c.Cats = &instrumentedCats{c.Cats}
+	c.Keelhaul = &instrumentedKeelhaul{c.Keelhaul}
+	c.Hugs = &instrumentedHugs{client: c.Hugs}
+	c.Bezos = &instrumentedBezos{c.Bezos}
+	c.Marktricks = &instrumentedMarktricks{c.Marktricks}
+	c.EtcdKeys = &instrumentedEtcd{c.EtcdKeys}
+}
+
+// bartnet returns the bartnet client, tracing its calls under ctx's span.
+func (c *Client) bartnet(ctx context.Context) bartnet.Client {
+	if instrumented, ok := c.Bartnet.(*instrumentedBartnet); ok {
+		return &instrumentedBartnet{client: instrumented.client, ctx: ctx}
+	}
+
+	return c.Bartnet
+}
+
+// beavis returns the beavis client, tracing its calls under ctx's span.
+func (c *Client) beavis(ctx context.Context) beavis.Client {
+	if instrumented, ok := c.Beavis.(*instrumentedBeavis); ok {
+		return &instrumentedBeavis{client: instrumented.client, ctx: ctx}
+	}
+
+	return c.Beavis
+}
+
+// hugs returns the hugs client, tracing its calls under ctx's span.
+func (c *Client) hugs(ctx context.Context) hugs.Client {
+	if instrumented, ok := c.Hugs.(*instrumentedHugs); ok {
+		return &instrumentedHugs{client: instrumented.client, ctx: ctx}
+	}
+
+	return c.Hugs
+}
+
+// bartnetWithContext returns a bartnet client whose requests carry ctx's trace,
+// if it's able to.
+func bartnetWithContext(client bartnet.Client, ctx context.Context) bartnet.Client {
+	if c, ok := client.(interface {
+		withContext(context.Context) bartnet.Client
+	}); ok {
+		return c.withContext(ctx)
+	}
+
+	return client
+}
+
+// instrumentedBartnet traces its calls as children of ctx's span.
+type instrumentedBartnet struct {
+	client bartnet.Client
+	ctx    context.Context
+}
+
+func (i *instrumentedBartnet) GetCheck(user *schema.User, id string) (check *schema.Check, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBartnet, "GET /gql/checks/:id")
+	defer func() { done(err) }()
+
+	return bartnetWithContext(i.client, ctx).GetCheck(user, id)
+}
+
+func (i *instrumentedBartnet) ListChecks(user *schema.User) (checks []*schema.Check, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBartnet, "GET /gql/checks")
+	defer func() { done(err) }()
+
+	return bartnetWithContext(i.client, ctx).ListChecks(user)
+}
+
+func (i *instrumentedBartnet) CreateCheck(user *schema.User, check *schema.Check) (created *schema.Check, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBartnet, "POST /checks")
+	defer func() { done(err) }()
+
+	return bartnetWithContext(i.client, ctx).CreateCheck(user, check)
+}
+
+func (i *instrumentedBartnet) UpdateCheck(user *schema.User, check *schema.Check) (updated *schema.Check, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBartnet, "PUT /checks/:id")
+	defer func() { done(err) }()
+
+	return bartnetWithContext(i.client, ctx).UpdateCheck(user, check)
+}
+
+func (i *instrumentedBartnet) DeleteCheck(user *schema.User, id string) (err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBartnet, "DELETE /checks/:id")
+	defer func() { done(err) }()
+
+	return bartnetWithContext(i.client, ctx).DeleteCheck(user, id)
+}
+
+func (i *instrumentedBartnet) TestCheck(user *schema.User, check *schema.Check) (resp *opsee.TestCheckResponse, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBartnet, "POST /bastions/test-check")
+	defer func() { done(err) }()
+
+	return bartnetWithContext(i.client, ctx).TestCheck(user, check)
+}
+
+// beavisWithContext returns a beavis client whose requests carry ctx's trace,
+// if it's able to.
+func beavisWithContext(client beavis.Client, ctx context.Context) beavis.Client {
+	if c, ok := client.(interface {
+		withContext(context.Context) beavis.Client
+	}); ok {
+		return c.withContext(ctx)
+	}
+
+	return client
+}
+
+// instrumentedBeavis traces its calls as children of ctx's span.
+type instrumentedBeavis struct {
+	client beavis.Client
+	ctx    context.Context
+}
+
+func (i *instrumentedBeavis) ListResults(user *schema.User) (results []*schema.CheckResult, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBeavis, "GET /gql/results")
+	defer func() { done(err) }()
+
+	return beavisWithContext(i.client, ctx).ListResults(user)
+}
+
+func (i *instrumentedBeavis) ListResultsCheck(user *schema.User, checkId string) (results []*schema.CheckResult, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBeavis, "GET /gql/results")
+	defer func() { done(err) }()
+
+	return beavisWithContext(i.client, ctx).ListResultsCheck(user, checkId)
+}
+
+func (i *instrumentedBeavis) ListResultsTarget(user *schema.User, targetId string) (results []*schema.CheckResult, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendBeavis, "GET /gql/results")
+	defer func() { done(err) }()
+
+	return beavisWithContext(i.client, ctx).ListResultsTarget(user, targetId)
+}
+
+// hugsWithContext returns a hugs client whose requests carry ctx's trace, if
+// it's able to.
+func hugsWithContext(client hugs.Client, ctx context.Context) hugs.Client {
+	if c, ok := client.(interface {
+		withContext(context.Context) hugs.Client
+	}); ok {
+		return c.withContext(ctx)
+	}
+
+	return client
+}
+
+// instrumentedHugs traces its calls as children of ctx's span.
+type instrumentedHugs struct {
+	client hugs.Client
+	ctx    context.Context
+}
+
+func (i *instrumentedHugs) ListNotifications(user *schema.User) (notifications []*hugs.Notification, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendHugs, "GET /notifications")
+	defer func() { done(err) }()
+
+	return hugsWithContext(i.client, ctx).ListNotifications(user)
+}
+
+func (i *instrumentedHugs) ListNotificationsDefault(user *schema.User) (notifications []*hugs.Notification, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendHugs, "GET /notifications-default")
+	defer func() { done(err) }()
+
+	return hugsWithContext(i.client, ctx).ListNotificationsDefault(user)
+}
+
+func (i *instrumentedHugs) ListNotificationsCheck(user *schema.User, checkId string) (notifications []*hugs.Notification, err error) {
+	ctx, done := startBackendCall(i.ctx, BackendHugs, "GET /notifications/:check_id")
+	defer func() { done(err) }()
+
+	return hugsWithContext(i.client, ctx).ListNotificationsCheck(user, checkId)
+}
+
+func (i *instrumentedHugs) CreateNotifications(user *schema.User, noteReq *hugs.NotificationRequest) (err error) {
+	ctx, done := startBackendCall(i.ctx, BackendHugs, "POST /notifications")
+	defer func() { done(err) }()
+
+	return hugsWithContext(i.client, ctx).CreateNotifications(user, noteReq)
+}
+
+func (i *instrumentedHugs) CreateNotificationsDefault(user *schema.User, noteReq *hugs.NotificationRequest) (err error) {
+	ctx, done := startBackendCall(i.ctx, BackendHugs, "POST /notifications-default")
+	defer func() { done(err) }()
+
+	return hugsWithContext(i.client, ctx).CreateNotificationsDefault(user, noteReq)
+}
+
+func (i *instrumentedHugs) CreateNotificationsMulti(user *schema.User, noteReq []*hugs.NotificationRequest) (err error) {
+	ctx, done := startBackendCall(i.ctx, BackendHugs, "POST /notifications-multicheck")
+	defer func() { done(err) }()
+
+	return hugsWithContext(i.client, ctx).CreateNotificationsMulti(user, noteReq)
+}
+
+type instrumentedSpanx struct {
+	client opsee.SpanxClient
+}
+
+func (i *instrumentedSpanx) EnhancedCombatMode(ctx context.Context, in *opsee.EnhancedCombatModeRequest, opts ...grpc.CallOption) (out *opsee.EnhancedCombatModeResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendSpanx, "EnhancedCombatMode")
+	defer func() { done(err) }()
+
+	return i.client.EnhancedCombatMode(ctx, in, opts...)
+}
+
+func (i *instrumentedSpanx) GetRoleStack(ctx context.Context, in *opsee.GetRoleStackRequest, opts ...grpc.CallOption) (out *opsee.GetRoleStackResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendSpanx, "GetRoleStack")
+	defer func() { done(err) }()
+
+	return i.client.GetRoleStack(ctx, in, opts...)
+}
+
+func (i *instrumentedSpanx) GetCredentials(ctx context.Context, in *opsee.GetCredentialsRequest, opts ...grpc.CallOption) (out *opsee.GetCredentialsResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendSpanx, "GetCredentials")
+	defer func() { done(err) }()
+
+	return i.client.GetCredentials(ctx, in, opts...)
+}
+
+type instrumentedCats struct {
+	client opsee.CatsClient
+}
+
+func (i *instrumentedCats) GetCheckCount(ctx context.Context, in *opsee.GetCheckCountRequest, opts ...grpc.CallOption) (out *opsee.GetCheckCountResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "GetCheckCount")
+	defer func() { done(err) }()
+
+	return i.client.GetCheckCount(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) GetUser(ctx context.Context, in *opsee.GetUserRequest, opts ...grpc.CallOption) (out *opsee.GetUserResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "GetUser")
+	defer func() { done(err) }()
+
+	return i.client.GetUser(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) UpdateUser(ctx context.Context, in *opsee.UpdateUserRequest, opts ...grpc.CallOption) (out *opsee.UserTokenResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "UpdateUser")
+	defer func() { done(err) }()
+
+	return i.client.UpdateUser(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) ListUsers(ctx context.Context, in *opsee.ListUsersRequest, opts ...grpc.CallOption) (out *opsee.ListUsersResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "ListUsers")
+	defer func() { done(err) }()
+
+	return i.client.ListUsers(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) InviteUser(ctx context.Context, in *opsee.InviteUserRequest, opts ...grpc.CallOption) (out *opsee.InviteUserResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "InviteUser")
+	defer func() { done(err) }()
+
+	return i.client.InviteUser(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) DeleteUser(ctx context.Context, in *opsee.DeleteUserRequest, opts ...grpc.CallOption) (out *opsee.DeleteUserResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "DeleteUser")
+	defer func() { done(err) }()
+
+	return i.client.DeleteUser(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) GetTeam(ctx context.Context, in *opsee.GetTeamRequest, opts ...grpc.CallOption) (out *opsee.GetTeamResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "GetTeam")
+	defer func() { done(err) }()
+
+	return i.client.GetTeam(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) CreateTeam(ctx context.Context, in *opsee.CreateTeamRequest, opts ...grpc.CallOption) (out *opsee.CreateTeamResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "CreateTeam")
+	defer func() { done(err) }()
+
+	return i.client.CreateTeam(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) UpdateTeam(ctx context.Context, in *opsee.UpdateTeamRequest, opts ...grpc.CallOption) (out *opsee.UpdateTeamResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "UpdateTeam")
+	defer func() { done(err) }()
+
+	return i.client.UpdateTeam(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) DeleteTeam(ctx context.Context, in *opsee.DeleteTeamRequest, opts ...grpc.CallOption) (out *opsee.DeleteTeamResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "DeleteTeam")
+	defer func() { done(err) }()
+
+	return i.client.DeleteTeam(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) GetCheckResults(ctx context.Context, in *opsee.GetCheckResultsRequest, opts ...grpc.CallOption) (out *opsee.GetCheckResultsResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "GetCheckResults")
+	defer func() { done(err) }()
+
+	return i.client.GetCheckResults(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) GetCheckStateTransitions(ctx context.Context, in *opsee.GetCheckStateTransitionsRequest, opts ...grpc.CallOption) (out *opsee.GetCheckStateTransitionsResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "GetCheckStateTransitions")
+	defer func() { done(err) }()
+
+	return i.client.GetCheckStateTransitions(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) GetChecks(ctx context.Context, in *opsee.GetChecksRequest, opts ...grpc.CallOption) (out *opsee.GetChecksResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "GetChecks")
+	defer func() { done(err) }()
+
+	return i.client.GetChecks(ctx, in, opts...)
+}
+
+func (i *instrumentedCats) GetCheckSnapshot(ctx context.Context, in *opsee.GetCheckSnapshotRequest, opts ...grpc.CallOption) (out *opsee.GetCheckSnapshotResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendCats, "GetCheckSnapshot")
+	defer func() { done(err) }()
+
+	return i.client.GetCheckSnapshot(ctx, in, opts...)
+}
+
+type instrumentedKeelhaul struct {
+	client opsee.KeelhaulClient
+}
+
+func (i *instrumentedKeelhaul) ListBastionStates(ctx context.Context, in *opsee.ListBastionStatesRequest, opts ...grpc.CallOption) (out *opsee.ListBastionStatesResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendKeelhaul, "ListBastionStates")
+	defer func() { done(err) }()
+
+	return i.client.ListBastionStates(ctx, in, opts...)
+}
+
+func (i *instrumentedKeelhaul) ScanVpcs(ctx context.Context, in *opsee.ScanVpcsRequest, opts ...grpc.CallOption) (out *opsee.ScanVpcsResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendKeelhaul, "ScanVpcs")
+	defer func() { done(err) }()
+
+	return i.client.ScanVpcs(ctx, in, opts...)
+}
+
+func (i *instrumentedKeelhaul) LaunchStack(ctx context.Context, in *opsee.LaunchStackRequest, opts ...grpc.CallOption) (out *opsee.LaunchStackResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendKeelhaul, "LaunchStack")
+	defer func() { done(err) }()
+
+	return i.client.LaunchStack(ctx, in, opts...)
+}
+
+func (i *instrumentedKeelhaul) AuthenticateBastion(ctx context.Context, in *opsee.AuthenticateBastionRequest, opts ...grpc.CallOption) (out *opsee.AuthenticateBastionResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendKeelhaul, "AuthenticateBastion")
+	defer func() { done(err) }()
+
+	return i.client.AuthenticateBastion(ctx, in, opts...)
+}
+
+type instrumentedBezos struct {
+	client opsee.BezosClient
+}
+
+// Get is labeled with the request's input type, e.g. Ec2_DescribeInstancesInput,
+// since every bezos call goes through the one rpc.
+func (i *instrumentedBezos) Get(ctx context.Context, in *opsee.BezosRequest, opts ...grpc.CallOption) (out *opsee.BezosResponse, err error) {
+	call := strings.TrimPrefix(fmt.Sprintf("%T", in.GetInput()), "*service.BezosRequest_")
+
+	ctx, done := startBackendCall(ctx, BackendBezos, call)
+	defer func() { done(err) }()
+
+	return i.client.Get(ctx, in, opts...)
+}
+
+type instrumentedMarktricks struct {
+	client opsee.MarktricksClient
+}
+
+func (i *instrumentedMarktricks) GetMetrics(ctx context.Context, in *opsee.GetMetricsRequest, opts ...grpc.CallOption) (out *opsee.GetMetricsResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendMarktricks, "GetMetrics")
+	defer func() { done(err) }()
+
+	return i.client.GetMetrics(ctx, in, opts...)
+}
+
+func (i *instrumentedMarktricks) QueryMetrics(ctx context.Context, in *opsee.QueryMetricsRequest, opts ...grpc.CallOption) (out *opsee.QueryMetricsResponse, err error) {
+	ctx, done := startBackendCall(ctx, BackendMarktricks, "QueryMetrics")
+	defer func() { done(err) }()
+
+	return i.client.QueryMetrics(ctx, in, opts...)
+}
+
+// instrumentedEtcd times key operations; watchers are long lived and aren't.
+type instrumentedEtcd struct {
+	etcd.KeysAPI
+}
+
+func (i *instrumentedEtcd) Get(ctx context.Context, key string, opts *etcd.GetOptions) (resp *etcd.Response, err error) {
+	ctx, done := startBackendCall(ctx, BackendEtcd, "Get")
+	defer func() { done(err) }()
+
+	return i.KeysAPI.Get(ctx, key, opts)
+}
+
+func (i *instrumentedEtcd) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (resp *etcd.Response, err error) {
+	ctx, done := startBackendCall(ctx, BackendEtcd, "Set")
+	defer func() { done(err) }()
+
+	return i.KeysAPI.Set(ctx, key, value, opts)
+}
+
+func (i *instrumentedEtcd) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (resp *etcd.Response, err error) {
+	ctx, done := startBackendCall(ctx, BackendEtcd, "Delete")
+	defer func() { done(err) }()
+
+	return i.KeysAPI.Delete(ctx, key, opts)
+}
@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/tracing"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestInstrumentedHTTPTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		mut          sync.Mutex
+		traceparents = make(map[string]string)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		traceparents[r.URL.Path] = r.Header.Get(tracing.Header)
+		mut.Unlock()
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: &tracing.Transport{}}
+	client := &Client{
+		Bartnet: newBartnetClient(server.URL, httpClient),
+		Beavis:  newBeavisClient(server.URL, httpClient),
+		Hugs:    newHugsClient(server.URL, httpClient),
+	}
+	client.Instrument()
+
+	tracing.SetExporter(tracing.NewWriterExporter(&bytes.Buffer{}))
+	defer tracing.SetExporter(nil)
+
+	span, ctx := tracing.StartSpan(context.Background(), "graphql")
+	user := &schema.User{Id: 1, CustomerId: "customer"}
+
+	client.bartnet(ctx).ListChecks(user)
+	client.beavis(ctx).ListResults(user)
+	client.hugs(ctx).ListNotifications(user)
+
+	for _, path := range []string{"/gql/checks", "/gql/results", "/notifications"} {
+		// each call is a child of the request's span
+		parts := strings.Split(traceparents[path], "-")
+		if assert.Len(parts, 4, path) {
+			assert.Equal(span.TraceId, parts[1], path)
+			assert.NotEqual(span.SpanId, parts[2], path)
+		}
+	}
+}
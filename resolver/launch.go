@@ -20,7 +20,7 @@ func (c *Client) LaunchRoleUrlTemplate(ctx context.Context, user *schema.User) (
 
 	if err != nil {
 		logger.WithError(err).Error("error getting new role url template")
-		return "", err
+		return "", backendError(BackendSpanx, err)
 	}
 
 	logger.Infof("got new role url template: %s", spanxResp.StackUrl)
@@ -44,7 +44,7 @@ func (c *Client) LaunchRoleUrl(ctx context.Context, user *schema.User) (string,
 
 	if err != nil {
 		logger.WithError(err).Error("error getting new role url")
-		return "", err
+		return "", backendError(BackendSpanx, err)
 	}
 
 	logger.Infof("got new role url template: %s", spanxResp.StackUrl)
@@ -83,7 +83,7 @@ func (c *Client) GetRoleStack(ctx context.Context, user *schema.User) (*schema.R
 
 	if err != nil {
 		logger.WithError(err).Error("error getting role stack")
-		return nil, err
+		return nil, backendError(BackendSpanx, err)
 	}
 
 	if resp == nil {
@@ -108,7 +108,7 @@ func (c *Client) ScanRegion(ctx context.Context, user *schema.User, region strin
 
 	if err != nil {
 		logger.WithError(err).Error("error scanning region")
-		return nil, err
+		return nil, backendError(BackendKeelhaul, err)
 	}
 
 	logger.Infof("scanned region: %s", region)
@@ -133,9 +133,20 @@ func (c *Client) LaunchBastionStack(ctx context.Context, user *schema.User, regi
 
 	if err != nil {
 		logger.WithError(err).Error("error launching bastion stack")
-		return false, err
+		return false, backendError(BackendKeelhaul, err)
 	}
 
 	logger.Infof("launched stack - region: %s, vpc: %s, subnet: %s, routing: %s, size: %s", region, vpcId, subnetId, subnetRouting, instanceSize)
 	return true, nil
 }
+
+// ListBastionStates lists the states of the user's customer's bastions.
+func (c *Client) ListBastionStates(ctx context.Context, user *schema.User) ([]*schema.BastionState, error) {
+	resp, err := c.Keelhaul.ListBastionStates(ctx, &opsee.ListBastionStatesRequest{CustomerIds: []string{user.CustomerId}})
+	if err != nil {
+		log.WithError(err).Error("error listing bastion states from keelhaul")
+		return nil, backendError(BackendKeelhaul, err)
+	}
+
+	return resp.BastionStates, nil
+}
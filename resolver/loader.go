@@ -0,0 +1,133 @@
+package resolver
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+type loaderContextKey int
+
+const (
+	loaderKey loaderContextKey = iota
+
+	// the most backend requests a single LoadMany will have in flight at once
+	loaderConcurrency = 16
+)
+
+// Loader is a request-scoped batching cache for backend calls. Calls are keyed
+// per backend and per argument, so identical requests made while resolving a
+// single graphql query only hit the backend once, and concurrent callers of an
+// in-flight key wait on the same result.
+type Loader struct {
+	mut   sync.Mutex
+	calls map[string]*loaderCall
+}
+
+type loaderCall struct {
+	done     chan struct{}
+	response interface{}
+	err      error
+}
+
+// NewLoader returns an empty Loader.
+func NewLoader() *Loader {
+	return &Loader{
+		calls: make(map[string]*loaderCall),
+	}
+}
+
+// WithLoader attaches a new Loader to the context. It should be called once
+// per graphql request, so that nothing is cached between requests.
+func WithLoader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loaderKey, NewLoader())
+}
+
+// LoaderFromContext returns the Loader attached to the context, or nil.
+func LoaderFromContext(ctx context.Context) *Loader {
+	loader, _ := ctx.Value(loaderKey).(*Loader)
+	return loader
+}
+
+// Load returns the cached response for key, or calls fetch to populate it. A nil
+// Loader always calls fetch, so callers needn't care whether one is attached.
+func (l *Loader) Load(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	if l == nil {
+		return fetch()
+	}
+
+	l.mut.Lock()
+	call, ok := l.calls[key]
+	if ok {
+		l.mut.Unlock()
+		<-call.done
+		return call.response, call.err
+	}
+
+	call = &loaderCall{done: make(chan struct{})}
+	l.calls[key] = call
+	l.mut.Unlock()
+
+	l.fetch(call, fetch)
+
+	return call.response, call.err
+}
+
+// fetch populates call, always releasing its waiters. A panicking fetch is the
+// call's error, since graphql recovers resolver panics and anything waiting on
+// the key would otherwise wait forever.
+func (l *Loader) fetch(call *loaderCall, fetch func() (interface{}, error)) {
+	defer close(call.done)
+	defer func() {
+		if r := recover(); r != nil {
+			call.response, call.err = nil, fmt.Errorf("loader fetch panicked: %v", r)
+		}
+	}()
+
+	call.response, call.err = fetch()
+}
+
+// Clear forgets key, so the next Load fetches it again. Mutations clear what
+// they change, so the rest of the request doesn't see it as it was.
+func (l *Loader) Clear(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	delete(l.calls, key)
+}
+
+// LoadMany loads every key concurrently, with at most loaderConcurrency fetches
+// in flight, and returns responses and errors in the same order as keys.
+func (l *Loader) LoadMany(keys []string, fetch func(key string) (interface{}, error)) ([]interface{}, []error) {
+	var (
+		responses = make([]interface{}, len(keys))
+		errs      = make([]error, len(keys))
+		sem       = make(chan struct{}, loaderConcurrency)
+		wg        sync.WaitGroup
+	)
+
+	for i, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			responses[i], errs[i] = l.Load(key, func() (interface{}, error) {
+				return fetch(key)
+			})
+		}(i, key)
+	}
+
+	wg.Wait()
+
+	return responses, errs
+}
@@ -0,0 +1,110 @@
+package resolver
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestLoaderDeduplicates(t *testing.T) {
+	assert := assert.New(t)
+	ctx := WithLoader(context.Background())
+	loader := LoaderFromContext(ctx)
+
+	var calls int32
+	fetch := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return "result", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := loader.Load("bezos:same", fetch)
+		assert.NoError(err)
+		assert.Equal("result", resp)
+	}
+
+	_, err := loader.Load("bezos:different", fetch)
+	assert.NoError(err)
+	assert.EqualValues(2, calls)
+}
+
+func TestLoaderNil(t *testing.T) {
+	assert := assert.New(t)
+	loader := LoaderFromContext(context.Background())
+	assert.Nil(loader)
+
+	var calls int
+	for i := 0; i < 2; i++ {
+		loader.Load("key", func() (interface{}, error) {
+			calls++
+			return nil, nil
+		})
+	}
+
+	assert.Equal(2, calls)
+}
+
+func TestLoaderLoadMany(t *testing.T) {
+	assert := assert.New(t)
+	loader := NewLoader()
+
+	var calls int32
+	keys := []string{"a", "b", "a", "c"}
+	for i := 0; i < 40; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+
+	responses, errs := loader.LoadMany(keys, func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		if key == "c" {
+			return nil, fmt.Errorf("no c")
+		}
+		return key + "!", nil
+	})
+
+	assert.EqualValues(len(keys)-1, calls)
+	assert.Equal("a!", responses[0])
+	assert.Equal("b!", responses[1])
+	assert.Equal("a!", responses[2])
+	assert.Error(errs[3])
+	assert.Equal("key-39!", responses[len(keys)-1])
+}
+
+func TestLoaderPanic(t *testing.T) {
+	assert := assert.New(t)
+	loader := NewLoader()
+
+	_, err := loader.Load("bezos:panics", func() (interface{}, error) {
+		panic("oops")
+	})
+	assert.Error(err)
+
+	// later loads of the key get the error rather than waiting forever
+	_, err = loader.Load("bezos:panics", func() (interface{}, error) {
+		return "result", nil
+	})
+	assert.Error(err)
+}
+
+func TestLoaderClear(t *testing.T) {
+	assert := assert.New(t)
+	loader := NewLoader()
+
+	var calls int
+	fetch := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	loader.Load("bartnet:ListChecks", fetch)
+	loader.Clear("bartnet:ListChecks")
+	resp, err := loader.Load("bartnet:ListChecks", fetch)
+	assert.NoError(err)
+	assert.Equal(2, resp)
+
+	// clearing a nil loader is fine too
+	LoaderFromContext(context.Background()).Clear("bartnet:ListChecks")
+}
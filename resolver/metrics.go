@@ -19,7 +19,7 @@ func (l metricList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l metricList) Less(i, j int) bool { return l[i].Timestamp.Millis() < l[j].Timestamp.Millis() }
 
 func (c *Client) GetMetricStatistics(ctx context.Context, user *schema.User, region string, input *opsee_aws_cloudwatch.GetMetricStatisticsInput) (*schema.CloudWatchResponse, error) {
-	resp, err := c.Bezos.Get(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: "global", Input: &opsee.BezosRequest_Cloudwatch_GetMetricStatisticsInput{input}})
+	resp, err := c.bezosGet(ctx, &opsee.BezosRequest{User: user, Region: region, VpcId: "global", Input: &opsee.BezosRequest_Cloudwatch_GetMetricStatisticsInput{input}})
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +80,7 @@ func (c *Client) QueryCheckMetrics(ctx context.Context, user *schema.User, check
 
 	r, err := c.Marktricks.QueryMetrics(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, backendError(BackendMarktricks, err)
 	}
 
 	// convert kairosdb types to schema.Metric
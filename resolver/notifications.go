@@ -18,10 +18,10 @@ func (c *Client) GetNotifications(ctx context.Context, user *schema.User, defaul
 	// in the future, you will be able to list other notifications and update
 	// the objects that point to them
 	if defaultOnly {
-		notifs, err := c.Hugs.ListNotificationsDefault(user)
+		notifs, err := c.hugs(ctx).ListNotificationsDefault(user)
 		if err != nil {
 			logger.WithError(err).Error("hugs error")
-			return nil, err
+			return nil, backendError(BackendHugs, err)
 		}
 
 		// cheating here, i hate that the hugs client isn't grpc
@@ -52,10 +52,10 @@ func (c *Client) PutDefaultNotifications(ctx context.Context, user *schema.User,
 		}
 	}
 
-	err := c.Hugs.CreateNotificationsDefault(user, &hugs.NotificationRequest{Notifications: notifs})
+	err := c.hugs(ctx).CreateNotificationsDefault(user, &hugs.NotificationRequest{Notifications: notifs})
 	if err != nil {
 		logger.WithError(err).Error("hugs error")
-		return nil, err
+		return nil, backendError(BackendHugs, err)
 	}
 
 	// cheating here, i hate that the hugs client isn't grpc
@@ -20,22 +20,32 @@ func (c *Client) GetTeam(ctx context.Context, user *schema.User) (*schema.Team,
 		},
 	}
 
-	resp, err := c.Cats.GetTeam(ctx, req)
+	// the team is cached for the request, since capability checks and rate
+	// limits load it too
+	resp, err := LoaderFromContext(ctx).Load(getTeamKey(user), func() (interface{}, error) {
+		return c.Cats.GetTeam(ctx, req)
+	})
 	if err != nil {
 		log.WithError(err).Error("error getting team from cats")
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
-	var fu []*schema.User
+	team := resp.(*opsee.GetTeamResponse).Team
+	if team == nil {
+		return &schema.Team{Id: user.CustomerId}, nil
+	}
 
-	if resp.Team != nil {
-		for _, u := range resp.Team.Users {
-			fu = append(fu, &schema.User{Id: u.Id, Name: u.Name, Email: u.Email, Perms: u.Perms, Status: u.Status})
-		}
+	var fu []*schema.User
+	for _, u := range team.Users {
+		fu = append(fu, &schema.User{Id: u.Id, Name: u.Name, Email: u.Email, Perms: u.Perms, Status: u.Status})
 	}
-	resp.Team.Users = fu
 
-	return resp.Team, nil
+	// copy, so that callers sharing the cached response don't see each
+	// other's changes
+	t := *team
+	t.Users = fu
+
+	return &t, nil
 }
 
 func (c *Client) PutTeam(ctx context.Context, user *schema.User, teamInput map[string]interface{}) (*schema.Team, error) {
@@ -67,8 +77,15 @@ func (c *Client) PutTeam(ctx context.Context, user *schema.User, teamInput map[s
 	resp, err := c.Cats.UpdateTeam(ctx, req)
 	if err != nil {
 		log.WithError(err).Error("error updating team")
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
+	// the plan may have changed what the team can do
+	LoaderFromContext(ctx).Clear(getTeamKey(user))
+
 	return resp.Team, nil
 }
+
+func getTeamKey(user *schema.User) string {
+	return "cats:GetTeam:" + user.CustomerId
+}
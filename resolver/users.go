@@ -13,7 +13,7 @@ func (c *Client) ListCustomers(ctx context.Context, req *opsee.ListUsersRequest)
 	resp, err := c.Cats.ListUsers(ctx, req)
 	if err != nil {
 		log.WithError(err).Error("error listing users from cats")
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
 	// as a shim until we have a cats endpoint for listing customers, unique the customers with a map
@@ -34,7 +34,7 @@ func (c *Client) ListCustomers(ctx context.Context, req *opsee.ListUsersRequest)
 	stateResp, err := c.Keelhaul.ListBastionStates(ctx, &opsee.ListBastionStatesRequest{CustomerIds: customerIds})
 	if err != nil {
 		log.WithError(err).Error("error listing users from keelhaul")
-		return nil, err
+		return nil, backendError(BackendKeelhaul, err)
 	}
 
 	bastionStates := make(map[string][]*schema.BastionState)
@@ -77,7 +77,7 @@ func (c *Client) GetUser(ctx context.Context, req *opsee.GetUserRequest) (*opsee
 	resp, err := c.Cats.GetUser(ctx, req)
 	if err != nil {
 		log.WithError(err).Error("error getting user from cats")
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
 	return resp, nil
@@ -93,7 +93,7 @@ func (c *Client) PutUser(ctx context.Context, req *opsee.UpdateUserRequest) (*sc
 	resp, err := c.Cats.UpdateUser(ctx, req)
 	if err != nil {
 		log.WithError(err).Error("error updating user")
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 
 	return resp.User, nil
@@ -109,7 +109,7 @@ func (c *Client) InviteUser(ctx context.Context, req *opsee.InviteUserRequest) (
 	resp, err := c.Cats.InviteUser(ctx, req)
 	if err != nil {
 		log.WithError(err).Error("error inviting user")
-		return nil, err
+		return nil, backendError(BackendCats, err)
 	}
 	if resp.Invite == nil {
 		return &schema.User{}, nil
@@ -0,0 +1,97 @@
+package scope
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// ScopePath has a key per scoped user, under their customer, holding their
+// scope.
+const ScopePath = "/opsee.co/compost/scopes"
+
+// EtcdStore keeps scopes in etcd, so every compost enforces them.
+type EtcdStore struct {
+	keys etcd.KeysAPI
+}
+
+func NewEtcdStore(keys etcd.KeysAPI) *EtcdStore {
+	return &EtcdStore{keys: keys}
+}
+
+func (e *EtcdStore) Get(ctx context.Context, customerId string, userId int32) (Scope, error) {
+	response, err := e.keys.Get(ctx, userScopeKey(customerId, userId), &etcd.GetOptions{Quorum: true})
+	if etcd.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeScope(response.Node)
+}
+
+func (e *EtcdStore) Put(ctx context.Context, customerId string, userId int32, s Scope) error {
+	key := userScopeKey(customerId, userId)
+
+	if s.Unrestricted() {
+		_, err := e.keys.Delete(ctx, key, nil)
+		if err != nil && !etcd.IsKeyNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.keys.Set(ctx, key, string(data), nil)
+	return err
+}
+
+func (e *EtcdStore) List(ctx context.Context, customerId string) (map[int32]Scope, error) {
+	scopes := make(map[int32]Scope)
+
+	response, err := e.keys.Get(ctx, path.Join(ScopePath, customerId), &etcd.GetOptions{Quorum: true})
+	if etcd.IsKeyNotFound(err) {
+		return scopes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range response.Node.Nodes {
+		userId, err := strconv.ParseInt(path.Base(node.Key), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding scope %s: %s", node.Key, err)
+		}
+
+		s, err := decodeScope(node)
+		if err != nil {
+			return nil, err
+		}
+
+		scopes[int32(userId)] = s
+	}
+
+	return scopes, nil
+}
+
+func decodeScope(node *etcd.Node) (Scope, error) {
+	var s Scope
+	if err := json.Unmarshal([]byte(node.Value), &s); err != nil {
+		return nil, fmt.Errorf("error decoding scope %s: %s", node.Key, err)
+	}
+
+	return s, nil
+}
+
+func userScopeKey(customerId string, userId int32) string {
+	return path.Join(ScopePath, customerId, fmt.Sprint(userId))
+}
@@ -0,0 +1,127 @@
+// Package scope restricts users and api keys to some of their customer's AWS
+// regions and VPCs.
+package scope
+
+import (
+	"errors"
+)
+
+var (
+	ErrMissingRegion   = errors.New("scoped regions need an id")
+	ErrDuplicateRegion = errors.New("a region is scoped more than once")
+)
+
+// Scope is the regions someone may use. An empty scope is every region and
+// VPC.
+type Scope []*Region
+
+// Region allows a region, and only VpcIds in it if there are any.
+type Region struct {
+	Id     string   `json:"id"`
+	VpcIds []string `json:"vpc_ids,omitempty"`
+}
+
+// Validate returns an error for regions without ids, or repeated.
+func (s Scope) Validate() error {
+	seen := make(map[string]bool)
+	for _, r := range s {
+		if r == nil || r.Id == "" {
+			return ErrMissingRegion
+		}
+
+		if seen[r.Id] {
+			return ErrDuplicateRegion
+		}
+		seen[r.Id] = true
+	}
+
+	return nil
+}
+
+// Unrestricted is whether the scope allows every region and VPC.
+func (s Scope) Unrestricted() bool {
+	return len(s) == 0
+}
+
+func (s Scope) region(id string) *Region {
+	for _, r := range s {
+		if r.Id == id {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// AllowsRegion is whether any of region may be used.
+func (s Scope) AllowsRegion(region string) bool {
+	return s.Unrestricted() || s.region(region) != nil
+}
+
+// AllowsVpc is whether a VPC in region may be used. An empty vpc is the whole
+// region, which is only allowed if the region's VPCs aren't restricted.
+func (s Scope) AllowsVpc(region, vpc string) bool {
+	if s.Unrestricted() {
+		return true
+	}
+
+	r := s.region(region)
+	if r == nil {
+		return false
+	}
+
+	if len(r.VpcIds) == 0 {
+		return true
+	}
+
+	for _, id := range r.VpcIds {
+		if id == vpc {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Vpcs are the VPCs of region that may be used, and whether they're
+// restricted at all.
+func (s Scope) Vpcs(region string) ([]string, bool) {
+	if s.Unrestricted() {
+		return nil, false
+	}
+
+	r := s.region(region)
+	if r == nil {
+		return []string{}, true
+	}
+
+	return r.VpcIds, len(r.VpcIds) > 0
+}
+
+// Within is whether everything s allows, other allows too.
+func (s Scope) Within(other Scope) bool {
+	if other.Unrestricted() {
+		return true
+	}
+
+	if s.Unrestricted() {
+		return false
+	}
+
+	for _, r := range s {
+		if len(r.VpcIds) == 0 {
+			if !other.AllowsVpc(r.Id, "") {
+				return false
+			}
+			continue
+		}
+
+		for _, vpc := range r.VpcIds {
+			if !other.AllowsVpc(r.Id, vpc) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
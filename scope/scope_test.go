@@ -0,0 +1,87 @@
+package scope
+
+import (
+	"testing"
+
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestScope(t *testing.T) {
+	assert := assert.New(t)
+
+	s := Scope{
+		{Id: "us-west-2", VpcIds: []string{"vpc-1"}},
+		{Id: "us-east-1"},
+	}
+	assert.NoError(s.Validate())
+	assert.Equal(ErrDuplicateRegion, Scope{{Id: "us-west-2"}, {Id: "us-west-2"}}.Validate())
+	assert.Equal(ErrMissingRegion, Scope{{}}.Validate())
+
+	assert.True(s.AllowsRegion("us-west-2"))
+	assert.False(s.AllowsRegion("eu-west-1"))
+
+	assert.True(s.AllowsVpc("us-west-2", "vpc-1"))
+	assert.False(s.AllowsVpc("us-west-2", "vpc-2"))
+	assert.False(s.AllowsVpc("us-west-2", ""))
+	assert.True(s.AllowsVpc("us-east-1", ""))
+	assert.True(s.AllowsVpc("us-east-1", "vpc-3"))
+
+	assert.True(Scope(nil).AllowsVpc("eu-west-1", ""))
+
+	assert.True(Scope{{Id: "us-west-2", VpcIds: []string{"vpc-1"}}}.Within(s))
+	assert.True(Scope{{Id: "us-east-1", VpcIds: []string{"vpc-3"}}}.Within(s))
+	assert.False(Scope{{Id: "us-west-2"}}.Within(s))
+	assert.False(Scope(nil).Within(s))
+	assert.True(s.Within(nil))
+}
+
+func TestStores(t *testing.T) {
+	for name, store := range map[string]Store{
+		StoreMemory: NewMemoryStore(),
+		StoreEtcd:   NewEtcdStore(fake.NewEtcd(nil)),
+	} {
+		testStore(t, name, store)
+	}
+}
+
+func testStore(t *testing.T, name string, store Store) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	s, err := store.Get(ctx, "customer", 1)
+	assert.NoError(err, name)
+	assert.True(s.Unrestricted(), name)
+
+	scoped := Scope{{Id: "us-west-2", VpcIds: []string{"vpc-1"}}}
+	assert.NoError(store.Put(ctx, "customer", 1, scoped), name)
+	assert.NoError(store.Put(ctx, "other", 1, Scope{{Id: "us-east-1"}}), name)
+
+	s, err = store.Get(ctx, "customer", 1)
+	assert.NoError(err, name)
+	assert.Equal(scoped, s, name)
+
+	scopes, err := store.List(ctx, "customer")
+	assert.NoError(err, name)
+	assert.Equal(map[int32]Scope{1: scoped}, scopes, name)
+
+	assert.NoError(store.Put(ctx, "customer", 1, nil), name)
+	s, err = store.Get(ctx, "customer", 1)
+	assert.NoError(err, name)
+	assert.True(s.Unrestricted(), name)
+
+	scopes, err = store.List(ctx, "customer")
+	assert.NoError(err, name)
+	assert.Len(scopes, 0, name)
+}
+
+func TestConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Config{}.Validate())
+	assert.Error(Config{Store: "file"}.Validate())
+
+	_, err := Config{Store: StoreEtcd}.NewStore(nil)
+	assert.Error(err)
+}
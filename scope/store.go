@@ -0,0 +1,112 @@
+package scope
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreEtcd   = "etcd"
+)
+
+var (
+	errUnknownStore = errors.New("unknown scope store")
+	errMissingEtcd  = errors.New("the etcd scope store needs etcd")
+)
+
+// Store keeps the scopes of users. Api keys keep their own.
+type Store interface {
+	// Get returns a user's scope, which is empty if they have none.
+	Get(ctx context.Context, customerId string, userId int32) (Scope, error)
+
+	// Put sets a user's scope. An empty scope unrestricts them.
+	Put(ctx context.Context, customerId string, userId int32, s Scope) error
+
+	// List returns the scopes of a customer's scoped users.
+	List(ctx context.Context, customerId string) (map[int32]Scope, error)
+}
+
+// Config picks where user scopes are stored.
+type Config struct {
+	// Store is memory (the default), which only scopes users on this
+	// instance, or etcd.
+	Store string `json:"store"`
+}
+
+func (config Config) Validate() error {
+	switch config.Store {
+	case "", StoreMemory, StoreEtcd:
+	default:
+		return fmt.Errorf("%s: %s", errUnknownStore, config.Store)
+	}
+
+	return nil
+}
+
+// NewStore returns the configured store. keys are only needed by the etcd
+// store.
+func (config Config) NewStore(keys etcd.KeysAPI) (Store, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Store == StoreEtcd {
+		if keys == nil {
+			return nil, errMissingEtcd
+		}
+		return NewEtcdStore(keys), nil
+	}
+
+	return NewMemoryStore(), nil
+}
+
+// MemoryStore keeps scopes for as long as the process runs.
+type MemoryStore struct {
+	mut    sync.RWMutex
+	scopes map[string]map[int32]Scope
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{scopes: make(map[string]map[int32]Scope)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, customerId string, userId int32) (Scope, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	return m.scopes[customerId][userId], nil
+}
+
+func (m *MemoryStore) Put(ctx context.Context, customerId string, userId int32, s Scope) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if s.Unrestricted() {
+		delete(m.scopes[customerId], userId)
+		return nil
+	}
+
+	if m.scopes[customerId] == nil {
+		m.scopes[customerId] = make(map[int32]Scope)
+	}
+	m.scopes[customerId][userId] = s
+
+	return nil
+}
+
+func (m *MemoryStore) List(ctx context.Context, customerId string) (map[int32]Scope, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	scopes := make(map[int32]Scope)
+	for userId, s := range m.scopes[customerId] {
+		scopes[userId] = s
+	}
+
+	return scopes, nil
+}
@@ -0,0 +1,192 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+const (
+	// SessionPath has a key per session, under its customer and user, that
+	// expires with the session's token.
+	SessionPath = "/opsee.co/compost/sessions"
+
+	// RevokedPath has a key per revoked session, that expires with its token,
+	// and a key per user whose sessions were all revoked, holding the time
+	// they were revoked at, that expires after MaxTokenLifetime.
+	RevokedPath = "/opsee.co/compost/revoked"
+)
+
+// EtcdStore keeps sessions in etcd, so every compost sees the same
+// revocations.
+type EtcdStore struct {
+	keys etcd.KeysAPI
+}
+
+func NewEtcdStore(keys etcd.KeysAPI) *EtcdStore {
+	return &EtcdStore{keys: keys}
+}
+
+func (e *EtcdStore) Touch(ctx context.Context, s *Session) error {
+	ttl := ttlUntil(s.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.keys.Set(ctx, sessionKey(s.CustomerId, s.UserId, s.Id), string(data), &etcd.SetOptions{TTL: ttl})
+	return err
+}
+
+func (e *EtcdStore) List(ctx context.Context, customerId string, userId int32) ([]*Session, error) {
+	response, err := e.keys.Get(ctx, userSessionsKey(customerId, userId), &etcd.GetOptions{Quorum: true})
+	if etcd.IsKeyNotFound(err) {
+		return []*Session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := []*Session{}
+	for _, node := range response.Node.Nodes {
+		s := &Session{}
+		if err := json.Unmarshal([]byte(node.Value), s); err != nil {
+			return nil, fmt.Errorf("error decoding session %s: %s", node.Key, err)
+		}
+
+		if s.Expired(now) {
+			continue
+		}
+
+		revoked, err := e.Revoked(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if !revoked {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Sort(bySeen(sessions))
+
+	return sessions, nil
+}
+
+func (e *EtcdStore) Revoke(ctx context.Context, customerId string, userId int32, id string) error {
+	key := sessionKey(customerId, userId, id)
+
+	response, err := e.keys.Get(ctx, key, &etcd.GetOptions{Quorum: true})
+	if etcd.IsKeyNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	s := &Session{}
+	if err := json.Unmarshal([]byte(response.Node.Value), s); err != nil {
+		return fmt.Errorf("error decoding session %s: %s", key, err)
+	}
+
+	ttl := ttlUntil(s.ExpiresAt)
+	if ttl <= 0 {
+		return ErrNotFound
+	}
+
+	// the revocation has to be written before the session is forgotten, or a
+	// failure in between would leave it usable
+	if _, err := e.keys.Set(ctx, revokedSessionKey(id), customerId, &etcd.SetOptions{TTL: ttl}); err != nil {
+		return err
+	}
+
+	if _, err := e.keys.Delete(ctx, key, nil); err != nil && !etcd.IsKeyNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (e *EtcdStore) RevokeUser(ctx context.Context, customerId string, userId int32, before time.Time) error {
+	ttl := ttlUntil(before.Add(MaxTokenLifetime))
+	if ttl <= 0 {
+		return nil
+	}
+
+	cutoff := before.UTC().Format(time.RFC3339Nano)
+	if _, err := e.keys.Set(ctx, revokedUserKey(customerId, userId), cutoff, &etcd.SetOptions{TTL: ttl}); err != nil {
+		return err
+	}
+
+	_, err := e.keys.Delete(ctx, userSessionsKey(customerId, userId), &etcd.DeleteOptions{Recursive: true})
+	if err != nil && !etcd.IsKeyNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (e *EtcdStore) Revoked(ctx context.Context, s *Session) (bool, error) {
+	_, err := e.keys.Get(ctx, revokedSessionKey(s.Id), nil)
+	if err == nil {
+		return true, nil
+	}
+	if !etcd.IsKeyNotFound(err) {
+		return false, err
+	}
+
+	if s.IssuedAt.IsZero() {
+		return false, nil
+	}
+
+	response, err := e.keys.Get(ctx, revokedUserKey(s.CustomerId, s.UserId), nil)
+	if etcd.IsKeyNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cutoff, err := time.Parse(time.RFC3339Nano, response.Node.Value)
+	if err != nil {
+		return false, fmt.Errorf("error decoding session cutoff %s: %s", response.Node.Key, err)
+	}
+
+	return s.IssuedAt.Before(cutoff), nil
+}
+
+// ttlUntil is the ttl of a key that expires at t, rounded up to a second since
+// etcd ttls are whole seconds.
+func ttlUntil(t time.Time) time.Duration {
+	ttl := t.Sub(time.Now())
+	if ttl <= 0 {
+		return 0
+	}
+
+	return ((ttl + time.Second - 1) / time.Second) * time.Second
+}
+
+func userSessionsKey(customerId string, userId int32) string {
+	return path.Join(SessionPath, customerId, fmt.Sprint(userId))
+}
+
+func sessionKey(customerId string, userId int32, id string) string {
+	return path.Join(userSessionsKey(customerId, userId), id)
+}
+
+func revokedSessionKey(id string) string {
+	return path.Join(RevokedPath, "sessions", id)
+}
+
+func revokedUserKey(customerId string, userId int32) string {
+	return path.Join(RevokedPath, "users", customerId, fmt.Sprint(userId))
+}
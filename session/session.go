@@ -0,0 +1,75 @@
+// Package session tracks the vape tokens users sign in with, so they can be
+// listed, and revoked before they expire. Tokens themselves aren't stored,
+// only a hash of them.
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	"golang.org/x/net/context"
+)
+
+// MaxTokenLifetime is the longest a token can be used for. Revoking a user's
+// sessions only needs to be remembered this long, since every token it covers
+// has expired by then.
+const MaxTokenLifetime = 30 * 24 * time.Hour
+
+var (
+	ErrNotFound = errors.New("session not found")
+	ErrRevoked  = errors.New("session has been revoked")
+	ErrExpired  = errors.New("session has expired")
+)
+
+// Session is one token's use.
+type Session struct {
+	Id         string    `json:"id"`
+	CustomerId string    `json:"customer_id"`
+	UserId     int32     `json:"user_id"`
+	IssuedAt   time.Time `json:"issued_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// New is the session of a user's token.
+func New(token string, user *schema.User, issuedAt, expiresAt time.Time) *Session {
+	return &Session{
+		Id:         Id(token),
+		CustomerId: user.CustomerId,
+		UserId:     user.Id,
+		IssuedAt:   issuedAt.UTC(),
+		ExpiresAt:  expiresAt.UTC(),
+	}
+}
+
+// Id is a token's session id.
+func Id(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Expired is whether the session's token has expired by now.
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// Check returns ErrExpired or ErrRevoked if the session can't be used now.
+func Check(ctx context.Context, store Store, s *Session, now time.Time) error {
+	if s.Expired(now) {
+		return ErrExpired
+	}
+
+	revoked, err := store.Revoked(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if revoked {
+		return ErrRevoked
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opsee/basic/schema"
+	"github.com/opsee/compost/fake"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestStores(t *testing.T) {
+	for name, store := range map[string]Store{
+		StoreMemory: NewMemoryStore(),
+		StoreEtcd:   NewEtcdStore(fake.NewEtcd(nil)),
+	} {
+		testStore(t, name, store)
+	}
+}
+
+func testStore(t *testing.T, name string, store Store) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	user := &schema.User{Id: 1, CustomerId: "customer"}
+	other := &schema.User{Id: 2, CustomerId: "customer"}
+
+	laptop := New("laptop", user, now.Add(-time.Minute), now.Add(time.Hour))
+	phone := New("phone", user, now.Add(-time.Minute), now.Add(time.Hour))
+	theirs := New("theirs", other, now.Add(-time.Minute), now.Add(time.Hour))
+
+	laptop.LastSeen = now.Add(-time.Second)
+	phone.LastSeen = now
+	for _, s := range []*Session{laptop, phone, theirs} {
+		assert.NoError(store.Touch(ctx, s), name)
+		assert.NoError(Check(ctx, store, s, now), name)
+	}
+
+	sessions, err := store.List(ctx, "customer", 1)
+	assert.NoError(err, name)
+	if assert.Len(sessions, 2, name) {
+		assert.Equal(phone.Id, sessions[0].Id, name)
+		assert.Equal(laptop.Id, sessions[1].Id, name)
+	}
+
+	assert.Equal(ErrNotFound, store.Revoke(ctx, "customer", 2, phone.Id), name)
+	assert.NoError(store.Revoke(ctx, "customer", 1, phone.Id), name)
+	assert.Equal(ErrRevoked, Check(ctx, store, phone, now), name)
+	assert.NoError(Check(ctx, store, laptop, now), name)
+
+	// revoking a user revokes sessions that were never recorded too, but not
+	// ones issued after
+	unseen := New("unseen", user, now.Add(-time.Minute), now.Add(time.Hour))
+	later := New("later", user, now.Add(time.Minute), now.Add(time.Hour))
+	assert.NoError(store.RevokeUser(ctx, "customer", 1, now), name)
+	for _, s := range []*Session{laptop, unseen} {
+		assert.Equal(ErrRevoked, Check(ctx, store, s, now), name)
+	}
+	assert.NoError(Check(ctx, store, later, now), name)
+	assert.NoError(Check(ctx, store, theirs, now), name)
+
+	// sessions without an issue time aren't covered
+	basic := &Session{Id: Id("basic"), CustomerId: "customer", UserId: 1, ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(Check(ctx, store, basic, now), name)
+
+	// and revocations older than any token are forgotten
+	assert.NoError(store.RevokeUser(ctx, "customer", 2, now.Add(-MaxTokenLifetime-time.Minute)), name)
+	old := New("old", other, now.Add(-2*MaxTokenLifetime), now.Add(time.Hour))
+	assert.NoError(Check(ctx, store, old, now), name)
+
+	sessions, err = store.List(ctx, "customer", 1)
+	assert.NoError(err, name)
+	assert.Len(sessions, 0, name)
+
+	assert.Equal(ErrExpired, Check(ctx, store, theirs, now.Add(2*time.Hour)), name)
+}
+
+func TestConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Config{}.Validate())
+	assert.Error(Config{Store: "file"}.Validate())
+
+	_, err := Config{Store: StoreEtcd}.NewStore(nil)
+	assert.Error(err)
+
+	store, err := Config{Store: StoreEtcd}.NewStore(fake.NewEtcd(nil))
+	assert.NoError(err)
+	assert.IsType(&EtcdStore{}, store)
+}
@@ -0,0 +1,213 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreEtcd   = "etcd"
+)
+
+var (
+	errUnknownStore = errors.New("unknown session store")
+	errMissingEtcd  = errors.New("the etcd session store needs etcd")
+)
+
+// Store keeps sessions and what's been revoked.
+type Store interface {
+	// Touch records the session, last seen at its LastSeen.
+	Touch(ctx context.Context, s *Session) error
+
+	// List returns a user's unexpired and unrevoked sessions, most recently
+	// seen first.
+	List(ctx context.Context, customerId string, userId int32) ([]*Session, error)
+
+	// Revoke revokes one of a user's sessions, returning ErrNotFound if the
+	// user has no session with that id.
+	Revoke(ctx context.Context, customerId string, userId int32, id string) error
+
+	// RevokeUser revokes every session of a user issued before a time,
+	// including ones that were never recorded, but not sessions without an
+	// issue time. It's forgotten after MaxTokenLifetime.
+	RevokeUser(ctx context.Context, customerId string, userId int32, before time.Time) error
+
+	// Revoked is whether the session has been revoked.
+	Revoked(ctx context.Context, s *Session) (bool, error)
+}
+
+// Config picks where sessions are stored.
+type Config struct {
+	// Store is memory (the default), which only revokes sessions on this
+	// instance, or etcd.
+	Store string `json:"store"`
+}
+
+func (config Config) Validate() error {
+	switch config.Store {
+	case "", StoreMemory, StoreEtcd:
+	default:
+		return fmt.Errorf("%s: %s", errUnknownStore, config.Store)
+	}
+
+	return nil
+}
+
+// NewStore returns the configured store. keys are only needed by the etcd
+// store.
+func (config Config) NewStore(keys etcd.KeysAPI) (Store, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Store == StoreEtcd {
+		if keys == nil {
+			return nil, errMissingEtcd
+		}
+		return NewEtcdStore(keys), nil
+	}
+
+	return NewMemoryStore(), nil
+}
+
+// MemoryStore keeps sessions for as long as the process runs.
+type MemoryStore struct {
+	mut      sync.RWMutex
+	sessions map[string]*Session
+	revoked  map[string]time.Time
+	cutoffs  map[userKey]time.Time
+}
+
+type userKey struct {
+	customerId string
+	userId     int32
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*Session),
+		revoked:  make(map[string]time.Time),
+		cutoffs:  make(map[userKey]time.Time),
+	}
+}
+
+func (m *MemoryStore) Touch(ctx context.Context, s *Session) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	m.prune(time.Now())
+
+	touched := *s
+	m.sessions[s.Id] = &touched
+	return nil
+}
+
+func (m *MemoryStore) List(ctx context.Context, customerId string, userId int32) ([]*Session, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	now := time.Now()
+	sessions := []*Session{}
+	for _, s := range m.sessions {
+		if s.CustomerId != customerId || s.UserId != userId || s.Expired(now) || m.revokedLocked(s) {
+			continue
+		}
+
+		listed := *s
+		sessions = append(sessions, &listed)
+	}
+	sort.Sort(bySeen(sessions))
+
+	return sessions, nil
+}
+
+func (m *MemoryStore) Revoke(ctx context.Context, customerId string, userId int32, id string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.CustomerId != customerId || s.UserId != userId || s.Expired(time.Now()) {
+		return ErrNotFound
+	}
+
+	m.revoked[id] = s.ExpiresAt
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemoryStore) RevokeUser(ctx context.Context, customerId string, userId int32, before time.Time) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	now := time.Now()
+	m.prune(now)
+
+	if now.Before(before.Add(MaxTokenLifetime)) {
+		m.cutoffs[userKey{customerId, userId}] = before
+	}
+	for id, s := range m.sessions {
+		if s.CustomerId == customerId && s.UserId == userId && s.IssuedAt.Before(before) {
+			delete(m.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) Revoked(ctx context.Context, s *Session) (bool, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	return m.revokedLocked(s), nil
+}
+
+func (m *MemoryStore) revokedLocked(s *Session) bool {
+	if _, ok := m.revoked[s.Id]; ok {
+		return true
+	}
+
+	cutoff, ok := m.cutoffs[userKey{s.CustomerId, s.UserId}]
+	return ok && !s.IssuedAt.IsZero() && s.IssuedAt.Before(cutoff)
+}
+
+// prune forgets expired sessions and revocations, whose tokens can't be used
+// anyway, and user revocations older than any token. It must be called with
+// the lock held.
+func (m *MemoryStore) prune(now time.Time) {
+	for id, s := range m.sessions {
+		if s.Expired(now) {
+			delete(m.sessions, id)
+		}
+	}
+
+	for id, expiresAt := range m.revoked {
+		if !now.Before(expiresAt) {
+			delete(m.revoked, id)
+		}
+	}
+
+	for key, cutoff := range m.cutoffs {
+		if !now.Before(cutoff.Add(MaxTokenLifetime)) {
+			delete(m.cutoffs, key)
+		}
+	}
+}
+
+type bySeen []*Session
+
+func (s bySeen) Len() int      { return len(s) }
+func (s bySeen) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySeen) Less(i, j int) bool {
+	if !s[i].LastSeen.Equal(s[j].LastSeen) {
+		return s[i].LastSeen.After(s[j].LastSeen)
+	}
+
+	return s[i].Id < s[j].Id
+}
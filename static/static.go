@@ -0,0 +1,8 @@
+// Package static embeds the graphiql console, so it's served from the binary
+// rather than a directory on the host.
+package static
+
+import "embed"
+
+//go:embed index.html favicon.ico css js
+var Files embed.FS
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/opsee/logrus"
+)
+
+const (
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+var (
+	errUnknownExporter = errors.New("unknown trace exporter")
+	errMissingFile     = errors.New("the file trace exporter needs a file")
+)
+
+// Config picks where spans are exported.
+type Config struct {
+	// Exporter is stdout, file, or empty to turn tracing off.
+	Exporter string `json:"exporter"`
+
+	// File is appended to by the file exporter.
+	File string `json:"file,omitempty"`
+}
+
+func (config Config) Validate() error {
+	switch config.Exporter {
+	case "", ExporterStdout:
+	case ExporterFile:
+		if config.File == "" {
+			return errMissingFile
+		}
+	default:
+		return fmt.Errorf("%s: %s", errUnknownExporter, config.Exporter)
+	}
+
+	return nil
+}
+
+// NewExporter returns the configured exporter, or nil if tracing is off.
+func (config Config) NewExporter() (Exporter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.Exporter {
+	case ExporterStdout:
+		return NewWriterExporter(os.Stdout), nil
+	case ExporterFile:
+		file, err := os.OpenFile(config.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return NewWriterExporter(file), nil
+	}
+
+	return nil, nil
+}
+
+// WriterExporter writes each span to w as a line of json.
+type WriterExporter struct {
+	mut sync.Mutex
+	w   io.Writer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+func (e *WriterExporter) Export(span *Span) {
+	span.mut.Lock()
+	data, err := json.Marshal(span)
+	span.mut.Unlock()
+	if err != nil {
+		log.WithError(err).Error("error encoding span")
+		return
+	}
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	if _, err := e.w.Write(append(data, '\n')); err != nil {
+		log.WithError(err).Error("error exporting span")
+	}
+}
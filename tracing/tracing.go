@@ -0,0 +1,209 @@
+// Package tracing records spans for graphql requests, resolvers and backend
+// calls, and passes trace context on to backends as a w3c traceparent.
+//
+// Nothing is traced until an exporter is set. Until then StartSpan returns a
+// nil span, and every Span method is a no-op on nil.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Header is the http header and grpc metadata key trace context is passed in.
+const Header = "traceparent"
+
+type contextKey int
+
+const spanKey contextKey = iota
+
+// Exporter receives every span when it finishes.
+type Exporter interface {
+	Export(span *Span)
+}
+
+var exporter = struct {
+	sync.RWMutex
+	Exporter
+}{}
+
+// SetExporter sends finished spans to e. A nil e turns tracing off.
+func SetExporter(e Exporter) {
+	exporter.Lock()
+	exporter.Exporter = e
+	exporter.Unlock()
+}
+
+func currentExporter() Exporter {
+	exporter.RLock()
+	defer exporter.RUnlock()
+
+	return exporter.Exporter
+}
+
+// Span is one timed operation in a trace.
+type Span struct {
+	TraceId  string            `json:"trace_id"`
+	SpanId   string            `json:"span_id"`
+	ParentId string            `json:"parent_id,omitempty"`
+	Name     string            `json:"name"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration_ns"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	mut      sync.Mutex
+	exporter Exporter
+}
+
+// StartSpan starts a span named name, as a child of the span in ctx if there
+// is one, and returns a context carrying it.
+func StartSpan(ctx context.Context, name string) (*Span, context.Context) {
+	e := currentExporter()
+	if e == nil {
+		return nil, ctx
+	}
+
+	span := &Span{
+		SpanId:   newId(8),
+		Name:     name,
+		Start:    time.Now(),
+		exporter: e,
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceId = parent.TraceId
+		span.ParentId = parent.SpanId
+	} else {
+		span.TraceId = newId(16)
+	}
+
+	return span, context.WithValue(ctx, spanKey, span)
+}
+
+// FromContext returns the span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// SetTag annotates the span.
+func (s *Span) SetTag(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mut.Lock()
+	if s.Tags == nil {
+		s.Tags = make(map[string]string)
+	}
+	s.Tags[key] = value
+	s.mut.Unlock()
+}
+
+// Finish ends the span, recording err if it failed, and exports it.
+func (s *Span) Finish(err error) {
+	if s == nil || s.exporter == nil {
+		return
+	}
+
+	s.mut.Lock()
+	s.Duration = time.Since(s.Start)
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.mut.Unlock()
+
+	s.exporter.Export(s)
+}
+
+// Traceparent formats the span as a w3c traceparent.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("00-%s-%s-01", s.TraceId, s.SpanId)
+}
+
+// WithTraceparent continues the trace in a traceparent sent by a client, so
+// spans started from the returned context are its children. Malformed
+// traceparents are ignored.
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || !isHex(parts[1], 32) || !isHex(parts[2], 16) {
+		return ctx
+	}
+
+	// the remote span is never finished or exported, it's only a parent
+	return context.WithValue(ctx, spanKey, &Span{TraceId: parts[1], SpanId: parts[2]})
+}
+
+// WithGRPCMetadata adds the span in ctx to the outgoing grpc metadata.
+func WithGRPCMetadata(ctx context.Context) context.Context {
+	span := FromContext(ctx)
+	if span == nil {
+		return ctx
+	}
+
+	md, ok := metadata.FromContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	md[Header] = []string{span.Traceparent()}
+
+	return metadata.NewContext(ctx, md)
+}
+
+// Transport sets the traceparent header of requests whose context carries a
+// span, then sends them with Base, or http.DefaultTransport if it's nil.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	span := FromContext(req.Context())
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+
+	// round trippers mustn't modify the request they're given
+	traced := req.Clone(req.Context())
+	traced.Header.Set(Header, span.Traceparent())
+
+	return base.RoundTrip(traced)
+}
+
+func newId(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSpans(t *testing.T) {
+	assert := assert.New(t)
+
+	span, ctx := StartSpan(context.Background(), "untraced")
+	assert.Nil(span)
+	span.SetTag("no", "op")
+	span.Finish(nil)
+
+	buf := &bytes.Buffer{}
+	SetExporter(NewWriterExporter(buf))
+	defer SetExporter(nil)
+
+	ctx = WithTraceparent(ctx, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	parent, ctx := StartSpan(ctx, "graphql")
+	child, childCtx := StartSpan(ctx, "cats GetUser")
+	child.SetTag("backend", "cats")
+	child.Finish(errors.New("nope"))
+	parent.Finish(nil)
+
+	assert.Equal("0af7651916cd43dd8448eb211c80319c", parent.TraceId)
+	assert.Equal("b7ad6b7169203331", parent.ParentId)
+	assert.Equal(parent.TraceId, child.TraceId)
+	assert.Equal(parent.SpanId, child.ParentId)
+
+	md, ok := metadata.FromContext(WithGRPCMetadata(childCtx))
+	assert.True(ok)
+	assert.Equal([]string{"00-0af7651916cd43dd8448eb211c80319c-" + child.SpanId + "-01"}, md[Header])
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(lines, 2)
+
+	exported := &Span{}
+	assert.NoError(json.Unmarshal([]byte(lines[0]), exported))
+	assert.Equal("cats GetUser", exported.Name)
+	assert.Equal("nope", exported.Error)
+	assert.Equal(map[string]string{"backend": "cats"}, exported.Tags)
+}
+
+func TestWithTraceparent(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, traceparent := range []string{"", "00-nope-b7ad6b7169203331-01", "00-0af7651916cd43dd8448eb211c80319c-b7ad-01"} {
+		assert.Nil(FromContext(WithTraceparent(context.Background(), traceparent)), traceparent)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	assert := assert.New(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(Header)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	get := func(ctx context.Context) {
+		req, err := http.NewRequest("GET", server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	get(context.Background())
+	assert.Empty(traceparent)
+
+	SetExporter(NewWriterExporter(&bytes.Buffer{}))
+	defer SetExporter(nil)
+
+	span, ctx := StartSpan(context.Background(), "bartnet GET /gql/checks")
+	get(ctx)
+	assert.Equal(span.Traceparent(), traceparent)
+}